@@ -0,0 +1,416 @@
+package wd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gen/field"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditActionUpdate = "update"
+
+	defaultAuditIdentityKey = "identity"
+	auditMaskedValue        = "******"
+)
+
+// AuditLog 一次实体变更的审计记录。
+type AuditLog struct {
+	ID         uint64        `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Operator   string        `gorm:"column:operator;type:varchar(128);not null;default:''" json:"operator"`
+	TraceID    string        `gorm:"column:trace_id;type:varchar(64);not null;default:'';index" json:"trace_id"`
+	Table      string        `gorm:"column:table_name;type:varchar(128);not null;index:idx_audit_log_table_pk,priority:1" json:"table_name"`
+	PrimaryKey string        `gorm:"column:primary_key;type:varchar(128);not null;default:'';index:idx_audit_log_table_pk,priority:2" json:"primary_key"`
+	Action     string        `gorm:"column:action;type:varchar(32);not null" json:"action"`
+	Changes    []AuditChange `gorm:"column:changes;type:text;not null;serializer:json" json:"changes"`
+	CreatedAt  time.Time     `gorm:"column:created_at;not null;index" json:"created_at"`
+}
+
+// TableName 返回审计表名。
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// AuditChange 单个列的新旧值，敏感列已脱敏。
+type AuditChange struct {
+	Column string `json:"column"`
+	Field  string `json:"field"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+}
+
+// InitAuditTable 在数据库中创建审计表，如果mandatory为true则会强制迁移，否则则会先去检查是否存在，不存在才创建
+func InitAuditTable(mandatory ...bool) error {
+	if InsDB == nil {
+		return gormClientNilErr()
+	}
+	if len(mandatory) == 0 || (len(mandatory) > 0 && !mandatory[0]) {
+		if InsDB.DB.Migrator().HasTable(&AuditLog{}) {
+			return nil
+		}
+	}
+
+	return InsDB.DB.AutoMigrate(&AuditLog{})
+}
+
+// AuditSink 审计记录的写入目标。
+type AuditSink interface {
+	WriteAudit(ctx context.Context, logs []*AuditLog) error
+}
+
+// AuditSinkFunc 把函数适配为 AuditSink。
+type AuditSinkFunc func(ctx context.Context, logs []*AuditLog) error
+
+// WriteAudit 调用函数本身。
+func (f AuditSinkFunc) WriteAudit(ctx context.Context, logs []*AuditLog) error {
+	return f(ctx, logs)
+}
+
+// auditTxSink 标记需要在业务事务内同步写入的 sink，写入失败会让 Record 返回错误并随业务一起回滚。
+type auditTxSink struct {
+	AuditSinkFunc
+}
+
+// NewAuditDBSink 写入 audit_log 表。
+// db 为空时使用 ctx 中的事务连接（没有事务时使用 InsDB），在事务中与业务数据一起提交，并回填审计记录的 ID；
+// 指定 db 时在事务提交后写入。
+func NewAuditDBSink(db *gorm.DB) AuditSink {
+	if db != nil {
+		return AuditSinkFunc(func(ctx context.Context, logs []*AuditLog) error {
+			return db.WithContext(ctx).Create(logs).Error
+		})
+	}
+	return auditTxSink{func(ctx context.Context, logs []*AuditLog) error {
+		if !InTx(ctx) && (InsDB == nil || InsDB.DB == nil) {
+			return gormClientNilErr()
+		}
+		return DB(ctx).Create(logs).Error
+	}}
+}
+
+// NewAuditOutboxSink 通过 PublishOutbox 把审计记录写入发件箱，在事务中与业务数据一起提交，由 OutboxRelay 投递到 topic 注册的 sink。
+// 审计记录已有 ID 时（排在 NewAuditDBSink(nil) 之后）用作事件 key，否则由发件箱 ID 代替，重试时 ES 等目标不会重复写入。
+func NewAuditOutboxSink(topic string) AuditSink {
+	return auditTxSink{func(ctx context.Context, logs []*AuditLog) error {
+		for _, auditLog := range logs {
+			if err := PublishOutbox(ctx, topic, auditDocumentID(auditLog), auditLog); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// NewAuditReqLogSink 把审计记录转换为 ReqLog 交给请求日志的 SaveLog 回调，Module 为 audit，Option 为 "<action> <table>"。
+func NewAuditReqLogSink(saveLog func(ReqLog)) AuditSink {
+	return AuditSinkFunc(func(_ context.Context, logs []*AuditLog) error {
+		if saveLog == nil {
+			return errors.New("SaveLog 回调不能为空")
+		}
+		for _, auditLog := range logs {
+			saveLog(ReqLog{
+				ReqTime: auditLog.CreatedAt,
+				Module:  "audit",
+				Option:  auditLog.Action + " " + auditLog.Table,
+				Logs: []LogEntry{{
+					Level:   zerolog.InfoLevel,
+					Message: "audit",
+					Fields: map[string]any{
+						"operator":    auditLog.Operator,
+						"trace_id":    auditLog.TraceID,
+						"table_name":  auditLog.Table,
+						"primary_key": auditLog.PrimaryKey,
+					},
+					Payload: auditLog.Changes,
+					Time:    auditLog.CreatedAt.Format(CSTLayout),
+				}},
+			})
+		}
+		return nil
+	})
+}
+
+// NewAuditEsSink 通过 ES bulk 批量写入 index，写入方式与 NewOutboxEsSink 相同。
+// 事务提交后尽力写入，失败只交给 WithAuditorErrorHandler；审计记录已有 ID 时用作文档 ID。
+// 需要可靠投递时请使用 NewAuditOutboxSink，并为 topic 注册 NewOutboxEsSink。
+func NewAuditEsSink(index string) AuditSink {
+	sink := NewOutboxEsSink(index)
+	return AuditSinkFunc(func(ctx context.Context, logs []*AuditLog) error {
+		messages := make([]*OutboxMessage, 0, len(logs))
+		for _, auditLog := range logs {
+			payload, err := json.Marshal(auditLog)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, &OutboxMessage{
+				Topic:     index,
+				MsgKey:    auditDocumentID(auditLog),
+				Payload:   string(payload),
+				CreatedAt: auditLog.CreatedAt,
+			})
+		}
+		return errors.Join(sink.Deliver(ctx, messages)...)
+	})
+}
+
+var InsAuditor *Auditor
+
+// Auditor 审计记录器。
+type Auditor struct {
+	sinks        []AuditSink
+	masks        map[string]func(string) string
+	identityKey  string
+	operatorFunc func(ctx context.Context) string
+	errorHandler func(err error)
+}
+
+type WithAuditorOption func(*Auditor)
+
+// WithAuditorSink 添加写入目标，可以同时写入多个，按添加顺序写入。
+func WithAuditorSink(sinks ...AuditSink) WithAuditorOption {
+	return func(a *Auditor) {
+		a.sinks = append(a.sinks, sinks...)
+	}
+}
+
+// WithAuditorMask 为列设置脱敏函数，列名不区分大小写，也可以使用请求结构体的字段名。
+// 默认 mobile、phone 使用 MaskMobile，id_card、idcard、id_no 使用 MaskIDCard，password 整体隐藏。
+func WithAuditorMask(mask func(string) string, columns ...string) WithAuditorOption {
+	return func(a *Auditor) {
+		for _, column := range columns {
+			a.masks[strings.ToLower(column)] = mask
+		}
+	}
+}
+
+// WithAuditorIdentityKey 设置从 ctx 中读取操作人的键，默认与 JWT 中间件的 IdentityKey 默认值 identity 一致。
+func WithAuditorIdentityKey(key string) WithAuditorOption {
+	return func(a *Auditor) {
+		if key != "" {
+			a.identityKey = key
+		}
+	}
+}
+
+// WithAuditorOperator 自定义操作人的获取方式，设置后忽略 IdentityKey。
+func WithAuditorOperator(fn func(ctx context.Context) string) WithAuditorOption {
+	return func(a *Auditor) {
+		a.operatorFunc = fn
+	}
+}
+
+// WithAuditorErrorHandler 设置写入失败时的回调，默认使用标准库 log.Printf 输出。
+func WithAuditorErrorHandler(handler func(err error)) WithAuditorOption {
+	return func(a *Auditor) {
+		if handler != nil {
+			a.errorHandler = handler
+		}
+	}
+}
+
+// NewAuditor 创建审计记录器。
+func NewAuditor(opts ...WithAuditorOption) *Auditor {
+	a := &Auditor{
+		masks: map[string]func(string) string{
+			"mobile":   MaskMobile,
+			"phone":    MaskMobile,
+			"id_card":  MaskIDCard,
+			"idcard":   MaskIDCard,
+			"id_no":    MaskIDCard,
+			"password": func(string) string { return auditMaskedValue },
+		},
+		identityKey: defaultAuditIdentityKey,
+		errorHandler: func(err error) {
+			log.Printf("写入审计日志失败: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// InitAuditor 创建审计记录器并赋值给 InsAuditor。
+func InitAuditor(opts ...WithAuditorOption) *Auditor {
+	InsAuditor = NewAuditor(opts...)
+	return InsAuditor
+}
+
+// BuildGenUpdatesAudit 与 BuildGenUpdates 相同，同时返回记录了变更列新旧值的审计记录，没有变更时 Changes 为空。
+// 未调用 InitAuditor 时按默认规则脱敏。
+func BuildGenUpdatesAudit(ctx context.Context, req any, oldModel any, table any) ([]field.AssignExpr, *AuditLog, error) {
+	auditor := InsAuditor
+	if auditor == nil {
+		auditor = NewAuditor()
+	}
+	return auditor.BuildGenUpdates(ctx, req, oldModel, table)
+}
+
+// RecordAudit 用来通过 InsAuditor 写入审计记录。
+func RecordAudit(ctx context.Context, logs ...*AuditLog) error {
+	if InsAuditor == nil {
+		return errors.New("InsAuditor为空,需要先使用InitAuditor()进行初始化")
+	}
+	return InsAuditor.Record(ctx, logs...)
+}
+
+// BuildGenUpdates 用来生成更新表达式和审计记录，操作人和 Trace ID 取自 ctx，表名取自 table 的 TableName，主键取自 oldModel。
+func (a *Auditor) BuildGenUpdates(ctx context.Context, req any, oldModel any, table any) ([]field.AssignExpr, *AuditLog, error) {
+	updates, changes, err := buildGenUpdates(req, oldModel, table, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auditLog := a.NewLog(ctx, AuditActionUpdate, auditTableName(table), auditPrimaryKey(oldModel))
+	for _, change := range changes {
+		if !change.Changed {
+			continue
+		}
+		auditLog.Changes = append(auditLog.Changes, AuditChange{
+			Column: change.Column,
+			Field:  change.Field,
+			Old:    a.mask(change, change.Old),
+			New:    a.mask(change, change.New),
+		})
+	}
+	return updates, auditLog, nil
+}
+
+// NewLog 用来创建一条审计记录并填充操作人、Trace ID 和时间，供新增、删除等非 PATCH 场景使用。
+func (a *Auditor) NewLog(ctx context.Context, action, table, primaryKey string) *AuditLog {
+	return &AuditLog{
+		Operator:   a.operator(ctx),
+		TraceID:    auditTraceID(ctx),
+		Table:      table,
+		PrimaryKey: primaryKey,
+		Action:     action,
+		CreatedAt:  Now(),
+	}
+}
+
+// Record 用来写入审计记录，Changes 为空的记录会被忽略。
+// ctx 中存在事务时，NewAuditDBSink(nil) 与 NewAuditOutboxSink 在事务内同步写入，失败时返回错误，业务应当回滚；
+// 其余 sink 在事务提交后写入，回滚时不写入，写入失败交给 WithAuditorErrorHandler 处理，不影响业务。
+func (a *Auditor) Record(ctx context.Context, logs ...*AuditLog) error {
+	pending := make([]*AuditLog, 0, len(logs))
+	for _, auditLog := range logs {
+		if auditLog != nil && len(auditLog.Changes) > 0 {
+			pending = append(pending, auditLog)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	deferred := make([]AuditSink, 0, len(a.sinks))
+	for _, sink := range a.sinks {
+		if _, ok := sink.(auditTxSink); ok && InTx(ctx) {
+			if err := sink.WriteAudit(ctx, pending); err != nil {
+				return fmt.Errorf("写入审计日志失败: %w", err)
+			}
+			continue
+		}
+		deferred = append(deferred, sink)
+	}
+	AfterCommit(ctx, func(ctx context.Context) {
+		for _, sink := range deferred {
+			if err := sink.WriteAudit(ctx, pending); err != nil {
+				a.errorHandler(err)
+			}
+		}
+	})
+	return nil
+}
+
+// auditDocumentID 返回审计记录的 ID 作为外部存储的文档 ID，尚未写入数据库时为空。
+func auditDocumentID(auditLog *AuditLog) string {
+	if auditLog.ID == 0 {
+		return ""
+	}
+	return strconv.FormatUint(auditLog.ID, 10)
+}
+
+func (a *Auditor) mask(change GenUpdateChange, value any) any {
+	if value == nil {
+		return nil
+	}
+	if isEncryptedValue(value) {
+		// 加密列始终隐藏，不经过 fmt 或 JSON 输出明文
+		return auditMaskedValue
+	}
+	mask, ok := a.masks[strings.ToLower(change.Column)]
+	if !ok {
+		mask, ok = a.masks[strings.ToLower(change.Field)]
+	}
+	if !ok {
+		return value
+	}
+	return mask(fmt.Sprint(value))
+}
+
+func (a *Auditor) operator(ctx context.Context) string {
+	if a.operatorFunc != nil {
+		return a.operatorFunc(ctx)
+	}
+	if ctx == nil {
+		return ""
+	}
+	if identity := ctx.Value(a.identityKey); identity != nil {
+		return fmt.Sprint(identity)
+	}
+	return ""
+}
+
+// auditTraceID 用来从 gin.Context 中读取 MiddlewareTraceID 写入的 Trace ID。
+func auditTraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	traceID, _ := ctx.Value(HeaderTraceID).(string)
+	return traceID
+}
+
+func auditTableName(table any) string {
+	if tabler, ok := table.(interface{ TableName() string }); ok {
+		return tabler.TableName()
+	}
+	return ""
+}
+
+// auditPrimaryKey 用来取得 gorm 标签中带 primaryKey 的字段值，没有时使用 ID 字段。
+func auditPrimaryKey(model any) string {
+	value, ok, _ := patchBuildOptionalStructValue(model)
+	if !ok {
+		return ""
+	}
+	valueType := value.Type()
+	for i := range value.NumField() {
+		structField := valueType.Field(i)
+		if structField.PkgPath == "" && strings.Contains(strings.ToLower(structField.Tag.Get("gorm")), "primarykey") {
+			return auditFormatKey(value.Field(i))
+		}
+	}
+	if id := value.FieldByName("ID"); id.IsValid() {
+		return auditFormatKey(id)
+	}
+	return ""
+}
+
+func auditFormatKey(value reflect.Value) string {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -150,6 +150,22 @@ type GinJWTMiddleware struct {
 
 	// ParseOptions 允许修改 jwt 的解析方法
 	ParseOptions []jwt.ParserOption
+
+	// 登录成功后判断是否需要二次验证，返回 true 时 LoginHandler 只签发 mfa_pending 令牌，
+	// 该令牌只能用于 MFAVerifyHandler。可选。
+	MFARequired func(c *gin.Context, data interface{}) bool
+
+	// 校验二次验证码，claims 为 mfa_pending 令牌中的负载，返回 nil 表示通过。使用 MFARequired 时必需。
+	MFAVerifier func(c *gin.Context, claims map[string]interface{}) error
+
+	// mfa_pending 令牌的有效时长。可选，默认 5 分钟。
+	MFATimeout time.Duration
+
+	// 每个 mfa_pending 令牌允许的验证次数，依赖 InsRedis 计数，未初始化 Redis 时不限制。可选，默认 5 次。
+	MFAMaxAttempts int
+
+	// 用户可以定义自己的 mfa_pending 令牌响应函数。
+	MFAResponse func(c *gin.Context, token string, expire time.Time)
 }
 
 // JWTOption 是 GinJWTMiddleware 的函数选项类型。
@@ -328,6 +344,24 @@ func (mw *GinJWTMiddleware) init() error {
 		}
 	}
 
+	if mw.MFATimeout == 0 {
+		mw.MFATimeout = defaultMFATimeout
+	}
+
+	if mw.MFAMaxAttempts == 0 {
+		mw.MFAMaxAttempts = defaultMFAMaxAttempts
+	}
+
+	if mw.MFAResponse == nil {
+		mw.MFAResponse = func(c *gin.Context, token string, expire time.Time) {
+			ResponseSuccess(c, gin.H{
+				"mfa_required": true,
+				"mfa_token":    token,
+				"expire":       expire.Unix(),
+			})
+		}
+	}
+
 	if mw.IdentityKey == "" {
 		mw.IdentityKey = "identity"
 	}
@@ -388,6 +422,8 @@ func (mw *GinJWTMiddleware) middlewareImpl(c *gin.Context) {
 		var appErr *AppError
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			appErr = MsgErrTokenServerInvalid("登陆过期请重新登录", err)
+		} else if errors.Is(err, ErrMFAPending) {
+			appErr = MsgErrTokenServerInvalid(ErrMFAPending.Error())
 		} else {
 			appErr = MsgErrTokenServerInvalid("登陆凭证无效请重新登录", err)
 		}
@@ -433,12 +469,15 @@ func (mw *GinJWTMiddleware) validateExpiration(claims map[string]interface{}) *A
 	return nil
 }
 
-// GetClaimsFromJWT 用来解析请求中的 JWT 并返回 Claims。
+// GetClaimsFromJWT 用来解析请求中的 JWT 并返回 Claims，未完成二次验证的 mfa_pending 令牌返回 ErrMFAPending。
 func (mw *GinJWTMiddleware) GetClaimsFromJWT(c *gin.Context) (map[string]interface{}, error) {
 	token, err := mw.ParseToken(c)
 	if err != nil {
 		return nil, err
 	}
+	if isMFAPending(token.Claims.(jwt.MapClaims)) {
+		return nil, ErrMFAPending
+	}
 
 	if mw.SendAuthorization {
 		if v, ok := c.Get(CtxKeyJWTToken); ok {
@@ -470,41 +509,54 @@ func (mw *GinJWTMiddleware) LoginHandler() gin.HandlerFunc {
 			return
 		}
 
-		// 创建令牌
-		token := jwt.New(jwt.GetSigningMethod(mw.SigningAlgorithm))
-		claims := token.Claims.(jwt.MapClaims)
+		if mw.MFARequired != nil && mw.MFARequired(c, data) {
+			mw.issueMFAPending(c, data)
+			return
+		}
 
+		claims := jwt.MapClaims{}
 		if mw.PayloadFunc != nil {
 			for key, value := range mw.PayloadFunc(data) {
 				claims[key] = value
 			}
 		}
+		mw.issueLoginToken(c, claims)
+	}
+}
 
-		copyClaims := make(jwt.MapClaims, len(claims))
-		for k, v := range claims {
-			copyClaims[k] = v
-		}
+// issueLoginToken 用来按负载签发正式令牌并写入 cookie、返回登录响应。
+func (mw *GinJWTMiddleware) issueLoginToken(c *gin.Context, payload jwt.MapClaims) {
+	// 创建令牌
+	token := jwt.New(jwt.GetSigningMethod(mw.SigningAlgorithm))
+	claims := token.Claims.(jwt.MapClaims)
+	for key, value := range payload {
+		claims[key] = value
+	}
 
-		expire := mw.TimeFunc().Add(mw.TimeoutFunc(copyClaims))
-		claims["exp"] = expire.Unix()
-		claims["orig_iat"] = mw.TimeFunc().Unix()
-		tokenString, err := mw.signedString(token)
-		if err != nil {
-			appError := MsgErrTokenServerInvalid("创建登陆凭证失败", err)
-			mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
-			return
-		}
+	copyClaims := make(jwt.MapClaims, len(claims))
+	for k, v := range claims {
+		copyClaims[k] = v
+	}
 
-		// 设置 cookie
-		if mw.Cookie != nil {
-			expireCookie := mw.TimeFunc().Add(mw.Cookie.MaxAge)
-			maxage := int(expireCookie.Unix() - mw.TimeFunc().Unix())
-			c.SetSameSite(mw.Cookie.SameSite)
-			c.SetCookie(mw.Cookie.Name, tokenString, maxage, "/", mw.Cookie.Domain, mw.Cookie.Secure, mw.Cookie.HTTPOnly)
-		}
+	expire := mw.TimeFunc().Add(mw.TimeoutFunc(copyClaims))
+	claims["exp"] = expire.Unix()
+	claims["orig_iat"] = mw.TimeFunc().Unix()
+	tokenString, err := mw.signedString(token)
+	if err != nil {
+		appError := MsgErrTokenServerInvalid("创建登陆凭证失败", err)
+		mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+		return
+	}
 
-		mw.LoginResponse(c, http.StatusOK, tokenString, expire)
+	// 设置 cookie
+	if mw.Cookie != nil {
+		expireCookie := mw.TimeFunc().Add(mw.Cookie.MaxAge)
+		maxage := int(expireCookie.Unix() - mw.TimeFunc().Unix())
+		c.SetSameSite(mw.Cookie.SameSite)
+		c.SetCookie(mw.Cookie.Name, tokenString, maxage, "/", mw.Cookie.Domain, mw.Cookie.Secure, mw.Cookie.HTTPOnly)
 	}
+
+	mw.LoginResponse(c, http.StatusOK, tokenString, expire)
 }
 
 // LogoutHandler 用来清理客户端 cookie 并返回退出响应。
@@ -593,6 +645,9 @@ func (mw *GinJWTMiddleware) CheckIfTokenExpire(c *gin.Context) (jwt.MapClaims, e
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
+	if isMFAPending(claims) {
+		return nil, MsgErrTokenClientInvalid("请先完成二次验证")
+	}
 
 	origIat, err := parseJWTNumericClaim(claims, "orig_iat")
 	if err != nil {
@@ -809,8 +864,19 @@ func parseTokenLookupMethod(method string) (string, string, error) {
 	return source, name, nil
 }
 
-// ParseTokenString 用来解析给定的原始令牌字符串。
+// ParseTokenString 用来解析给定的原始令牌字符串，未完成二次验证的 mfa_pending 令牌返回 ErrMFAPending。
 func (mw *GinJWTMiddleware) ParseTokenString(token string) (*jwt.Token, error) {
+	parsed, err := mw.parseTokenString(token)
+	if err != nil {
+		return parsed, err
+	}
+	if claims, ok := parsed.Claims.(jwt.MapClaims); ok && isMFAPending(claims) {
+		return nil, ErrMFAPending
+	}
+	return parsed, nil
+}
+
+func (mw *GinJWTMiddleware) parseTokenString(token string) (*jwt.Token, error) {
 	if mw.KeyFunc != nil {
 		return jwt.Parse(token, mw.KeyFunc, mw.ParseOptions...)
 	}
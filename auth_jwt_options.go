@@ -111,6 +111,41 @@ func WithJWTRSA(cfg JWTRSAConfig) JWTOption {
 	return func(mw *GinJWTMiddleware) { mw.RSA = cfg }
 }
 
+// ── 二次验证 ──────────────────────────────────────────────────
+
+// WithJWTMFA 开启登录二次验证。required 根据 Authenticator 返回的用户判断是否需要二次验证，
+// verifier 从 mfa_pending 令牌中读取负载 P 并校验验证码，P 通常与 NewGinJWTMiddleware 的负载类型一致。
+func WithJWTMFA[T any, P any](required func(c *gin.Context, data T) bool, verifier func(c *gin.Context, payload P) error) JWTOption {
+	return func(mw *GinJWTMiddleware) {
+		mw.MFARequired = func(c *gin.Context, data interface{}) bool {
+			user, ok := data.(T)
+			return ok && required(c, user)
+		}
+		mw.MFAVerifier = func(c *gin.Context, claims map[string]interface{}) error {
+			payload, err := ExtractClaimsAs[P](c)
+			if err != nil {
+				return MsgErrTokenClientInvalid("登陆凭证无效请重新登录", err)
+			}
+			return verifier(c, payload)
+		}
+	}
+}
+
+// WithJWTMFATimeout 设置 mfa_pending 令牌的有效时长，默认 5 分钟。
+func WithJWTMFATimeout(d time.Duration) JWTOption {
+	return func(mw *GinJWTMiddleware) { mw.MFATimeout = d }
+}
+
+// WithJWTMFAMaxAttempts 设置每个 mfa_pending 令牌允许的验证次数，默认 5 次，小于 0 表示不限制。
+func WithJWTMFAMaxAttempts(n int) JWTOption {
+	return func(mw *GinJWTMiddleware) { mw.MFAMaxAttempts = n }
+}
+
+// WithJWTMFAResponse 设置签发 mfa_pending 令牌时的响应回调。
+func WithJWTMFAResponse(fn func(c *gin.Context, token string, expire time.Time)) JWTOption {
+	return func(mw *GinJWTMiddleware) { mw.MFAResponse = fn }
+}
+
 // ── 逃生口 ────────────────────────────────────────────────────
 
 // WithJWTCustom 提供直接修改 GinJWTMiddleware 的逃生口，用于覆盖选项函数未提供的冷门字段。
@@ -0,0 +1,478 @@
+package wd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	OTPAlgorithmSHA1   = "SHA1"
+	OTPAlgorithmSHA256 = "SHA256"
+	OTPAlgorithmSHA512 = "SHA512"
+
+	JWTClaimMFAPending = "mfa_pending"
+	JWTClaimMFAID      = "mfa_id"
+
+	defaultMFATimeout         = 5 * time.Minute
+	defaultMFAMaxAttempts     = 5
+	defaultOTPReplayPrefix    = "mfa-otp-used:"
+	defaultMFAAttemptPrefix   = "mfa-attempts:"
+	defaultMFAConsumedPrefix  = "mfa-consumed:"
+	defaultRecoveryCodeCount  = 10
+	recoveryCodeAlphabet      = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeHalfLength    = 5
+	otpSecretDefaultByteCount = 20
+)
+
+// ErrMFAPending 表示令牌仍处于 mfa_pending 状态，只能用于 MFAVerifyHandler。
+var ErrMFAPending = errors.New("请先完成二次验证")
+
+var otpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type otpConfig struct {
+	issuer       string
+	digits       int
+	algorithm    string
+	period       time.Duration
+	skew         int
+	lookAhead    int
+	replayPrefix string
+}
+
+// WithOTPOption TOTP/HOTP 的配置项。
+type WithOTPOption func(*otpConfig)
+
+// WithOTPIssuer 设置签发方名称，显示在验证器 App 中。
+func WithOTPIssuer(issuer string) WithOTPOption {
+	return func(cfg *otpConfig) {
+		cfg.issuer = issuer
+	}
+}
+
+// WithOTPDigits 设置验证码位数，默认 6，只支持 6 到 8 位。
+func WithOTPDigits(digits int) WithOTPOption {
+	return func(cfg *otpConfig) {
+		if digits >= 6 && digits <= 8 {
+			cfg.digits = digits
+		}
+	}
+}
+
+// WithOTPAlgorithm 设置 HMAC 算法，默认 SHA1，多数验证器 App 只支持 SHA1。
+func WithOTPAlgorithm(algorithm string) WithOTPOption {
+	return func(cfg *otpConfig) {
+		switch strings.ToUpper(algorithm) {
+		case OTPAlgorithmSHA1, OTPAlgorithmSHA256, OTPAlgorithmSHA512:
+			cfg.algorithm = strings.ToUpper(algorithm)
+		}
+	}
+}
+
+// WithOTPPeriod 设置 TOTP 时间步长，默认 30 秒。
+func WithOTPPeriod(period time.Duration) WithOTPOption {
+	return func(cfg *otpConfig) {
+		if period >= time.Second {
+			cfg.period = period
+		}
+	}
+}
+
+// WithOTPSkew 设置 TOTP 前后允许偏差的时间步数，默认 1。
+func WithOTPSkew(skew int) WithOTPOption {
+	return func(cfg *otpConfig) {
+		if skew >= 0 {
+			cfg.skew = skew
+		}
+	}
+}
+
+// WithOTPLookAhead 设置 HOTP 向后查找的计数器个数，默认 10。
+func WithOTPLookAhead(n int) WithOTPOption {
+	return func(cfg *otpConfig) {
+		if n >= 0 {
+			cfg.lookAhead = n
+		}
+	}
+}
+
+// WithOTPReplayPrefix 设置 TOTP 已用验证码在 Redis 中的键前缀，默认 mfa-otp-used:。
+func WithOTPReplayPrefix(prefix string) WithOTPOption {
+	return func(cfg *otpConfig) {
+		if prefix != "" {
+			cfg.replayPrefix = prefix
+		}
+	}
+}
+
+func newOTPConfig(opts []WithOTPOption) otpConfig {
+	cfg := otpConfig{
+		digits:       6,
+		algorithm:    OTPAlgorithmSHA1,
+		period:       30 * time.Second,
+		skew:         1,
+		lookAhead:    10,
+		replayPrefix: defaultOTPReplayPrefix,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// GenerateOTPSecret 用来生成 20 字节的随机密钥，返回不带填充的 Base32 文本。
+func GenerateOTPSecret() (string, error) {
+	secret := make([]byte, otpSecretDefaultByteCount)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return otpBase32.EncodeToString(secret), nil
+}
+
+func otpDecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := otpBase32.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("OTP 密钥不是合法的 Base32: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("OTP 密钥为空")
+	}
+	return key, nil
+}
+
+// otpCode 用来按 RFC 4226 计算计数器对应的验证码。
+func (cfg otpConfig) otpCode(key []byte, counter uint64) string {
+	var newHash func() hash.Hash
+	switch cfg.algorithm {
+	case OTPAlgorithmSHA256:
+		newHash = sha256.New
+	case OTPAlgorithmSHA512:
+		newHash = sha512.New
+	default:
+		newHash = sha1.New
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(newHash, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for range cfg.digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", cfg.digits, value%mod)
+}
+
+func (cfg otpConfig) otpEqual(key []byte, counter uint64, code string) bool {
+	return subtle.ConstantTimeCompare([]byte(cfg.otpCode(key, counter)), []byte(code)) == 1
+}
+
+func (cfg otpConfig) provisioningURI(kind, account, secret string, extra url.Values) string {
+	label := account
+	if cfg.issuer != "" {
+		label = cfg.issuer + ":" + account
+	}
+	query := url.Values{}
+	query.Set("secret", secret)
+	if cfg.issuer != "" {
+		query.Set("issuer", cfg.issuer)
+	}
+	query.Set("algorithm", cfg.algorithm)
+	query.Set("digits", strconv.Itoa(cfg.digits))
+	for key, values := range extra {
+		query[key] = values
+	}
+	return (&url.URL{Scheme: "otpauth", Host: kind, Path: "/" + label, RawQuery: query.Encode()}).String()
+}
+
+func otpNormalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
+
+// HOTP 基于计数器的一次性密码（RFC 4226）。
+type HOTP struct {
+	cfg otpConfig
+}
+
+// NewHOTP 创建 HOTP。
+func NewHOTP(opts ...WithOTPOption) *HOTP {
+	return &HOTP{cfg: newOTPConfig(opts)}
+}
+
+// Code 用来计算计数器对应的验证码。
+func (h *HOTP) Code(secret string, counter uint64) (string, error) {
+	key, err := otpDecodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return h.cfg.otpCode(key, counter), nil
+}
+
+// Verify 在 counter 到 counter+LookAhead 范围内查找验证码，通过时返回下一次应使用的计数器，调用方需要保存它。
+func (h *HOTP) Verify(secret, code string, counter uint64) (uint64, bool, error) {
+	key, err := otpDecodeSecret(secret)
+	if err != nil {
+		return counter, false, err
+	}
+	code = otpNormalizeCode(code)
+	if len(code) != h.cfg.digits {
+		return counter, false, nil
+	}
+	for i := 0; i <= h.cfg.lookAhead; i++ {
+		if h.cfg.otpEqual(key, counter+uint64(i), code) {
+			return counter + uint64(i) + 1, true, nil
+		}
+	}
+	return counter, false, nil
+}
+
+// ProvisioningURI 用来生成 otpauth://hotp/ 地址，可直接转为二维码供验证器 App 扫描。
+func (h *HOTP) ProvisioningURI(account, secret string, counter uint64) string {
+	return h.cfg.provisioningURI("hotp", account, secret, url.Values{"counter": {strconv.FormatUint(counter, 10)}})
+}
+
+// TOTP 基于时间的一次性密码（RFC 6238）。
+type TOTP struct {
+	cfg otpConfig
+}
+
+// NewTOTP 创建 TOTP。
+func NewTOTP(opts ...WithOTPOption) *TOTP {
+	return &TOTP{cfg: newOTPConfig(opts)}
+}
+
+func (t *TOTP) counter(at time.Time) int64 {
+	return at.Unix() / int64(t.cfg.period/time.Second)
+}
+
+// Code 用来计算指定时间的验证码。
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := otpDecodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.cfg.otpCode(key, uint64(t.counter(at))), nil
+}
+
+// Verify 校验验证码，允许前后 Skew 个时间步的偏差，通过时返回匹配的时间步。
+func (t *TOTP) Verify(secret, code string, at time.Time) (int64, bool, error) {
+	key, err := otpDecodeSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+	code = otpNormalizeCode(code)
+	if len(code) != t.cfg.digits {
+		return 0, false, nil
+	}
+	current := t.counter(at)
+	for i := -t.cfg.skew; i <= t.cfg.skew; i++ {
+		step := current + int64(i)
+		if step >= 0 && t.cfg.otpEqual(key, uint64(step), code) {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// VerifyOnce 校验验证码并通过 InsRedis 记录已使用的时间步，同一账号的同一验证码只能使用一次。
+// account 用于区分用户，例如用户 ID。
+func (t *TOTP) VerifyOnce(ctx context.Context, account, secret, code string) (bool, error) {
+	if InsRedis == nil {
+		return false, redisClientNilErr()
+	}
+	step, ok, err := t.Verify(secret, code, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+	ttl := time.Duration(2*t.cfg.skew+2) * t.cfg.period
+	first, err := InsRedis.SetNX(ctx, t.cfg.replayPrefix+account+":"+strconv.FormatInt(step, 10), 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return first, nil
+}
+
+// ProvisioningURI 用来生成 otpauth://totp/ 地址，可直接转为二维码供验证器 App 扫描。
+func (t *TOTP) ProvisioningURI(account, secret string) string {
+	return t.cfg.provisioningURI("totp", account, secret, url.Values{"period": {strconv.Itoa(int(t.cfg.period / time.Second))}})
+}
+
+// GenerateRecoveryCodes 用来生成 n 个恢复码（默认 10 个），codes 只展示给用户一次，hashes 通过 PasswordEncryption 生成，用于落库。
+func GenerateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	if n <= 0 {
+		n = defaultRecoveryCodeCount
+	}
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	codes = make([]string, 0, n)
+	hashes = make([]string, 0, n)
+	for range n {
+		var builder strings.Builder
+		for i := range recoveryCodeHalfLength * 2 {
+			if i == recoveryCodeHalfLength {
+				builder.WriteByte('-')
+			}
+			index, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			builder.WriteByte(recoveryCodeAlphabet[index.Int64()])
+		}
+		code := builder.String()
+		hashed, err := PasswordEncryption(recoveryCodeNormalize(code))
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashed)
+	}
+	return codes, hashes, nil
+}
+
+// VerifyRecoveryCode 用来在已保存的哈希中查找恢复码，返回匹配的下标，调用方需要删除该哈希使其失效。
+// 比较时忽略大小写、空格与连字符。
+func VerifyRecoveryCode(code string, hashes []string) (int, bool) {
+	code = recoveryCodeNormalize(code)
+	if code == "" {
+		return -1, false
+	}
+	for i, hashed := range hashes {
+		if PasswordCompare(code, hashed) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func recoveryCodeNormalize(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func isMFAPending(claims map[string]interface{}) bool {
+	pending, _ := claims[JWTClaimMFAPending].(bool)
+	return pending
+}
+
+// issueMFAPending 用来签发只能用于 MFAVerifyHandler 的短期令牌，负载与正式令牌一致，不带 orig_iat，不能刷新。
+func (mw *GinJWTMiddleware) issueMFAPending(c *gin.Context, data interface{}) {
+	token := jwt.New(jwt.GetSigningMethod(mw.SigningAlgorithm))
+	claims := token.Claims.(jwt.MapClaims)
+	if mw.PayloadFunc != nil {
+		for key, value := range mw.PayloadFunc(data) {
+			claims[key] = value
+		}
+	}
+	expire := mw.TimeFunc().Add(mw.MFATimeout)
+	claims[JWTClaimMFAPending] = true
+	claims[JWTClaimMFAID] = GetUUID()
+	claims["exp"] = expire.Unix()
+
+	tokenString, err := mw.signedString(token)
+	if err != nil {
+		appError := MsgErrTokenServerInvalid("创建登陆凭证失败", err)
+		mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+		return
+	}
+	mw.MFAResponse(c, tokenString, expire)
+}
+
+// MFAVerifyHandler 用来处理二次验证请求：只接受 mfa_pending 令牌，MFAVerifier 通过后签发正式令牌并返回登录响应。
+// 令牌来源与 TokenLookup 相同，验证码由 MFAVerifier 自行从请求中读取。
+// 配置了 InsRedis 时 mfa_id 在验证通过后用 SETNX 标记为已使用（有效期 MFATimeout），同一个待验证令牌只能换取一次正式令牌。
+func (mw *GinJWTMiddleware) MFAVerifyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mw.MFAVerifier == nil {
+			appError := MsgErrTokenServerInvalid("缺少必要的函数定义")
+			mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+			return
+		}
+
+		token, err := mw.ParseToken(c)
+		if err != nil {
+			appError := MsgErrTokenServerInvalid("二次验证凭证无效请重新登录", err)
+			mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+			return
+		}
+		claims := ExtractClaimsFromToken(token)
+		if !isMFAPending(claims) {
+			appError := MsgErrTokenServerInvalid("二次验证凭证无效请重新登录")
+			mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+			return
+		}
+		if appError := mw.validateExpiration(claims); appError != nil {
+			mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+			return
+		}
+
+		if mw.MFAMaxAttempts > 0 && InsRedis != nil {
+			mfaID, _ := claims[JWTClaimMFAID].(string)
+			key := defaultMFAAttemptPrefix + mfaID
+			attempts, err := InsRedis.Incr(c, key).Result()
+			if err != nil {
+				ResponseError(c, MsgErrRedis("", err))
+				c.Abort()
+				return
+			}
+			if attempts == 1 {
+				InsRedis.Expire(c, key, mw.MFATimeout)
+			}
+			if attempts > int64(mw.MFAMaxAttempts) {
+				appError := MsgErrTokenServerInvalid("二次验证失败次数过多请重新登录")
+				mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+				return
+			}
+		}
+
+		c.Set(CtxKeyJWTPayload, claims)
+		if err = mw.MFAVerifier(c, claims); err != nil {
+			ResponseError(c, err)
+			c.Abort()
+			return
+		}
+		if InsRedis != nil {
+			mfaID, _ := claims[JWTClaimMFAID].(string)
+			ok, err := InsRedis.SetNX(c, defaultMFAConsumedPrefix+mfaID, 1, mw.MFATimeout).Result()
+			if err != nil {
+				ResponseError(c, MsgErrRedis("", err))
+				c.Abort()
+				return
+			}
+			if !ok {
+				appError := MsgErrTokenServerInvalid("二次验证凭证已使用请重新登录")
+				mw.unauthorized(c, appError.Code, mw.HTTPStatusMessageFunc(appError, c))
+				return
+			}
+		}
+
+		payload := jwt.MapClaims{}
+		for key, value := range claims {
+			switch key {
+			case JWTClaimMFAPending, JWTClaimMFAID, "exp", "orig_iat":
+			default:
+				payload[key] = value
+			}
+		}
+		mw.issueLoginToken(c, payload)
+	}
+}
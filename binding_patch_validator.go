@@ -94,7 +94,7 @@ func buildValidationStructValue(value reflect.Value) reflect.Value {
 		jsonTag := structField.Tag.Get(TagJSON)
 
 		if marker, ok := patchFieldValidationFromValue(fieldValue); ok {
-			bindingTag = patchFieldBindingTag(bindingTag, marker)
+			bindingTag = patchJSONBindingTag(patchFieldBindingTag(bindingTag, marker), marker)
 		}
 
 		fields = append(fields, reflect.StructField{
@@ -124,6 +124,9 @@ func normalizeValidationValue(value reflect.Value) any {
 		if !marker.patchFieldValidationSet() || marker.patchFieldValidationNull() {
 			return nil
 		}
+		if patch, ok := patchJSONDocumentFromMarker(marker); ok {
+			return patch
+		}
 		return normalizeValidationInterface(marker.patchFieldValidationValue())
 	}
 
@@ -0,0 +1,107 @@
+package wd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/goccy/go-yaml"
+)
+
+// patchFieldYAMLBinding 用来替换 gin 的 YAML 绑定：YAML 解码器遇到 null 时不会调用字段的 UnmarshalYAML，
+// 这里在解码后按原始文档把显式 null 标记到 Field[T] 上，再执行校验，与 JSON 绑定的行为保持一致。
+type patchFieldYAMLBinding struct{}
+
+var _ binding.BindingBody = patchFieldYAMLBinding{}
+
+type patchFieldNullSetter interface {
+	patchFieldSetNull()
+}
+
+func (patchFieldYAMLBinding) Name() string {
+	return "yaml"
+}
+
+func (b patchFieldYAMLBinding) Bind(req *http.Request, obj any) error {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	return b.BindBody(body, obj)
+}
+
+func (patchFieldYAMLBinding) BindBody(body []byte, obj any) error {
+	if err := yaml.NewDecoder(bytes.NewReader(body)).Decode(obj); err != nil {
+		return err
+	}
+
+	var tree any
+	if err := yaml.Unmarshal(body, &tree); err == nil {
+		patchFieldMarkYAMLNull(reflect.ValueOf(obj), tree)
+	}
+
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// patchFieldMarkYAMLNull 用来递归查找文档中值为 null 的键，并把对应的 Field[T] 标记为显式 null。
+func patchFieldMarkYAMLNull(value reflect.Value, tree any) {
+	value = dereferenceValidationValue(value)
+	object, ok := tree.(map[string]any)
+	if !ok || !value.IsValid() || value.Kind() != reflect.Struct || !value.CanAddr() {
+		return
+	}
+
+	valueType := value.Type()
+	for i := range value.NumField() {
+		structField := valueType.Field(i)
+		if structField.PkgPath != "" {
+			continue
+		}
+		name, inline := patchFieldYAMLName(structField)
+		if name == "-" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if inline {
+			patchFieldMarkYAMLNull(fieldValue, tree)
+			continue
+		}
+		child, exists := object[name]
+		if !exists {
+			continue
+		}
+		if setter, ok := fieldValue.Addr().Interface().(patchFieldNullSetter); ok {
+			if child == nil {
+				setter.patchFieldSetNull()
+			}
+			continue
+		}
+		patchFieldMarkYAMLNull(fieldValue, child)
+	}
+}
+
+// patchFieldYAMLName 与 go-yaml 的字段命名规则一致：优先 yaml 标签，其次 json 标签，默认字段名小写。
+func patchFieldYAMLName(structField reflect.StructField) (string, bool) {
+	tag := structField.Tag.Get("yaml")
+	if tag == "" {
+		tag = structField.Tag.Get(TagJSON)
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	inline := false
+	for _, option := range strings.Split(options, ",") {
+		if option == "inline" {
+			inline = true
+		}
+	}
+	if name == "" {
+		name = strings.ToLower(structField.Name)
+	}
+	return name, inline
+}
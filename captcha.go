@@ -0,0 +1,539 @@
+package wd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CaptchaTypeImage = "image"
+	CaptchaTypeMath  = "math"
+
+	HeaderCaptchaID     = "X-Captcha-Id"
+	HeaderCaptchaAnswer = "X-Captcha-Answer"
+
+	defaultCaptchaChars = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+)
+
+var (
+	ErrCaptchaMismatch   = errors.New("验证码错误")
+	ErrCaptchaExpired    = errors.New("验证码已过期或不存在")
+	ErrCaptchaCooldown   = errors.New("验证码发送过于频繁")
+	ErrCaptchaDailyLimit = errors.New("今日验证码发送次数已达上限")
+	ErrCaptchaLocked     = errors.New("验证码错误次数过多，已被锁定")
+
+	errCaptchaSend = errors.New("短信发送失败")
+)
+
+// InsCaptcha 是全局的验证码服务。
+var InsCaptcha *Captcha
+
+// Captcha 提供图形验证码、算术验证码与短信验证码，数据保存在 InsRedis 中。
+type Captcha struct {
+	prefix   string
+	ttl      time.Duration
+	length   int
+	width    int
+	height   int
+	chars    string
+	mathMode bool
+
+	sms           SMSSender
+	signName      string
+	templateCode  string
+	templateParam func(code string) string
+	smsLength     int
+	smsTTL        time.Duration
+	cooldown      time.Duration
+	dailyLimit    int64
+	maxAttempts   int64
+	lockout       time.Duration
+	smsNeedImage  bool
+}
+
+// CaptchaImage 是生成的图形验证码，Image 为可直接放进 img 标签的 data URI。
+type CaptchaImage struct {
+	ID    string `json:"captcha_id"`
+	Image string `json:"image"`
+	PNG   []byte `json:"-"`
+}
+
+// WithCaptchaOption 验证码服务的配置项。
+type WithCaptchaOption func(*Captcha)
+
+// WithCaptchaPrefix 设置 Redis 键前缀，默认 captcha:。
+func WithCaptchaPrefix(prefix string) WithCaptchaOption {
+	return func(c *Captcha) {
+		if prefix != "" {
+			c.prefix = prefix
+		}
+	}
+}
+
+// WithCaptchaTTL 设置图形验证码的有效期，默认 5 分钟。
+func WithCaptchaTTL(ttl time.Duration) WithCaptchaOption {
+	return func(c *Captcha) {
+		if ttl > 0 {
+			c.ttl = ttl
+		}
+	}
+}
+
+// WithCaptchaImage 设置图形验证码的字符数与图片尺寸，默认 4 位、120x40。
+func WithCaptchaImage(length, width, height int) WithCaptchaOption {
+	return func(c *Captcha) {
+		if length > 0 {
+			c.length = length
+		}
+		if width > 0 {
+			c.width = width
+		}
+		if height > 0 {
+			c.height = height
+		}
+	}
+}
+
+// WithCaptchaChars 设置图形验证码的字符集，只支持数字与大写字母，默认去掉了 0、1、I、L、O 等易混字符。
+func WithCaptchaChars(chars string) WithCaptchaOption {
+	return func(c *Captcha) {
+		chars = strings.ToUpper(chars)
+		for _, ch := range chars {
+			if _, ok := captchaGlyphs[ch]; !ok || strings.ContainsRune("+-*=?", ch) {
+				return
+			}
+		}
+		if chars != "" {
+			c.chars = chars
+		}
+	}
+}
+
+// WithCaptchaMathDefault 让 ImageHandler 默认生成算术验证码。
+func WithCaptchaMathDefault() WithCaptchaOption {
+	return func(c *Captcha) {
+		c.mathMode = true
+	}
+}
+
+// WithCaptchaSMS 设置发送短信验证码使用的服务商、签名与模板，sms 可以是 *SMSService 或 *SMSClient。
+func WithCaptchaSMS(sms SMSSender, signName, templateCode string) WithCaptchaOption {
+	return func(c *Captcha) {
+		c.sms = sms
+		c.signName = signName
+		c.templateCode = templateCode
+	}
+}
+
+// WithCaptchaSMSTemplateParam 设置短信模板参数的生成方式，默认 {"code":"123456"}。
+func WithCaptchaSMSTemplateParam(param func(code string) string) WithCaptchaOption {
+	return func(c *Captcha) {
+		if param != nil {
+			c.templateParam = param
+		}
+	}
+}
+
+// WithCaptchaSMSCode 设置短信验证码的位数与有效期，默认 6 位、5 分钟。
+func WithCaptchaSMSCode(length int, ttl time.Duration) WithCaptchaOption {
+	return func(c *Captcha) {
+		if length > 0 {
+			c.smsLength = length
+		}
+		if ttl > 0 {
+			c.smsTTL = ttl
+		}
+	}
+}
+
+// WithCaptchaSMSLimit 设置同一号码的发送间隔与每日上限，默认 60 秒、10 条。
+func WithCaptchaSMSLimit(cooldown time.Duration, dailyLimit int64) WithCaptchaOption {
+	return func(c *Captcha) {
+		if cooldown >= time.Second {
+			c.cooldown = cooldown
+		}
+		if dailyLimit > 0 {
+			c.dailyLimit = dailyLimit
+		}
+	}
+}
+
+// WithCaptchaSMSAttempts 设置短信验证码允许的错误次数与达到次数后的锁定时长，默认 5 次、15 分钟。
+func WithCaptchaSMSAttempts(maxAttempts int64, lockout time.Duration) WithCaptchaOption {
+	return func(c *Captcha) {
+		if maxAttempts > 0 {
+			c.maxAttempts = maxAttempts
+		}
+		if lockout > 0 {
+			c.lockout = lockout
+		}
+	}
+}
+
+// WithCaptchaSMSNeedImage 要求 SMSHandler 先校验图形验证码再发送短信。
+func WithCaptchaSMSNeedImage() WithCaptchaOption {
+	return func(c *Captcha) {
+		c.smsNeedImage = true
+	}
+}
+
+// NewCaptcha 创建验证码服务。
+func NewCaptcha(opts ...WithCaptchaOption) *Captcha {
+	c := &Captcha{
+		prefix:      "captcha:",
+		ttl:         5 * time.Minute,
+		length:      4,
+		width:       120,
+		height:      40,
+		chars:       defaultCaptchaChars,
+		smsLength:   6,
+		smsTTL:      5 * time.Minute,
+		cooldown:    time.Minute,
+		dailyLimit:  10,
+		maxAttempts: 5,
+		lockout:     15 * time.Minute,
+		templateParam: func(code string) string {
+			data, _ := json.Marshal(map[string]string{"code": code})
+			return string(data)
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// InitCaptcha 初始化全局验证码服务 InsCaptcha。
+func InitCaptcha(opts ...WithCaptchaOption) {
+	InsCaptcha = NewCaptcha(opts...)
+}
+
+// NewImage 生成字符图形验证码。
+func (c *Captcha) NewImage(ctx context.Context) (*CaptchaImage, error) {
+	answer, err := captchaRandomText(c.chars, c.length)
+	if err != nil {
+		return nil, err
+	}
+	return c.newImage(ctx, answer, answer)
+}
+
+// NewMath 生成算术验证码，图片内容形如 7+5=?，答案为计算结果。
+func (c *Captcha) NewMath(ctx context.Context) (*CaptchaImage, error) {
+	a, err := captchaRandomInt(1, 9)
+	if err != nil {
+		return nil, err
+	}
+	b, err := captchaRandomInt(1, 9)
+	if err != nil {
+		return nil, err
+	}
+	op, err := captchaRandomInt(0, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var text string
+	var result int
+	switch op {
+	case 0:
+		text, result = fmt.Sprintf("%d+%d=?", a, b), a+b
+	case 1:
+		a, b = max(a, b), min(a, b)
+		text, result = fmt.Sprintf("%d-%d=?", a, b), a-b
+	default:
+		text, result = fmt.Sprintf("%d*%d=?", a, b), a*b
+	}
+	return c.newImage(ctx, text, strconv.Itoa(result))
+}
+
+func (c *Captcha) newImage(ctx context.Context, text, answer string) (*CaptchaImage, error) {
+	if InsRedis == nil {
+		return nil, redisClientNilErr()
+	}
+	data, err := captchaRenderPNG(text, c.width, c.height)
+	if err != nil {
+		return nil, err
+	}
+	id := GetUUID()
+	if err := InsRedis.SetCaptcha(c.imageKey(id), answer, c.ttl); err != nil {
+		return nil, err
+	}
+	return &CaptchaImage{
+		ID:    id,
+		Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(data),
+		PNG:   data,
+	}, nil
+}
+
+// Verify 校验图形验证码，不区分大小写，无论对错都只能校验一次。
+func (c *Captcha) Verify(ctx context.Context, id, answer string) error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	if id == "" || answer == "" {
+		return ErrCaptchaMismatch
+	}
+	expected, err := InsRedis.GetDel(ctx, c.imageKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrCaptchaExpired
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), expected) {
+		return ErrCaptchaMismatch
+	}
+	return nil
+}
+
+// SendSMSCode 向手机号发送短信验证码，scene 用来区分登录、注册等场景，各场景的验证码互不影响。
+// 同一号码受发送间隔与每日上限限制，锁定期间不能发送；发送失败时会撤销本次计数。
+func (c *Captcha) SendSMSCode(ctx context.Context, scene, phone string) error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	if c.sms == nil {
+		return errors.New("未配置短信服务，需要使用 WithCaptchaSMS 设置")
+	}
+	if !ValidateChineseMobile(phone) {
+		return ErrSMSInvalidPhone
+	}
+	phone = normalizeChineseMobile(phone)
+	if err := c.checkLock(ctx, scene, phone); err != nil {
+		return err
+	}
+
+	cooldownKey := c.smsKey("cooldown", scene, phone)
+	cooldown, err := InsRedis.LuaRedisIncrWithLimit(cooldownKey, 1, 1, int64(c.cooldown/time.Second))
+	if err != nil {
+		return err
+	}
+	if !cooldown.IsSuccess {
+		ttl, _ := InsRedis.TTL(ctx, cooldownKey).Result()
+		return fmt.Errorf("%w，请 %d 秒后再试", ErrCaptchaCooldown, max(int64(ttl/time.Second), 1))
+	}
+
+	now := Now()
+	dailyKey := c.prefix + "sms-daily:" + now.Format("20060102") + ":" + phone
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	daily, err := InsRedis.LuaRedisIncrWithLimit(dailyKey, 1, c.dailyLimit, int64(endOfDay.Sub(now)/time.Second)+1)
+	if err != nil {
+		InsRedis.Del(ctx, cooldownKey)
+		return err
+	}
+	if !daily.IsSuccess {
+		return ErrCaptchaDailyLimit
+	}
+
+	rollback := func() {
+		InsRedis.Del(ctx, cooldownKey)
+		InsRedis.DecrBy(ctx, dailyKey, 1)
+	}
+	code, err := captchaRandomText("0123456789", c.smsLength)
+	if err != nil {
+		rollback()
+		return err
+	}
+	codeKey := c.smsKey("code", scene, phone)
+	if err := InsRedis.Set(ctx, codeKey, code, c.smsTTL).Err(); err != nil {
+		rollback()
+		return err
+	}
+	InsRedis.Del(ctx, c.smsKey("attempts", scene, phone))
+	if _, err := c.sms.Send(ctx, &SMSMessage{Phone: phone, SignName: c.signName, TemplateCode: c.templateCode, Params: c.templateParam(code)}); err != nil {
+		InsRedis.Del(ctx, codeKey)
+		rollback()
+		return fmt.Errorf("%w: %w", errCaptchaSend, err)
+	}
+	return nil
+}
+
+// VerifySMSCode 校验短信验证码，校验成功后验证码失效；错误次数达到上限后验证码作废并锁定该号码。
+func (c *Captcha) VerifySMSCode(ctx context.Context, scene, phone, code string) error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	phone = normalizeChineseMobile(phone)
+	if err := c.checkLock(ctx, scene, phone); err != nil {
+		return err
+	}
+
+	codeKey := c.smsKey("code", scene, phone)
+	attemptsKey := c.smsKey("attempts", scene, phone)
+	expected, err := InsRedis.Get(ctx, codeKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrCaptchaExpired
+	}
+	if err != nil {
+		return err
+	}
+
+	if code == "" || strings.TrimSpace(code) != expected {
+		attempts, err := InsRedis.Incr(ctx, attemptsKey).Result()
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			InsRedis.Expire(ctx, attemptsKey, c.smsTTL)
+		}
+		if attempts >= c.maxAttempts {
+			InsRedis.Del(ctx, codeKey, attemptsKey)
+			InsRedis.Set(ctx, c.smsKey("lock", scene, phone), 1, c.lockout)
+			return ErrCaptchaLocked
+		}
+		return ErrCaptchaMismatch
+	}
+
+	// 并发校验时只有删除成功的一方算通过
+	deleted, err := InsRedis.Del(ctx, codeKey).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrCaptchaExpired
+	}
+	InsRedis.Del(ctx, attemptsKey)
+	return nil
+}
+
+func (c *Captcha) checkLock(ctx context.Context, scene, phone string) error {
+	locked, err := InsRedis.Exists(ctx, c.smsKey("lock", scene, phone)).Result()
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return ErrCaptchaLocked
+	}
+	return nil
+}
+
+func (c *Captcha) imageKey(id string) string {
+	return c.prefix + "img:" + id
+}
+
+func (c *Captcha) smsKey(kind, scene, phone string) string {
+	return c.prefix + "sms-" + kind + ":" + scene + ":" + phone
+}
+
+// ImageHandler 返回生成图形验证码的接口，?type=math 时生成算术验证码，?type=image 时生成字符验证码。
+func (c *Captcha) ImageHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mathMode := c.mathMode
+		switch ctx.Query("type") {
+		case CaptchaTypeMath:
+			mathMode = true
+		case CaptchaTypeImage:
+			mathMode = false
+		}
+
+		var img *CaptchaImage
+		var err error
+		if mathMode {
+			img, err = c.NewMath(ctx)
+		} else {
+			img, err = c.NewImage(ctx)
+		}
+		if err != nil {
+			ResponseError(ctx, MsgErrServerBusy("验证码生成失败", err))
+			return
+		}
+		ResponseSuccess(ctx, img)
+	}
+}
+
+// CaptchaSMSRequest 是 SMSHandler 的请求参数。
+type CaptchaSMSRequest struct {
+	Phone         string `json:"phone" form:"phone"`
+	CaptchaID     string `json:"captcha_id" form:"captcha_id"`
+	CaptchaAnswer string `json:"captcha_answer" form:"captcha_answer"`
+}
+
+// SMSHandler 返回发送短信验证码的接口，scene 为该路由对应的场景，例如 login、register。
+func (c *Captcha) SMSHandler(scene string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req CaptchaSMSRequest
+		if err := ctx.ShouldBind(&req); err != nil {
+			ResponseError(ctx, MsgErrInvalidParam(err))
+			return
+		}
+		if !ValidateChineseMobile(req.Phone) {
+			ResponseError(ctx, MsgErrBadRequest("手机号格式不正确"))
+			return
+		}
+		if c.smsNeedImage {
+			if err := c.Verify(ctx, req.CaptchaID, req.CaptchaAnswer); err != nil {
+				ResponseError(ctx, captchaAppError(err))
+				return
+			}
+		}
+		if err := c.SendSMSCode(ctx, scene, req.Phone); err != nil {
+			ResponseError(ctx, captchaAppError(err))
+			return
+		}
+		ResponseSuccess(ctx, gin.H{"expire_seconds": int64(c.smsTTL / time.Second)})
+	}
+}
+
+// MiddlewareCaptcha 用来在接口前校验图形验证码，从 X-Captcha-Id、X-Captcha-Answer 请求头读取，
+// 请求头不存在时读取 captcha_id、captcha_answer 查询参数。
+func (c *Captcha) MiddlewareCaptcha() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(HeaderCaptchaID)
+		answer := ctx.GetHeader(HeaderCaptchaAnswer)
+		if id == "" {
+			id = ctx.Query("captcha_id")
+			answer = ctx.Query("captcha_answer")
+		}
+		if err := c.Verify(ctx, id, answer); err != nil {
+			ResponseError(ctx, captchaAppError(err))
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func captchaAppError(err error) *AppError {
+	switch {
+	case errors.Is(err, ErrCaptchaMismatch), errors.Is(err, ErrCaptchaExpired),
+		errors.Is(err, ErrCaptchaCooldown), errors.Is(err, ErrCaptchaDailyLimit),
+		errors.Is(err, ErrCaptchaLocked), errors.Is(err, ErrSMSInvalidPhone):
+		return MsgErrBadRequest(err.Error())
+	case errors.Is(err, errCaptchaSend):
+		return MsgErrRequestExternalService("验证码发送失败", err)
+	default:
+		return MsgErrRedis("", err)
+	}
+}
+
+func captchaRandomText(chars string, length int) (string, error) {
+	alphabet := []rune(chars)
+	var sb strings.Builder
+	for range length {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(alphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+func captchaRandomInt(lo, hi int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi-lo+1)))
+	if err != nil {
+		return 0, err
+	}
+	return lo + int(n.Int64()), nil
+}
@@ -0,0 +1,162 @@
+package wd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+)
+
+// captchaGlyphs 是验证码使用的 5x7 点阵字体，* 表示乘号。
+var captchaGlyphs = map[rune][7]string{
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"###..", "#..#.", "#...#", "#...#", "#...#", "#..#.", "###.."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'+': {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'*': {".....", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "....."},
+	'=': {".....", ".....", "#####", ".....", "#####", ".....", "....."},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+}
+
+// captchaRenderPNG 用来把文本绘制成带干扰线和噪点的 PNG 图片。
+func captchaRenderPNG(text string, width, height int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := color.RGBA{R: uint8(225 + rand.IntN(30)), G: uint8(225 + rand.IntN(30)), B: uint8(225 + rand.IntN(30)), A: 255}
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, background)
+		}
+	}
+
+	runes := []rune(text)
+	scale := min(height*7/10/7, width/(len(runes)*6+2))
+	scale = max(scale, 1)
+	textWidth := len(runes) * 6 * scale
+	left := (width - textWidth) / 2
+	top := (height - 7*scale) / 2
+
+	for i, char := range runes {
+		glyph, ok := captchaGlyphs[char]
+		if !ok {
+			continue
+		}
+		ink := captchaRandomInk()
+		x0 := left + i*6*scale + rand.IntN(scale+1) - scale/2
+		y0 := top + rand.IntN(scale+1) - scale/2
+		shear := (rand.Float64() - 0.5) * 0.6
+		for row, line := range glyph {
+			offset := int(math.Round(float64(row-3) * shear * float64(scale)))
+			for col, dot := range line {
+				if dot != '#' {
+					continue
+				}
+				captchaFillRect(img, x0+col*scale+offset, y0+row*scale, scale, scale, ink)
+			}
+		}
+	}
+
+	for range 4 {
+		captchaLine(img, rand.IntN(width), rand.IntN(height), rand.IntN(width), rand.IntN(height), captchaRandomInk())
+	}
+	amplitude := float64(height) / 6
+	period := float64(width) / (1 + rand.Float64())
+	phase := rand.Float64() * 2 * math.Pi
+	curve := captchaRandomInk()
+	for x := range width {
+		y := height/2 + int(amplitude*math.Sin(2*math.Pi*float64(x)/period+phase))
+		captchaFillRect(img, x, y, 1, max(scale/3, 1), curve)
+	}
+	for range width * height / 25 {
+		img.SetRGBA(rand.IntN(width), rand.IntN(height), captchaRandomInk())
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func captchaRandomInk() color.RGBA {
+	return color.RGBA{R: uint8(rand.IntN(150)), G: uint8(rand.IntN(150)), B: uint8(rand.IntN(150)), A: 255}
+}
+
+func captchaFillRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	bounds := img.Bounds()
+	for dy := range h {
+		for dx := range w {
+			if (image.Point{X: x + dx, Y: y + dy}).In(bounds) {
+				img.SetRGBA(x+dx, y+dy, c)
+			}
+		}
+	}
+}
+
+// captchaLine 使用 Bresenham 算法画干扰线。
+func captchaLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := captchaAbs(x1-x0), -captchaAbs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func captchaAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
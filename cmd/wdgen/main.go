@@ -0,0 +1,333 @@
+// wdgen 根据 YAML 配置连接数据库并运行 wd.GormClient.Gen 生成 gorm/gen 代码。
+//
+// 用法：
+//
+//	wdgen -config wdgen.yaml          生成代码
+//	wdgen -config wdgen.yaml -check   检查生成代码是否最新，不一致时退出码为 1
+//
+// 配置文件中可以使用 ${ENV} 引用环境变量，环境变量 WDGEN_DSN 或 -dsn 参数会覆盖 database.dsn。
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/loveyu233/wd"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const defaultOutPath = "gen/query"
+
+type genConfig struct {
+	Database struct {
+		Dialect  string         `yaml:"dialect"`
+		DSN      string         `yaml:"dsn"`
+		Host     string         `yaml:"host"`
+		Port     int            `yaml:"port"`
+		Username string         `yaml:"username"`
+		Password string         `yaml:"password"`
+		Database string         `yaml:"database"`
+		Params   map[string]any `yaml:"params"`
+	} `yaml:"database"`
+
+	Out              string                    `yaml:"out"`
+	DTO              string                    `yaml:"dto"`
+	Tables           []string                  `yaml:"tables"`
+	DeletedFieldShow bool                      `yaml:"deleted_field_show"`
+	JSONTags         map[string]string         `yaml:"json_tags"`
+	Datatypes        bool                      `yaml:"datatypes"`
+	TypeMapping      map[string]string         `yaml:"type_mapping"`
+	JSONSliceColumns map[string]string         `yaml:"json_slice_columns"`
+	JSONColumns      map[string]string         `yaml:"json_columns"`
+	Columns          []genFieldType            `yaml:"columns"`
+	TableColumns     map[string][]genFieldType `yaml:"table_columns"`
+}
+
+type genFieldType struct {
+	Column string            `yaml:"column"`
+	Type   string            `yaml:"type"`
+	JSON   bool              `yaml:"json"`
+	Tags   map[string]string `yaml:"tags"`
+}
+
+func main() {
+	configPath := flag.String("config", "wdgen.yaml", "配置文件路径")
+	dsn := flag.String("dsn", "", "数据库 DSN，覆盖配置文件")
+	check := flag.Bool("check", false, "只检查生成代码是否最新，不修改文件")
+	flag.Parse()
+
+	if err := run(*configPath, *dsn, *check); err != nil {
+		fmt.Fprintln(os.Stderr, "wdgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath, dsn string, check bool) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if envDSN := os.Getenv("WDGEN_DSN"); envDSN != "" {
+		cfg.Database.DSN = envDSN
+	}
+	if dsn != "" {
+		cfg.Database.DSN = dsn
+	}
+
+	err = wd.InitGormDB(wd.GormConnConfig{
+		Dialect:  wd.GormDialect(cfg.Database.Dialect),
+		DSN:      cfg.Database.DSN,
+		Host:     cfg.Database.Host,
+		Port:     cfg.Database.Port,
+		Username: cfg.Database.Username,
+		Password: cfg.Database.Password,
+		Database: cfg.Database.Database,
+		Params:   cfg.Database.Params,
+	}, logger.Default.LogMode(logger.Warn))
+	if err != nil {
+		return fmt.Errorf("连接数据库失败: %w", err)
+	}
+
+	if !check {
+		return generate(cfg)
+	}
+	return checkGenerated(cfg)
+}
+
+// checkGenerated 把代码生成到当前目录下的临时目录，与已有文件比较后删除临时目录，不修改已有文件。
+// 临时目录需要位于同一个 Go 模块内，生成的 import 路径在比较前还原为正式目录的路径。
+func checkGenerated(cfg *genConfig) error {
+	dirs := []string{cfg.Out, filepath.Join(filepath.Dir(cfg.Out), "model")}
+	if cfg.DTO != "" {
+		dirs = append(dirs, cfg.DTO)
+	}
+	for i, dir := range dirs {
+		rel, err := relativeDir(dir)
+		if err != nil {
+			return err
+		}
+		dirs[i] = rel
+	}
+
+	tmp, err := os.MkdirTemp(".", "wdgen-check-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	stop := removeOnInterrupt(tmp)
+	defer stop()
+
+	tmpCfg := *cfg
+	tmpCfg.Out = filepath.Join(tmp, dirs[0])
+	if cfg.DTO != "" {
+		tmpCfg.DTO = filepath.Join(tmp, dirs[2])
+	}
+	if err = generate(&tmpCfg); err != nil {
+		return err
+	}
+
+	before, err := snapshotDirs(".", dirs, nil)
+	if err != nil {
+		return err
+	}
+	after, err := snapshotDirs(tmp, dirs, []byte("/"+filepath.Base(tmp)+"/"))
+	if err != nil {
+		return err
+	}
+	changed := diffSnapshots(before, after)
+	if len(changed) == 0 {
+		fmt.Println("wdgen: 生成代码已是最新")
+		return nil
+	}
+	for _, file := range changed {
+		fmt.Fprintln(os.Stderr, "  out of date:", file)
+	}
+	return fmt.Errorf("%d 个生成文件不是最新，请重新运行 wdgen", len(changed))
+}
+
+// relativeDir 用来把输出目录转换为相对当前目录的路径，检查模式只支持当前目录下的输出目录。
+func relativeDir(dir string) (string, error) {
+	if filepath.IsAbs(dir) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		if dir, err = filepath.Rel(cwd, dir); err != nil {
+			return "", err
+		}
+	}
+	dir = filepath.Clean(dir)
+	if dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("检查模式要求输出目录 %s 位于当前目录下", dir)
+	}
+	return dir, nil
+}
+
+// removeOnInterrupt 用来在收到中断信号时删除临时目录后退出，返回的函数用来取消监听。
+func removeOnInterrupt(dir string) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			_ = os.RemoveAll(dir)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func loadConfig(path string) (*genConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	cfg := new(genConfig)
+	if err = yaml.Unmarshal([]byte(os.ExpandEnv(string(content))), cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if cfg.Out == "" {
+		cfg.Out = defaultOutPath
+	}
+	return cfg, nil
+}
+
+// generate 把配置转换为 WithGen* 选项并运行生成，Gen 内部出错会 panic，这里转换为 error。
+func generate(cfg *genConfig) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("生成失败: %v", r)
+		}
+	}()
+
+	opts := []wd.WithGenConfig{
+		wd.WithGenOutFilePath(cfg.Out),
+		wd.WithGenDeletedFieldIsShow(cfg.DeletedFieldShow),
+	}
+	if cfg.DTO != "" {
+		opts = append(opts, wd.WithGenDTO(cfg.DTO))
+	}
+	if len(cfg.Tables) > 0 {
+		opts = append(opts, wd.WithGenUseTablesName(cfg.Tables...))
+	}
+	if len(cfg.JSONTags) > 0 {
+		opts = append(opts, wd.WithGenGlobalCustomJsonTag(cfg.JSONTags))
+	}
+	if cfg.Datatypes {
+		opts = append(opts, wd.WithGenGlobalColumnTypeAddDatatypes())
+	}
+	if len(cfg.TypeMapping) > 0 {
+		mapping := make(map[string]func(gorm.ColumnType) string, len(cfg.TypeMapping))
+		for dbType, goType := range cfg.TypeMapping {
+			mapping[dbType] = func(columnType gorm.ColumnType) string {
+				if nullable, ok := columnType.Nullable(); ok && nullable {
+					return "*" + goType
+				}
+				return goType
+			}
+		}
+		opts = append(opts, wd.WithGenGlobalColumnType(mapping))
+	}
+	for _, column := range sortedKeys(cfg.JSONSliceColumns) {
+		opts = append(opts, wd.WithGenGlobalSimpleColumnTypeAddJsonSliceType(column, cfg.JSONSliceColumns[column]))
+	}
+	for _, column := range sortedKeys(cfg.JSONColumns) {
+		opts = append(opts, wd.WithGenGlobalSimpleColumnTypeAddJsonType(column, cfg.JSONColumns[column]))
+	}
+	if len(cfg.Columns) > 0 {
+		opts = append(opts, wd.WithGenGlobalSimpleColumnType(toGenFieldTypes(cfg.Columns)))
+	}
+	if len(cfg.TableColumns) > 0 {
+		tableColumns := make(map[string][]wd.GenFieldType, len(cfg.TableColumns))
+		for table, columns := range cfg.TableColumns {
+			tableColumns[table] = toGenFieldTypes(columns)
+		}
+		opts = append(opts, wd.WithGenTableColumnType(tableColumns))
+	}
+
+	wd.InsDB.Gen(opts...)
+	return nil
+}
+
+func toGenFieldTypes(columns []genFieldType) []wd.GenFieldType {
+	fields := make([]wd.GenFieldType, 0, len(columns))
+	for _, column := range columns {
+		fields = append(fields, wd.GenFieldType{
+			ColumnName:       column.Column,
+			ColumnType:       column.Type,
+			IsJsonStatusType: column.JSON,
+			Tags:             column.Tags,
+		})
+	}
+	return fields
+}
+
+// snapshotDirs 读取 root 下各目录的全部文件内容，以相对 root 的路径为键，目录不存在时视为空。
+// tmpPath 不为空时把内容中的临时目录路径片段替换为 "/"，用于还原生成代码中的 import 路径。
+func snapshotDirs(root string, dirs []string, tmpPath []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			content, err := os.ReadFile(filepath.Join(root, path))
+			if err != nil {
+				return nil, err
+			}
+			if len(tmpPath) > 0 {
+				content = bytes.ReplaceAll(content, tmpPath, []byte("/"))
+			}
+			files[path] = content
+		}
+	}
+	return files, nil
+}
+
+func diffSnapshots(before, after map[string][]byte) []string {
+	var changed []string
+	for path, content := range after {
+		if old, ok := before[path]; !ok || !bytes.Equal(old, content) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
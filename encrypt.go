@@ -6,11 +6,11 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
+	"strconv"
 	"time"
 	"unicode"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type EncryptedResponse struct {
@@ -19,8 +19,8 @@ type EncryptedResponse struct {
 	Nonce     string `json:"nonce"`     // 随机数，增加安全性
 }
 
-// encryptAESGCM 用来使用 AES-GCM 加密明文并返回 Base64 文本。
-func encryptAESGCM(plaintext []byte, key []byte) (string, error) {
+// encryptAESGCM 用来使用 AES-GCM 加密明文并返回 Base64 文本，aad 为附加认证数据，解密时必须一致。
+func encryptAESGCM(plaintext []byte, key []byte, aad []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -36,10 +36,33 @@ func encryptAESGCM(plaintext []byte, key []byte) (string, error) {
 		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, aad)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
+// decryptAESGCM 用来解密 encryptAESGCM 生成的 Base64 文本。
+func decryptAESGCM(text string, key []byte, aad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("密文长度不足")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
 // EncryptData 用来序列化数据并返回加密后的响应体。
 func EncryptData(data any, custom func(now int64) (key, nonce string)) (*EncryptedResponse, error) {
 	jsonData, err := json.Marshal(data)
@@ -51,7 +74,7 @@ func EncryptData(data any, custom func(now int64) (key, nonce string)) (*Encrypt
 	key, nonce := custom(now)
 
 	// 加密数据
-	encryptedData, err := encryptAESGCM(jsonData, []byte(key))
+	encryptedData, err := encryptAESGCM(jsonData, []byte(key), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -63,52 +86,112 @@ func EncryptData(data any, custom func(now int64) (key, nonce string)) (*Encrypt
 	}, nil
 }
 
-// PasswordEncryption 用来对明文密码进行 bcrypt 加密。
-func PasswordEncryption(password string) (string, error) {
-	fromPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// DecryptData 用来解密 EncryptData 生成的数据并反序列化到 dest，key 需要与加密时一致。
+func DecryptData(encrypted *EncryptedResponse, key string, dest any) error {
+	if encrypted == nil {
+		return errors.New("加密数据为空")
+	}
+	plaintext, err := decryptAESGCM(encrypted.Data, []byte(key), nil)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(fromPassword), nil
+	return json.Unmarshal(plaintext, dest)
 }
 
-// PasswordCompare 用来对比明文密码和 bcrypt 哈希值是否匹配。
-func PasswordCompare(password, hashedPassword string) bool {
-	if password == "" || hashedPassword == "" {
-		return false
+// EncryptRequestData 与 EncryptData 相同，但把 "时间戳|随机数" 作为 AES-GCM 的附加认证数据，
+// 时间戳与随机数被篡改时无法解密，MiddlewareSecureRequest 解密请求体时要求使用这种格式。
+func EncryptRequestData(data any, custom func(now int64) (key, nonce string)) (*EncryptedResponse, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
 	}
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+
+	now := time.Now().Unix()
+	key, nonce := custom(now)
+	encryptedData, err := encryptAESGCM(jsonData, []byte(key), encryptedRequestAAD(now, nonce))
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedResponse{
+		Data:      encryptedData,
+		Timestamp: now,
+		Nonce:     nonce,
+	}, nil
+}
+
+// DecryptRequestData 用来解密 EncryptRequestData 生成的数据并反序列化到 dest。
+func DecryptRequestData(encrypted *EncryptedResponse, key string, dest any) error {
+	if encrypted == nil {
+		return errors.New("加密数据为空")
+	}
+	plaintext, err := decryptAESGCM(encrypted.Data, []byte(key), encryptedRequestAAD(encrypted.Timestamp, encrypted.Nonce))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, dest)
+}
+
+func encryptedRequestAAD(timestamp int64, nonce string) []byte {
+	return []byte(strconv.FormatInt(timestamp, 10) + "|" + nonce)
+}
+
+// PasswordEncryption 用来使用 InsPasswordHasher 对明文密码进行哈希，未设置时使用 bcrypt。
+func PasswordEncryption(password string) (string, error) {
+	return currentPasswordHasher().Hash(password)
+}
+
+// PasswordCompare 用来对比明文密码和哈希值是否匹配，支持 bcrypt、argon2id、scrypt 格式，需要判断是否升级哈希时使用 PasswordVerify。
+func PasswordCompare(password, hashedPassword string) bool {
+	ok, _, _ := PasswordVerify(password, hashedPassword)
+	return ok
 }
 
-// PasswordValidateStrength 用来检测密码的长度和复杂度是否合规。
+// PasswordValidateStrength 用来检测密码的长度和复杂度是否合规，长度按字符数计算。
 func PasswordValidateStrength(password string, minLen, maxLen int) bool {
-	if len(password) < minLen || len(password) > maxLen {
+	stats := analyzePassword(password)
+	if stats.length < minLen || stats.length > maxLen || stats.space {
 		return false
 	}
+	return stats.classes() == 4
+}
 
-	var (
-		hasUpper   bool
-		hasLower   bool
-		hasDigit   bool
-		hasSpecial bool
-	)
+// passwordStats 是密码的长度与字符类别统计，长度按字符（rune）计算，供 PasswordValidateStrength 与 PasswordPolicy 共用。
+type passwordStats struct {
+	length  int
+	upper   bool
+	lower   bool
+	digit   bool
+	special bool
+	space   bool
+}
 
+func analyzePassword(password string) passwordStats {
+	var stats passwordStats
 	for _, char := range password {
-		if char == ' ' { // 如果包含空格，直接返回 false
-			return false
-		}
-
+		stats.length++
 		switch {
+		case char == ' ':
+			stats.space = true
 		case unicode.IsUpper(char):
-			hasUpper = true
+			stats.upper = true
 		case unicode.IsLower(char):
-			hasLower = true
+			stats.lower = true
 		case unicode.IsDigit(char):
-			hasDigit = true
+			stats.digit = true
 		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecial = true
+			stats.special = true
 		}
 	}
+	return stats
+}
 
-	return hasUpper && hasLower && hasDigit && hasSpecial
+// classes 返回包含的字符类别数：大写字母、小写字母、数字、特殊字符。
+func (s passwordStats) classes() int {
+	classes := 0
+	for _, has := range []bool{s.upper, s.lower, s.digit, s.special} {
+		if has {
+			classes++
+		}
+	}
+	return classes
 }
@@ -0,0 +1,903 @@
+package wd
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/go-redsync/redsync/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	encryptedPrefix          = "enc:"
+	encryptedBlindTag        = "blind"
+	defaultReEncryptBatch    = 200
+	defaultReEncryptLockKey  = "reencrypt-job-lock"
+	defaultReEncryptInterval = time.Hour
+)
+
+var InsKeyring *Keyring
+
+// Keyring 保存字段加密使用的 AES 密钥与盲索引使用的 HMAC 密钥。
+// 每把密钥有一个 ID，新数据总是用主密钥加密，旧密钥保留用于解密，轮换时新增密钥并切换主密钥即可。
+type Keyring struct {
+	mu        sync.RWMutex
+	keys      map[string][]byte
+	primaryID string
+	indexKey  []byte
+}
+
+type WithKeyringOption func(*Keyring)
+
+// WithKeyringKey 添加一把 AES 密钥，长度必须为 16、24 或 32 字节，ID 不能包含冒号。
+func WithKeyringKey(id string, key []byte) WithKeyringOption {
+	return func(k *Keyring) {
+		k.keys[id] = append([]byte(nil), key...)
+	}
+}
+
+// WithKeyringPrimary 设置用于加密新数据的主密钥 ID，只有一把密钥时可以省略。
+func WithKeyringPrimary(id string) WithKeyringOption {
+	return func(k *Keyring) {
+		k.primaryID = id
+	}
+}
+
+// WithKeyringBlindIndexKey 设置盲索引使用的 HMAC 密钥，轮换加密密钥时不要修改它，否则已有的盲索引全部失效。
+func WithKeyringBlindIndexKey(key []byte) WithKeyringOption {
+	return func(k *Keyring) {
+		k.indexKey = append([]byte(nil), key...)
+	}
+}
+
+// NewKeyring 创建密钥环并校验密钥。
+func NewKeyring(opts ...WithKeyringOption) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte)}
+	for _, opt := range opts {
+		opt(k)
+	}
+	for id, key := range k.keys {
+		if err := keyringCheckKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if k.primaryID == "" && len(k.keys) == 1 {
+		for id := range k.keys {
+			k.primaryID = id
+		}
+	}
+	if k.primaryID == "" {
+		return nil, errors.New("未设置主密钥 ID")
+	}
+	if _, ok := k.keys[k.primaryID]; !ok {
+		return nil, fmt.Errorf("主密钥 %s 不存在", k.primaryID)
+	}
+	return k, nil
+}
+
+// InitKeyring 创建密钥环并赋值给 InsKeyring，Encrypted 与 BlindIndex 默认使用它。
+func InitKeyring(opts ...WithKeyringOption) error {
+	k, err := NewKeyring(opts...)
+	if err != nil {
+		return err
+	}
+	InsKeyring = k
+	return nil
+}
+
+func keyringCheckKey(id string, key []byte) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("密钥 ID %q 不合法，不能为空或包含冒号", id)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("密钥 %s 长度为 %d，必须为 16、24 或 32 字节", id, len(key))
+	}
+}
+
+func keyringNilErr() error {
+	return errors.New("InsKeyring为空,需要先使用InitKeyring()进行初始化")
+}
+
+// AddKey 运行时添加一把密钥，已存在同 ID 的密钥时返回错误。
+func (k *Keyring) AddKey(id string, key []byte) error {
+	if err := keyringCheckKey(id, key); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("密钥 %s 已存在", id)
+	}
+	k.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetPrimary 切换主密钥，之后写入的数据使用新密钥加密，旧数据可以通过 ReEncryptJob 重新加密。
+func (k *Keyring) SetPrimary(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("密钥 %s 不存在", id)
+	}
+	k.primaryID = id
+	return nil
+}
+
+// PrimaryKeyID 返回当前主密钥 ID。
+func (k *Keyring) PrimaryKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primaryID
+}
+
+// Encrypt 用主密钥加密明文，返回 enc:<密钥ID>:<Base64(nonce|密文)>，密钥 ID 同时作为附加认证数据。
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	k.mu.RLock()
+	id, key := k.primaryID, k.keys[k.primaryID]
+	k.mu.RUnlock()
+
+	gcm, err := keyringGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, []byte(id))
+	return encryptedPrefix + id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt 解密 Encrypt 的结果并返回明文与加密时使用的密钥 ID。
+// 没有 enc: 前缀的内容视为加密改造前遗留的明文，原样返回且密钥 ID 为空。
+func (k *Keyring) Decrypt(text string) ([]byte, string, error) {
+	rest, ok := strings.CutPrefix(text, encryptedPrefix)
+	if !ok {
+		return []byte(text), "", nil
+	}
+	id, payload, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, "", errors.New("密文格式不正确")
+	}
+	k.mu.RLock()
+	key, exists := k.keys[id]
+	k.mu.RUnlock()
+	if !exists {
+		return nil, id, fmt.Errorf("密钥 %s 不存在", id)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, id, fmt.Errorf("密文格式不正确: %w", err)
+	}
+	gcm, err := keyringGCM(key)
+	if err != nil {
+		return nil, id, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, id, errors.New("密文长度不足")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, id, fmt.Errorf("使用密钥 %s 解密失败: %w", id, err)
+	}
+	return plaintext, id, nil
+}
+
+// BlindIndex 计算明文的 HMAC-SHA256 并以十六进制返回，用于密文列的等值查询。
+func (k *Keyring) BlindIndex(plaintext []byte) (string, error) {
+	k.mu.RLock()
+	key := k.indexKey
+	k.mu.RUnlock()
+	if len(key) == 0 {
+		return "", errors.New("未设置盲索引密钥，需要使用WithKeyringBlindIndexKey()设置")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(plaintext)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func keyringGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+const encryptedRedactedValue = "******"
+
+// isEncryptedValue 判断 v 是否为加密列的值，包括非 nil 的 *Encrypted[T]。
+func isEncryptedValue(v any) bool {
+	if _, ok := v.(encryptedColumn); !ok {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() != reflect.Pointer || !rv.IsNil()
+}
+
+// encryptedColumn 由 Encrypted 实现，供盲索引回调与 ReEncryptJob 识别加密列。
+type encryptedColumn interface {
+	encryptedPlaintext() ([]byte, error)
+	encryptedKeyID() (string, bool)
+	encryptedRaw() (string, bool)
+}
+
+// Encrypted 是落库时自动加密、读取时自动解密的列类型，列类型为 text。
+// string 与 []byte 直接加密原始内容，其它类型先编码为 JSON；可以为空的列使用 *Encrypted[T]。
+type Encrypted[T any] struct {
+	Val    T
+	keyID  string
+	raw    string
+	stored bool
+}
+
+// NewEncrypted 用来创建加密列的值。
+func NewEncrypted[T any](v T) Encrypted[T] {
+	return Encrypted[T]{Val: v}
+}
+
+// Get 返回明文。
+func (e Encrypted[T]) Get() T {
+	return e.Val
+}
+
+// KeyID 返回读取时密文使用的密钥 ID，遗留明文或未从数据库读取时为空。
+func (e Encrypted[T]) KeyID() string {
+	return e.keyID
+}
+
+// BlindIndex 使用 InsKeyring 计算明文的盲索引。
+func (e Encrypted[T]) BlindIndex() (BlindIndex, error) {
+	return BlindIndexOf(e.Val)
+}
+
+// Value 实现 driver.Valuer，使用 InsKeyring 的主密钥加密。
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	if InsKeyring == nil {
+		return nil, keyringNilErr()
+	}
+	plaintext, err := e.encryptedPlaintext()
+	if err != nil {
+		return nil, err
+	}
+	return InsKeyring.Encrypt(plaintext)
+}
+
+// Scan 实现 sql.Scanner，使用 InsKeyring 按密文中的密钥 ID 解密。
+func (e *Encrypted[T]) Scan(src any) error {
+	var zero T
+	e.Val, e.keyID, e.raw, e.stored = zero, "", "", false
+	var text string
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("无法将 %T 扫描为加密列", src)
+	}
+	if InsKeyring == nil {
+		return keyringNilErr()
+	}
+	plaintext, keyID, err := InsKeyring.Decrypt(text)
+	if err != nil {
+		return err
+	}
+	if err = encryptedDecode(plaintext, &e.Val); err != nil {
+		return err
+	}
+	e.keyID, e.raw, e.stored = keyID, text, true
+	return nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface。
+func (Encrypted[T]) GormDataType() string {
+	return "text"
+}
+
+// String 实现 fmt.Stringer，只输出占位符，避免 fmt、日志与 %v 打印出明文。
+func (e Encrypted[T]) String() string {
+	return encryptedRedactedValue
+}
+
+// GoString 实现 fmt.GoStringer，%#v 同样只输出占位符。
+func (e Encrypted[T]) GoString() string {
+	return encryptedRedactedValue
+}
+
+// MarshalJSON 输出明文，用于接口请求与响应的往返。
+// 注意：任何 json.Marshal（包括日志、审计、缓存）都会得到明文，需要脱敏的场景请在序列化前转换为 DTO 或使用 String。
+func (e Encrypted[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Val)
+}
+
+// UnmarshalJSON 从明文 JSON 读取。
+func (e *Encrypted[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.Val)
+}
+
+func (e Encrypted[T]) encryptedPlaintext() ([]byte, error) {
+	return encryptedEncode(e.Val)
+}
+
+func (e Encrypted[T]) encryptedKeyID() (string, bool) {
+	return e.keyID, e.stored
+}
+
+// encryptedRaw 返回读取时库中的原始内容，列为 NULL 或未从数据库读取时返回 false。
+func (e Encrypted[T]) encryptedRaw() (string, bool) {
+	return e.raw, e.stored
+}
+
+func encryptedEncode(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid():
+		return []byte("null"), nil
+	case rv.Kind() == reflect.String:
+		return []byte(rv.String()), nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		return append([]byte(nil), rv.Bytes()...), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func encryptedDecode(data []byte, dest any) error {
+	rv := reflect.ValueOf(dest).Elem()
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(string(data))
+		return nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		rv.SetBytes(append([]byte(nil), data...))
+		return nil
+	default:
+		return json.Unmarshal(data, dest)
+	}
+}
+
+// BlindIndex 是加密列的盲索引列类型，通过 blind 标签指定来源字段，例如：
+//
+//	Phone      wd.Encrypted[string]
+//	PhoneIndex wd.BlindIndex `gorm:"size:64;index" blind:"Phone"`
+//
+// 注册 EncryptPlugin 后创建与更新时自动填充，查询时使用 Where("phone_index = ?", wd.MustBlindIndexOf(phone))。
+type BlindIndex string
+
+// BlindIndexOf 使用 InsKeyring 计算值的盲索引，编码规则与 Encrypted 相同。
+func BlindIndexOf[T any](v T) (BlindIndex, error) {
+	if InsKeyring == nil {
+		return "", keyringNilErr()
+	}
+	plaintext, err := encryptedEncode(v)
+	if err != nil {
+		return "", err
+	}
+	index, err := InsKeyring.BlindIndex(plaintext)
+	return BlindIndex(index), err
+}
+
+// MustBlindIndexOf 与 BlindIndexOf 相同，出错时 panic。
+func MustBlindIndexOf[T any](v T) BlindIndex {
+	index, err := BlindIndexOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+// Value 实现 driver.Valuer，空值写入 NULL，便于在盲索引列上建唯一索引。
+func (b BlindIndex) Value() (driver.Value, error) {
+	if b == "" {
+		return nil, nil
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner。
+func (b *BlindIndex) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*b = ""
+	case string:
+		*b = BlindIndex(v)
+	case []byte:
+		*b = BlindIndex(v)
+	default:
+		return fmt.Errorf("无法将 %T 扫描为盲索引", src)
+	}
+	return nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface。
+func (BlindIndex) GormDataType() string {
+	return "string"
+}
+
+// encryptedBlindField 描述一个盲索引列与它的来源加密列。
+type encryptedBlindField struct {
+	index  *schema.Field
+	source *schema.Field
+}
+
+var encryptedColumnType = reflect.TypeOf((*encryptedColumn)(nil)).Elem()
+
+func encryptedIsColumn(field *schema.Field) bool {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.PointerTo(t).Implements(encryptedColumnType)
+}
+
+func encryptedBlindFields(s *schema.Schema) ([]encryptedBlindField, error) {
+	var fields []encryptedBlindField
+	for _, field := range s.Fields {
+		name := field.Tag.Get(encryptedBlindTag)
+		if name == "" || field.DBName == "" {
+			continue
+		}
+		source := s.LookUpField(name)
+		if source == nil || !encryptedIsColumn(source) {
+			return nil, fmt.Errorf("%s.%s 的 blind 标签指向的 %s 不是加密列", s.Name, field.Name, name)
+		}
+		fields = append(fields, encryptedBlindField{index: field, source: source})
+	}
+	return fields, nil
+}
+
+// encryptedBlindValue 用来根据来源字段的值计算盲索引，值为 nil 时返回 nil。
+func encryptedBlindValue(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	column, ok := rv.Interface().(encryptedColumn)
+	if !ok {
+		return nil, fmt.Errorf("盲索引来源的值类型 %T 不是加密列", value)
+	}
+	if InsKeyring == nil {
+		return nil, keyringNilErr()
+	}
+	plaintext, err := column.encryptedPlaintext()
+	if err != nil {
+		return nil, err
+	}
+	index, err := InsKeyring.BlindIndex(plaintext)
+	return BlindIndex(index), err
+}
+
+// EncryptPlugin 在创建与更新时根据 blind 标签自动填充盲索引列。
+type EncryptPlugin struct{}
+
+// NewEncryptPlugin 创建加密列插件。
+func NewEncryptPlugin() *EncryptPlugin {
+	return &EncryptPlugin{}
+}
+
+// UseEncrypt 返回可传给 InitGormDB 的初始化函数，用于在初始化时注册加密列插件。
+func UseEncrypt() func(db *gorm.DB) error {
+	return func(db *gorm.DB) error {
+		return db.Use(NewEncryptPlugin())
+	}
+}
+
+// Name 实现 gorm.Plugin。
+func (p *EncryptPlugin) Name() string {
+	return "wd:encrypt"
+}
+
+// Initialize 实现 gorm.Plugin，注册各类回调。
+func (p *EncryptPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("wd:encrypt_create", p.beforeCreate); err != nil {
+		return err
+	}
+	return callbacks.Update().Before("gorm:update").Register("wd:encrypt_update", p.beforeUpdate)
+}
+
+func (p *EncryptPlugin) blindFields(db *gorm.DB) []encryptedBlindField {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	fields, err := encryptedBlindFields(db.Statement.Schema)
+	if err != nil {
+		_ = db.AddError(err)
+		return nil
+	}
+	return fields
+}
+
+func (p *EncryptPlugin) beforeCreate(db *gorm.DB) {
+	fields := p.blindFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	stmt := db.Statement
+	switch dest := stmt.Dest.(type) {
+	case map[string]any:
+		p.fillMap(db, dest, fields)
+		return
+	case []map[string]any:
+		for _, row := range dest {
+			p.fillMap(db, row, fields)
+		}
+		return
+	}
+
+	fill := func(row reflect.Value) {
+		for _, f := range fields {
+			value, _ := f.source.ValueOf(stmt.Context, row)
+			index, err := encryptedBlindValue(value)
+			if err != nil {
+				_ = db.AddError(err)
+				return
+			}
+			if index == nil {
+				index = BlindIndex("")
+			}
+			_ = db.AddError(f.index.Set(stmt.Context, row, index))
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			row := reflect.Indirect(stmt.ReflectValue.Index(i))
+			if row.Kind() == reflect.Struct {
+				fill(row)
+			}
+		}
+	case reflect.Struct:
+		fill(stmt.ReflectValue)
+	}
+}
+
+// beforeUpdate 只为本次更新涉及的来源列计算盲索引，未更新来源列时不改动盲索引列。
+func (p *EncryptPlugin) beforeUpdate(db *gorm.DB) {
+	fields := p.blindFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	stmt := db.Statement
+	if dest, ok := stmt.Dest.(map[string]any); ok {
+		p.fillMap(db, dest, fields)
+		return
+	}
+
+	destValue := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if destValue.Kind() != reflect.Struct {
+		return
+	}
+	for _, f := range fields {
+		if !p.updating(stmt, f.source) {
+			continue
+		}
+		value, zero := f.source.ValueOf(stmt.Context, destValue)
+		if zero && len(stmt.Selects) == 0 {
+			continue
+		}
+		index, err := encryptedBlindValue(value)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		if index == nil {
+			index = BlindIndex("")
+		}
+		stmt.SetColumn(f.index.DBName, index, true)
+		if len(stmt.Selects) > 0 && !p.updating(stmt, f.index) {
+			stmt.Selects = append(stmt.Selects, f.index.DBName)
+		}
+	}
+}
+
+// updating 用来判断字段是否在本次 Select/Omit 允许更新的范围内。
+func (p *EncryptPlugin) updating(stmt *gorm.Statement, field *schema.Field) bool {
+	selectColumns, restricted := stmt.SelectAndOmitColumns(false, true)
+	if v, ok := selectColumns[field.DBName]; ok {
+		return v
+	}
+	return !restricted
+}
+
+func (p *EncryptPlugin) fillMap(db *gorm.DB, dest map[string]any, fields []encryptedBlindField) {
+	for _, f := range fields {
+		value, ok := dest[f.source.DBName]
+		if !ok {
+			value, ok = dest[f.source.Name]
+		}
+		if !ok {
+			continue
+		}
+		index, err := encryptedBlindValue(value)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		dest[f.index.DBName] = index
+	}
+}
+
+// ReEncryptJob 分批扫描带加密列的表，把仍使用旧密钥或遗留明文的行用主密钥重新加密，同时补齐盲索引。
+type ReEncryptJob struct {
+	db           *gorm.DB
+	models       []any
+	batchSize    int
+	lockKey      string
+	errorHandler func(err error)
+}
+
+type WithReEncryptJobOption func(*ReEncryptJob)
+
+// WithReEncryptJobModel 添加需要重新加密的模型，例如 &User{}。
+func WithReEncryptJobModel(models ...any) WithReEncryptJobOption {
+	return func(j *ReEncryptJob) {
+		j.models = append(j.models, models...)
+	}
+}
+
+// WithReEncryptJobDB 指定数据库连接，默认 InsDB。
+func WithReEncryptJobDB(db *gorm.DB) WithReEncryptJobOption {
+	return func(j *ReEncryptJob) {
+		j.db = db
+	}
+}
+
+// WithReEncryptJobBatchSize 设置每批扫描的行数。
+func WithReEncryptJobBatchSize(size int) WithReEncryptJobOption {
+	return func(j *ReEncryptJob) {
+		if size > 0 {
+			j.batchSize = size
+		}
+	}
+}
+
+// WithReEncryptJobLockKey 设置多实例部署时互斥执行使用的 Redis 锁键名。
+func WithReEncryptJobLockKey(key string) WithReEncryptJobOption {
+	return func(j *ReEncryptJob) {
+		if key != "" {
+			j.lockKey = key
+		}
+	}
+}
+
+// WithReEncryptJobErrorHandler 设置定时执行出错时的回调。
+func WithReEncryptJobErrorHandler(handler func(err error)) WithReEncryptJobOption {
+	return func(j *ReEncryptJob) {
+		j.errorHandler = handler
+	}
+}
+
+// NewReEncryptJob 创建重新加密任务。
+func NewReEncryptJob(opts ...WithReEncryptJobOption) *ReEncryptJob {
+	job := &ReEncryptJob{
+		batchSize: defaultReEncryptBatch,
+		lockKey:   defaultReEncryptLockKey,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return job
+}
+
+// Register 把任务注册到定时任务中，interval 为 0 时每小时执行一次，每个周期先获取 Redis 锁，保证多实例下只有一个实例在执行。
+func (j *ReEncryptJob) Register(cron *CronConfig, interval time.Duration, options ...gocron.JobOption) (gocron.Job, error) {
+	if cron == nil {
+		return nil, errors.New("CronConfig为空,需要先使用InitCronJob()进行初始化")
+	}
+	if InsRedis == nil {
+		return nil, redisClientNilErr()
+	}
+	if interval <= 0 {
+		interval = defaultReEncryptInterval
+	}
+	options = append([]gocron.JobOption{gocron.WithSingletonMode(gocron.LimitModeReschedule)}, options...)
+	return cron.RunJobEveryDuration(interval, gocron.NewTask(func() {
+		if err := j.runWithLock(interval); err != nil && j.errorHandler != nil {
+			j.errorHandler(err)
+		}
+	}), options...)
+}
+
+func (j *ReEncryptJob) runWithLock(interval time.Duration) error {
+	expiry := max(interval, 10*time.Second)
+	mutex := InsRedis.NewLock(j.lockKey, redsync.WithExpiry(expiry), redsync.WithTries(1))
+	if err := mutex.TryLock(); err != nil {
+		return nil
+	}
+	defer mutex.Unlock()
+
+	ctx, cancel := BackgroundTimeout(expiry)
+	defer cancel()
+	_, err := j.RunOnce(ctx)
+	return err
+}
+
+// RunOnce 完整扫描一遍所有模型，返回重新写入的行数；扫描包含软删除的行并跳过租户隔离。
+func (j *ReEncryptJob) RunOnce(ctx context.Context) (int, error) {
+	db := j.db
+	if db == nil {
+		if InsDB == nil || InsDB.DB == nil {
+			return 0, gormClientNilErr()
+		}
+		db = InsDB.DB
+	}
+	if InsKeyring == nil {
+		return 0, keyringNilErr()
+	}
+	db = db.WithContext(WithoutTenant(ctx))
+
+	total := 0
+	for _, model := range j.models {
+		n, err := j.runModel(db, model)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (j *ReEncryptJob) runModel(db *gorm.DB, model any) (int, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	s := stmt.Schema
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("%s 没有唯一主键，无法重新加密", s.Name)
+	}
+	var encrypted []*schema.Field
+	for _, field := range s.Fields {
+		if field.DBName != "" && encryptedIsColumn(field) {
+			encrypted = append(encrypted, field)
+		}
+	}
+	if len(encrypted) == 0 {
+		return 0, nil
+	}
+	blinds, err := encryptedBlindFields(s)
+	if err != nil {
+		return 0, err
+	}
+
+	columns := make([]string, 0, len(encrypted)+len(blinds))
+	for _, field := range encrypted {
+		columns = append(columns, field.DBName)
+	}
+	for _, f := range blinds {
+		columns = append(columns, f.index.DBName)
+	}
+	primary := InsKeyring.PrimaryKeyID()
+	rewritten := 0
+	var last any
+	for {
+		rows := reflect.New(reflect.SliceOf(s.ModelType))
+		query := db.Model(model).Unscoped().Select(append([]string{pk.DBName}, columns...)).Order(pk.DBName).Limit(j.batchSize)
+		if last != nil {
+			query = query.Where(fmt.Sprintf("%s > ?", db.Statement.Quote(pk.DBName)), last)
+		}
+		if err = query.Find(rows.Interface()).Error; err != nil {
+			return rewritten, err
+		}
+		list := rows.Elem()
+		for i := 0; i < list.Len(); i++ {
+			row := list.Index(i)
+			changed, err := j.refresh(db, row, encrypted, blinds, primary)
+			if err != nil {
+				return rewritten, err
+			}
+			if !changed {
+				continue
+			}
+			// 只在加密列仍是读取时的内容时写回，读取之后被业务修改的行留到下一轮处理
+			tx := db.Session(&gorm.Session{SkipHooks: true}).Unscoped().Model(row.Addr().Interface()).Select(columns)
+			for _, field := range encrypted {
+				column := db.Statement.Quote(field.DBName)
+				if raw, stored := encryptedRawValue(db.Statement.Context, field, row); stored {
+					tx = tx.Where(column+" = ?", raw)
+				} else {
+					tx = tx.Where(column + " IS NULL")
+				}
+			}
+			result := tx.Updates(row.Addr().Interface())
+			if result.Error != nil {
+				return rewritten, result.Error
+			}
+			if result.RowsAffected > 0 {
+				rewritten++
+			}
+		}
+		if list.Len() < j.batchSize {
+			return rewritten, nil
+		}
+		last, _ = pk.ValueOf(db.Statement.Context, list.Index(list.Len()-1))
+	}
+}
+
+// encryptedRawValue 返回加密列读取时库中的原始内容。
+func encryptedRawValue(ctx context.Context, field *schema.Field, row reflect.Value) (string, bool) {
+	value, _ := field.ValueOf(ctx, row)
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Ptr {
+		return "", false
+	}
+	if column, ok := rv.Interface().(encryptedColumn); ok {
+		return column.encryptedRaw()
+	}
+	return "", false
+}
+
+// refresh 用来判断一行是否需要重写，需要时顺带算好盲索引。
+func (j *ReEncryptJob) refresh(db *gorm.DB, row reflect.Value, encrypted []*schema.Field, blinds []encryptedBlindField, primary string) (bool, error) {
+	ctx := db.Statement.Context
+	changed := false
+	for _, field := range encrypted {
+		value, _ := field.ValueOf(ctx, row)
+		rv := reflect.ValueOf(value)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() == reflect.Ptr {
+			continue
+		}
+		if column, ok := rv.Interface().(encryptedColumn); ok {
+			if keyID, stored := column.encryptedKeyID(); stored && keyID != primary {
+				changed = true
+			}
+		}
+	}
+	for _, f := range blinds {
+		value, _ := f.source.ValueOf(ctx, row)
+		index, err := encryptedBlindValue(value)
+		if err != nil {
+			return false, err
+		}
+		if index == nil {
+			index = BlindIndex("")
+		}
+		current, _ := f.index.ValueOf(ctx, row)
+		if reflect.DeepEqual(current, index) {
+			continue
+		}
+		if err = f.index.Set(ctx, row, index); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
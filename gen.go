@@ -2,6 +2,7 @@ package wd
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"gorm.io/gen"
@@ -24,6 +25,7 @@ type GenConfig struct {
 	tableColumnType        map[string][]GenFieldType
 	deletedFieldIsShow     bool
 	customGlobalJsonTag    map[string]string
+	dtoOutPath             string
 }
 
 type WithGenConfig func(*GenConfig)
@@ -35,6 +37,13 @@ func WithGenOutFilePath(outFilePath string) WithGenConfig {
 	}
 }
 
+// WithGenDTO 用来在生成 model 的同时为每张表生成创建请求、PATCH 请求和响应结构体，outFilePath 为输出目录。
+func WithGenDTO(outFilePath string) WithGenConfig {
+	return func(gc *GenConfig) {
+		gc.dtoOutPath = outFilePath
+	}
+}
+
 // WithGenDeletedFieldIsShow 用来决定是否生成软删字段。
 func WithGenDeletedFieldIsShow(deletedJsonIsNull bool) WithGenConfig {
 	return func(gc *GenConfig) {
@@ -487,12 +496,16 @@ func (db *GormClient) Gen(opts ...WithGenConfig) {
 		},
 	}
 
+	for k, v := range genDialectDataTypeMap(db.Dialector.Name()) {
+		dataMap[k] = v
+	}
 	for k, v := range genConfig.globalColumnType {
 		dataMap[k] = v
 	}
 
 	g.WithDataTypeMap(dataMap)
-	g.UseDB(db.DB)
+	genDB := genDialectDB(db.DB)
+	g.UseDB(genDB)
 
 	var fieldTypes []gen.ModelOpt
 	if genConfig.deletedFieldIsShow {
@@ -592,20 +605,48 @@ func (db *GormClient) Gen(opts ...WithGenConfig) {
 	if len(genConfig.useTablesName) > 0 {
 		tables = append(tables, genConfig.useTablesName...)
 	} else {
-		tableList, err := db.DB.Migrator().GetTables()
+		tableList, err := genDB.Migrator().GetTables()
 		if err != nil {
 			panic(fmt.Errorf("get all tables fail: %w", err))
 		}
 		tables = append(tables, tableList...)
 	}
 
-	var gms []interface{}
+	var (
+		gms       []interface{}
+		dtoTables []genDTOTable
+	)
 	for _, table := range tables {
-		gms = append(gms, g.GenerateModel(table, buildTableModelOpts(table)...))
+		meta := g.GenerateModel(table, buildTableModelOpts(table)...)
+		gms = append(gms, meta)
+		if genConfig.dtoOutPath == "" {
+			continue
+		}
+		dtoTable := genDTOTable{Table: table, Model: meta.ModelStructName}
+		for _, item := range meta.Fields {
+			dtoTable.Fields = append(dtoTable.Fields, genDTOField{
+				Name:   item.Name,
+				Type:   item.Type,
+				Column: item.ColumnName,
+				JSON:   item.Tag[field.TagKeyJson],
+			})
+		}
+		dtoTables = append(dtoTables, dtoTable)
+	}
+	if db.Dialector.Name() == string(GormDialectMySQL) {
+		g.ApplyInterface(func(CustomDeleted) {}, gms...)
+	} else {
+		g.ApplyInterface(func(CustomDeletedPortable) {}, gms...)
 	}
-	g.ApplyInterface(func(CustomDeleted) {}, gms...)
 
 	g.Execute()
+
+	if genConfig.dtoOutPath != "" {
+		modelPath := filepath.Join(filepath.Dir(g.OutPath), g.ModelPkgPath)
+		if err := db.genDTO(genConfig.dtoOutPath, modelPath, dtoTables); err != nil {
+			panic(fmt.Errorf("generate dto fail: %w", err))
+		}
+	}
 }
 
 type CustomDeleted interface {
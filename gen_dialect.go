@@ -0,0 +1,146 @@
+package wd
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gen"
+	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
+)
+
+type genDataTypeMap = map[string]func(columnType gorm.ColumnType) (dataType string)
+
+// CustomDeletedPortable 与 CustomDeleted 方法一致，SQL 不依赖 MySQL 语法，Postgres/SQLite 生成代码时使用。
+type CustomDeletedPortable interface {
+	// UPDATE @@table SET deleted_at = CURRENT_TIMESTAMP, deleted_at_flag = 1 WHERE id = @id
+	CustomDeletedFlag(id any) (gen.RowsAffected, error)
+	// DELETE FROM @@table WHERE id = @id
+	CustomDeletedUnscoped(id any) (gen.RowsAffected, error)
+}
+
+// genNullableType 返回 typ，列可空时返回 *typ。
+func genNullableType(typ string) func(columnType gorm.ColumnType) string {
+	return func(columnType gorm.ColumnType) string {
+		if nullable, ok := columnType.Nullable(); ok && nullable {
+			return "*" + typ
+		}
+		return typ
+	}
+}
+
+// genDialectDataTypeMap 返回方言特有的类型映射，会覆盖 Gen 中默认的 MySQL 映射。
+func genDialectDataTypeMap(dialect string) genDataTypeMap {
+	switch GormDialect(dialect) {
+	case GormDialectPostgres:
+		return genPostgresDataTypeMap()
+	case GormDialectSQLite:
+		return genSQLiteDataTypeMap()
+	default:
+		return nil
+	}
+}
+
+// genPostgresDataTypeMap 以 udt_name 为键，数组列的键为 format_type 结果，例如 text[]、bigint[]。
+func genPostgresDataTypeMap() genDataTypeMap {
+	return genDataTypeMap{
+		"int2":        genNullableType("int16"),
+		"int4":        genNullableType("int32"),
+		"int8":        genNullableType("int64"),
+		"float4":      genNullableType("float32"),
+		"float8":      genNullableType("float64"),
+		"numeric":     genNullableType("decimal.Decimal"),
+		"money":       genNullableType("string"),
+		"bpchar":      genNullableType("string"),
+		"citext":      genNullableType("string"),
+		"uuid":        genNullableType("string"),
+		"inet":        genNullableType("string"),
+		"cidr":        genNullableType("string"),
+		"bytea":       genNullableType("[]byte"),
+		"timestamptz": genNullableType("wd.DateTime"),
+		"timetz":      genNullableType("wd.TimeOnly"),
+		"jsonb":       genNullableType("datatypes.JSON"),
+
+		"text[]":              genNullableType("wd.SQLArray[string]"),
+		"character varying[]": genNullableType("wd.SQLArray[string]"),
+		"uuid[]":              genNullableType("wd.SQLArray[string]"),
+		"boolean[]":           genNullableType("wd.SQLArray[bool]"),
+		"smallint[]":          genNullableType("wd.SQLArray[int16]"),
+		"integer[]":           genNullableType("wd.SQLArray[int32]"),
+		"bigint[]":            genNullableType("wd.SQLArray[int64]"),
+		"real[]":              genNullableType("wd.SQLArray[float32]"),
+		"double precision[]":  genNullableType("wd.SQLArray[float64]"),
+	}
+}
+
+// genSQLiteDataTypeMap SQLite 的 integer 为 64 位，numeric 按十进制处理。
+func genSQLiteDataTypeMap() genDataTypeMap {
+	return genDataTypeMap{
+		"integer": genNullableType("int64"),
+		"real":    genNullableType("float64"),
+		"numeric": genNullableType("decimal.Decimal"),
+	}
+}
+
+// genDialectDB 返回 Gen 使用的连接。SQLite 驱动对空表取不到列的 ScanType，gen 生成 default 标签时会 panic，
+// 这里包装 Migrator，按声明类型补全 ScanType。
+func genDialectDB(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() != string(GormDialectSQLite) {
+		return db
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	config := *tx.Config
+	config.Dialector = genSQLiteDialector{Dialector: tx.Dialector}
+	tx.Config = &config
+	return tx
+}
+
+type genSQLiteDialector struct {
+	gorm.Dialector
+}
+
+func (d genSQLiteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return genSQLiteMigrator{Migrator: d.Dialector.Migrator(db)}
+}
+
+type genSQLiteMigrator struct {
+	gorm.Migrator
+}
+
+func (m genSQLiteMigrator) ColumnTypes(value any) ([]gorm.ColumnType, error) {
+	columnTypes, err := m.Migrator.ColumnTypes(value)
+	if err != nil {
+		return nil, err
+	}
+	for i, columnType := range columnTypes {
+		column, ok := columnType.(migrator.ColumnType)
+		if !ok || column.ScanTypeValue != nil || (column.SQLColumnType != nil && column.SQLColumnType.ScanType() != nil) {
+			continue
+		}
+		column.ScanTypeValue = sqliteScanType(column.DatabaseTypeName())
+		columnTypes[i] = column
+	}
+	return columnTypes, nil
+}
+
+// sqliteScanType 按 SQLite 类型亲和性规则推断 Go 类型。
+func sqliteScanType(databaseType string) reflect.Type {
+	databaseType = strings.ToLower(databaseType)
+	switch {
+	case strings.Contains(databaseType, "int"):
+		return reflect.TypeOf(int64(0))
+	case strings.Contains(databaseType, "bool"):
+		return reflect.TypeOf(false)
+	case strings.Contains(databaseType, "date"), strings.Contains(databaseType, "time"):
+		return reflect.TypeOf(time.Time{})
+	case strings.Contains(databaseType, "char"), strings.Contains(databaseType, "clob"), strings.Contains(databaseType, "text"):
+		return reflect.TypeOf("")
+	case strings.Contains(databaseType, "blob"):
+		return reflect.TypeOf([]byte(nil))
+	case strings.Contains(databaseType, "real"), strings.Contains(databaseType, "floa"), strings.Contains(databaseType, "doub"), strings.Contains(databaseType, "num"), strings.Contains(databaseType, "dec"):
+		return reflect.TypeOf(float64(0))
+	default:
+		return reflect.TypeOf("")
+	}
+}
@@ -0,0 +1,237 @@
+package wd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+	"gorm.io/gorm"
+)
+
+// genDTOSkipWriteColumns 由数据库或 gorm 维护的列，不出现在创建和 PATCH 请求中。
+var genDTOSkipWriteColumns = map[string]struct{}{
+	"created_at":      {},
+	"updated_at":      {},
+	"deleted_at":      {},
+	"deleted_at_flag": {},
+}
+
+// genDTOImports DTO 中可能用到的类型所在的包，未使用的导入会在格式化时被移除。
+var genDTOImports = []string{
+	"time",
+	"github.com/loveyu233/wd",
+	"github.com/shopspring/decimal",
+	"gorm.io/datatypes",
+	"gorm.io/gorm",
+}
+
+type genDTOField struct {
+	Name   string
+	Type   string
+	Column string
+	JSON   string
+}
+
+type genDTOTable struct {
+	Table  string
+	Model  string
+	Fields []genDTOField
+}
+
+type genDTOColumn struct {
+	nullable      bool
+	hasDefault    bool
+	primaryKey    bool
+	autoIncrement bool
+	maxLength     int64
+}
+
+// genDTO 用来为每张表生成创建请求、PATCH 请求和响应结构体。
+func (db *GormClient) genDTO(outPath, modelPath string, tables []genDTOTable) error {
+	modelPkg, err := genPackagePath(modelPath)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(outPath, 0o755); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		columns, err := db.genDTOColumns(table.Table)
+		if err != nil {
+			return err
+		}
+		fileName := filepath.Join(outPath, strings.ToLower(table.Table)+".dto.go")
+		content := renderGenDTO(filepath.Base(outPath), modelPkg, table, columns)
+		formatted, err := imports.Process(fileName, content, nil)
+		if err != nil {
+			return fmt.Errorf("格式化 %s 失败: %w\n%s", fileName, err, content)
+		}
+		if err = os.WriteFile(fileName, formatted, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *GormClient) genDTOColumns(table string) (map[string]genDTOColumn, error) {
+	columnTypes, err := db.DB.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("读取表 %s 字段失败: %w", table, err)
+	}
+	columns := make(map[string]genDTOColumn, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columns[columnType.Name()] = newGenDTOColumn(columnType)
+	}
+	return columns, nil
+}
+
+func newGenDTOColumn(columnType gorm.ColumnType) genDTOColumn {
+	var column genDTOColumn
+	column.nullable, _ = columnType.Nullable()
+	column.primaryKey, _ = columnType.PrimaryKey()
+	column.autoIncrement, _ = columnType.AutoIncrement()
+	if value, ok := columnType.DefaultValue(); ok && value != "" && !strings.EqualFold(value, "NULL") {
+		column.hasDefault = true
+	}
+	if length, ok := columnType.Length(); ok && length > 0 {
+		column.maxLength = length
+	}
+	return column
+}
+
+func genPackagePath(dir string) (string, error) {
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: dir}, ".")
+	if err != nil {
+		return "", fmt.Errorf("解析 %s 包路径失败: %w", dir, err)
+	}
+	if len(pkgs) == 0 || pkgs[0].PkgPath == "" {
+		return "", fmt.Errorf("解析 %s 包路径失败", dir)
+	}
+	return pkgs[0].PkgPath, nil
+}
+
+func renderGenDTO(pkgName, modelPkg string, table genDTOTable, columns map[string]genDTOColumn) []byte {
+	var buf bytes.Buffer
+	model := filepath.Base(modelPkg) + "." + table.Model
+
+	fmt.Fprintf(&buf, "// Code generated by wd.Gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	for _, path := range append([]string{modelPkg}, genDTOImports...) {
+		fmt.Fprintf(&buf, "\t%q\n", path)
+	}
+	buf.WriteString(")\n\n")
+
+	var (
+		createFields []string
+		toModel      []string
+		toModelOpt   []string
+		patchFields  []string
+		respFields   []string
+		toResp       []string
+	)
+	for _, field := range table.Fields {
+		column := columns[field.Column]
+		jsonName := strings.Split(field.JSON, ",")[0]
+		if jsonName == "" {
+			jsonName = field.Column
+		}
+		baseType := strings.TrimPrefix(field.Type, "*")
+		isString := baseType == "string"
+		_, skipWrite := genDTOSkipWriteColumns[field.Column]
+		skipWrite = skipWrite || baseType == "gorm.DeletedAt" || jsonName == "-"
+		// 自增主键不出现在创建请求中，主键都不允许 PATCH
+		autoKey := column.primaryKey && (column.autoIncrement || strings.Contains(baseType, "int"))
+
+		if !skipWrite && !autoKey {
+			var rules []string
+			createType := field.Type
+			switch {
+			case column.nullable:
+				rules = append(rules, "omitempty")
+				toModel = append(toModel, fmt.Sprintf("%s: r.%s,", field.Name, field.Name))
+			case column.hasDefault:
+				createType = "*" + baseType
+				rules = append(rules, "omitempty")
+				toModelOpt = append(toModelOpt, fmt.Sprintf("if r.%[1]s != nil {\nm.%[1]s = *r.%[1]s\n}", field.Name))
+			default:
+				if isString {
+					rules = append(rules, "required")
+				}
+				toModel = append(toModel, fmt.Sprintf("%s: r.%s,", field.Name, field.Name))
+			}
+			if isString && column.maxLength > 0 {
+				rules = append(rules, fmt.Sprintf("max=%d", column.maxLength))
+			}
+			createFields = append(createFields, genDTOFieldLine(field.Name, createType, jsonName, genDTOBinding(rules), ""))
+		}
+
+		if !skipWrite && !column.primaryKey {
+			// PATCH 中不可空的列禁止传 null，可空的列传 null 时跳过其余规则
+			patchRules := []string{"notnull"}
+			if column.nullable {
+				patchRules = []string{"omitnil"}
+			}
+			if isString && column.maxLength > 0 {
+				patchRules = append(patchRules, fmt.Sprintf("max=%d", column.maxLength))
+			}
+			patchBinding := genDTOBinding(patchRules)
+			if patchBinding == "omitnil" {
+				patchBinding = ""
+			}
+			patchFields = append(patchFields, genDTOFieldLine(field.Name, "wd.Field["+baseType+"]", jsonName, patchBinding, field.Name))
+		}
+
+		if field.Column == "deleted_at" || field.Column == "deleted_at_flag" || jsonName == "-" || baseType == "gorm.DeletedAt" {
+			continue
+		}
+		respType, convert := genDTORespType(field.Type)
+		respFields = append(respFields, genDTOFieldLine(field.Name, respType, jsonName, "", ""))
+		toResp = append(toResp, fmt.Sprintf("%s: %s,", field.Name, fmt.Sprintf(convert, "m."+field.Name)))
+	}
+
+	fmt.Fprintf(&buf, "// Create%[1]sReq 创建 %[2]s 的请求参数。\ntype Create%[1]sReq struct {\n%[3]s}\n\n", table.Model, table.Table, strings.Join(createFields, ""))
+	fmt.Fprintf(&buf, "// ToModel 用来转换为 %[1]s。\nfunc (r *Create%[2]sReq) ToModel() *%[1]s {\nm := &%[1]s{\n%[3]s\n}\n", model, table.Model, strings.Join(toModel, "\n"))
+	for _, line := range toModelOpt {
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("return m\n}\n\n")
+	fmt.Fprintf(&buf, "// Patch%[1]sReq 部分更新 %[2]s 的请求参数，配合 wd.BuildGenUpdates 使用。\ntype Patch%[1]sReq struct {\n%[3]s}\n\n", table.Model, table.Table, strings.Join(patchFields, ""))
+	fmt.Fprintf(&buf, "// %[1]sResp %[2]s 的响应结构。\ntype %[1]sResp struct {\n%[3]s}\n\n", table.Model, table.Table, strings.Join(respFields, ""))
+	fmt.Fprintf(&buf, "// New%[1]sResp 用来把 %[2]s 转换为响应结构。\nfunc New%[1]sResp(m *%[2]s) *%[1]sResp {\nif m == nil {\nreturn nil\n}\nreturn &%[1]sResp{\n%[3]s\n}\n}\n",
+		table.Model, model, strings.Join(toResp, "\n"))
+	return buf.Bytes()
+}
+
+func genDTOFieldLine(name, typ, jsonName, binding, patch string) string {
+	tag := fmt.Sprintf(`json:"%s"`, jsonName)
+	if binding != "" {
+		tag += fmt.Sprintf(` binding:"%s"`, binding)
+	}
+	if patch != "" {
+		tag += fmt.Sprintf(` patch:"%s"`, patch)
+	}
+	return fmt.Sprintf("%s %s `%s`\n", name, typ, tag)
+}
+
+func genDTOBinding(rules []string) string {
+	if len(rules) == 1 && rules[0] == "omitempty" {
+		return ""
+	}
+	return strings.Join(rules, ",")
+}
+
+// genDTORespType 把 time.Time 映射为 wd.DateTime，返回响应类型和转换表达式模板。
+func genDTORespType(typ string) (string, string) {
+	switch typ {
+	case "time.Time":
+		return "wd.DateTime", "wd.DateTime(%s)"
+	case "*time.Time":
+		return "*wd.DateTime", "(*wd.DateTime)(%s)"
+	default:
+		return typ, "%s"
+	}
+}
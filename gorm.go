@@ -18,7 +18,6 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
-	gormmysql "gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -45,24 +44,43 @@ type GormClient struct {
 }
 
 type GormConnConfig struct {
+	Dialect     GormDialect // 数据库方言，默认 mysql；sqlite 时 Database 为文件路径，为空表示内存库
+	DSN         string      // 完整 DSN，设置后直接使用，忽略 Username/Password/Host/Port/Database/Params
 	Username    string
 	Password    string
 	Host        string
 	Port        int
 	Database    string
-	Params      map[string]interface{} // 连接参数,默认添加charset=utf8和parseTime=true以及loc=Asia/Shanghai
+	Params      map[string]interface{} // 连接参数,mysql默认添加charset=utf8和parseTime=true以及loc=Asia/Shanghai,postgres默认sslmode=disable和TimeZone=Asia/Shanghai,sqlite原样追加到DSN
 	PrepareStmt bool                   // 是否启用 PrepareStmt，默认 false
+
+	MaxOpenConns    int           // 最大打开连接数，<=0 时使用 database/sql 默认值(不限制)
+	MaxIdleConns    int           // 最大空闲连接数，<=0 时使用 database/sql 默认值(2)
+	ConnMaxLifetime time.Duration // 连接最大存活时间，<=0 时不限制
+	ConnMaxIdleTime time.Duration // 连接最大空闲时间，<=0 时不限制
+
+	Replicas      []GormConnConfig  // 只读副本，未填写的 Username/Password/Port/Database/Params 继承主库配置
+	ReplicaPolicy GormReplicaPolicy // 副本负载均衡策略，默认 random
 }
 
 // InitGormDB 用来根据配置初始化全局 GORM 连接。
 func InitGormDB(gcc GormConnConfig, gormLogger logger.Interface, opt ...func(db *gorm.DB) error) error {
-	dsn, err := buildMySQLDSN(gcc)
+	return InitGormDBWithName(DefaultGormDBName, gcc, gormLogger, opt...)
+}
+
+// openGormDB 用来建立连接并挂载只读副本与连接池配置。
+func openGormDB(gcc GormConnConfig, gormLogger logger.Interface, opt ...func(db *gorm.DB) error) (*gorm.DB, error) {
+	dialector, err := gormDialector(gcc)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// 内存库的每个连接互相独立，限制为单连接才能共享同一份数据
+	if isSQLiteMemory(gcc) && gcc.MaxOpenConns <= 0 {
+		gcc.MaxOpenConns = 1
 	}
 
 	db, err := gorm.Open(
-		gormmysql.Open(dsn),
+		dialector,
 		&gorm.Config{
 			Logger:                 gormLogger,
 			TranslateError:         true,
@@ -71,19 +89,20 @@ func InitGormDB(gcc GormConnConfig, gormLogger logger.Interface, opt ...func(db
 		},
 	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err = registerGormReplicas(db, gcc); err != nil {
+		return nil, err
 	}
 
 	for _, fn := range opt {
 		if err := fn(db); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	InsDB = new(GormClient)
-	InsDB.DB = db
-
-	return nil
+	return db, nil
 }
 
 func buildMySQLDSN(gcc GormConnConfig) (string, error) {
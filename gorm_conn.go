@@ -0,0 +1,213 @@
+package wd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// DefaultGormDBName 默认连接名，InitGormDB 初始化的连接使用该名称并同时写入 InsDB。
+const DefaultGormDBName = "default"
+
+// GormReplicaPolicy 只读副本的负载均衡策略。
+type GormReplicaPolicy string
+
+const (
+	GormReplicaPolicyRandom     GormReplicaPolicy = "random"
+	GormReplicaPolicyRoundRobin GormReplicaPolicy = "round_robin"
+)
+
+var (
+	gormClients   = make(map[string]*GormClient)
+	gormClientsMu sync.RWMutex
+)
+
+type forcePrimaryContextKey struct{}
+
+// InitGormDBWithName 用来初始化一个具名连接，name 为 DefaultGormDBName 时同时写入 InsDB。
+func InitGormDBWithName(name string, gcc GormConnConfig, gormLogger logger.Interface, opt ...func(db *gorm.DB) error) error {
+	if name == "" {
+		name = DefaultGormDBName
+	}
+	db, err := openGormDB(gcc, gormLogger, opt...)
+	if err != nil {
+		return err
+	}
+
+	client := &GormClient{DB: db}
+	gormClientsMu.Lock()
+	gormClients[name] = client
+	gormClientsMu.Unlock()
+
+	if name == DefaultGormDBName {
+		InsDB = client
+	}
+	return nil
+}
+
+// GetGormDB 用来按名称获取连接。
+func GetGormDB(name string) (*GormClient, bool) {
+	if name == "" {
+		name = DefaultGormDBName
+	}
+	gormClientsMu.RLock()
+	client, ok := gormClients[name]
+	gormClientsMu.RUnlock()
+	if !ok && name == DefaultGormDBName && InsDB != nil {
+		return InsDB, true
+	}
+	return client, ok
+}
+
+// MustGetGormDB 用来按名称获取连接，不存在时 panic。
+func MustGetGormDB(name string) *GormClient {
+	client, ok := GetGormDB(name)
+	if !ok {
+		panic(fmt.Errorf("数据库连接 %s 未初始化,需要先使用InitGormDBWithName()进行初始化", name))
+	}
+	return client
+}
+
+// GormDBNames 返回已初始化的连接名称。
+func GormDBNames() []string {
+	gormClientsMu.RLock()
+	defer gormClientsMu.RUnlock()
+	names := make([]string, 0, len(gormClients))
+	for name := range gormClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithForcePrimary 标记 ctx 中的查询强制走主库，常用于写后立即读的场景。
+func WithForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryContextKey{}, true)
+}
+
+// IsForcePrimary 判断 ctx 是否被标记为强制走主库。
+func IsForcePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	force, _ := ctx.Value(forcePrimaryContextKey{}).(bool)
+	return force
+}
+
+// registerGormReplicas 使用 dbresolver 挂载只读副本，并对主库与副本统一设置连接池参数。
+func registerGormReplicas(db *gorm.DB, gcc GormConnConfig) error {
+	if len(gcc.Replicas) == 0 {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		applyGormPoolConfig(sqlDB, gcc)
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(gcc.Replicas))
+	for _, replica := range gcc.Replicas {
+		dialector, err := gormDialector(inheritGormReplicaConfig(gcc, replica))
+		if err != nil {
+			return fmt.Errorf("只读副本 %s 配置无效: %w", replica.Host, err)
+		}
+		replicas = append(replicas, dialector)
+	}
+
+	policy, err := gormReplicaPolicy(gcc.ReplicaPolicy)
+	if err != nil {
+		return err
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   policy,
+	})
+	if err = db.Use(resolver); err != nil {
+		return err
+	}
+	applyGormResolverPoolConfig(resolver, gcc)
+
+	forcePrimary := func(tx *gorm.DB) {
+		if IsForcePrimary(tx.Statement.Context) {
+			dbresolver.Write.ModifyStatement(tx.Statement)
+		}
+	}
+	if err = db.Callback().Query().Before("gorm:db_resolver").Register("wd:force_primary", forcePrimary); err != nil {
+		return err
+	}
+	if err = db.Callback().Row().Before("gorm:db_resolver").Register("wd:force_primary", forcePrimary); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("gorm:db_resolver").Register("wd:force_primary", forcePrimary)
+}
+
+// applyGormPoolConfig 用来设置连接池参数，未配置的项保持 database/sql 默认值。
+func applyGormPoolConfig(sqlDB *sql.DB, gcc GormConnConfig) {
+	if gcc.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(gcc.MaxOpenConns)
+	}
+	if gcc.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(gcc.MaxIdleConns)
+	}
+	if gcc.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(gcc.ConnMaxLifetime)
+	}
+	if gcc.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(gcc.ConnMaxIdleTime)
+	}
+}
+
+// applyGormResolverPoolConfig 与 applyGormPoolConfig 相同，但会同时作用于主库和全部副本。
+func applyGormResolverPoolConfig(resolver *dbresolver.DBResolver, gcc GormConnConfig) {
+	if gcc.MaxOpenConns > 0 {
+		resolver.SetMaxOpenConns(gcc.MaxOpenConns)
+	}
+	if gcc.MaxIdleConns > 0 {
+		resolver.SetMaxIdleConns(gcc.MaxIdleConns)
+	}
+	if gcc.ConnMaxLifetime > 0 {
+		resolver.SetConnMaxLifetime(gcc.ConnMaxLifetime)
+	}
+	if gcc.ConnMaxIdleTime > 0 {
+		resolver.SetConnMaxIdleTime(gcc.ConnMaxIdleTime)
+	}
+}
+
+// inheritGormReplicaConfig 用来让副本继承主库中未单独配置的字段，方言始终与主库一致。
+func inheritGormReplicaConfig(primary, replica GormConnConfig) GormConnConfig {
+	replica.Dialect = primary.Dialect
+	if replica.Username == "" {
+		replica.Username = primary.Username
+		if replica.Password == "" {
+			replica.Password = primary.Password
+		}
+	}
+	if replica.Port == 0 {
+		replica.Port = primary.Port
+	}
+	if replica.Database == "" {
+		replica.Database = primary.Database
+	}
+	if len(replica.Params) == 0 {
+		replica.Params = primary.Params
+	}
+	return replica
+}
+
+func gormReplicaPolicy(policy GormReplicaPolicy) (dbresolver.Policy, error) {
+	switch policy {
+	case "", GormReplicaPolicyRandom:
+		return dbresolver.RandomPolicy{}, nil
+	case GormReplicaPolicyRoundRobin:
+		return dbresolver.StrictRoundRobinPolicy(), nil
+	default:
+		return nil, fmt.Errorf("不支持的副本负载均衡策略: %s", policy)
+	}
+}
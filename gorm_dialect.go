@@ -0,0 +1,156 @@
+package wd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// GormDialect 数据库方言。
+type GormDialect string
+
+const (
+	GormDialectMySQL    GormDialect = "mysql"
+	GormDialectPostgres GormDialect = "postgres"
+	GormDialectSQLite   GormDialect = "sqlite"
+
+	defaultPostgresPort    = 5432
+	defaultPostgresSSLMode = "disable"
+	sqliteMemoryDatabase   = ":memory:"
+)
+
+// gormDialector 用来按方言构造 DSN 并返回对应的 gorm.Dialector，配置了 DSN 时直接使用。
+func gormDialector(gcc GormConnConfig) (gorm.Dialector, error) {
+	dsn := gcc.DSN
+	if dsn == "" {
+		var err error
+		switch gcc.Dialect {
+		case "", GormDialectMySQL:
+			dsn, err = buildMySQLDSN(gcc)
+		case GormDialectPostgres:
+			dsn, err = buildPostgresDSN(gcc)
+		case GormDialectSQLite:
+			dsn, err = buildSQLiteDSN(gcc)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch gcc.Dialect {
+	case "", GormDialectMySQL:
+		return gormmysql.Open(dsn), nil
+	case GormDialectPostgres:
+		return postgres.Open(dsn), nil
+	case GormDialectSQLite:
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库方言: %s", gcc.Dialect)
+	}
+}
+
+// buildPostgresDSN 用来生成 key=value 形式的 Postgres DSN，默认 sslmode=disable、TimeZone=Asia/Shanghai。
+func buildPostgresDSN(gcc GormConnConfig) (string, error) {
+	if strings.TrimSpace(gcc.Host) == "" {
+		return "", fmt.Errorf("postgres 参数 host 不能为空")
+	}
+	port := gcc.Port
+	if port == 0 {
+		port = defaultPostgresPort
+	}
+
+	params := map[string]string{
+		"host":     gcc.Host,
+		"port":     strconv.Itoa(port),
+		"user":     gcc.Username,
+		"password": gcc.Password,
+		"dbname":   gcc.Database,
+		"sslmode":  defaultPostgresSSLMode,
+		"TimeZone": ShangHaiTimeLocation.String(),
+	}
+	for key, value := range gcc.Params {
+		if value == nil {
+			continue
+		}
+		rawValue := strings.TrimSpace(fmt.Sprint(value))
+		if rawValue == "" {
+			continue
+		}
+		if strings.EqualFold(key, "timezone") || strings.EqualFold(key, "loc") {
+			loc, err := parseMySQLLocation(rawValue)
+			if err != nil {
+				return "", err
+			}
+			params["TimeZone"] = loc.String()
+			continue
+		}
+		params[key] = rawValue
+	}
+
+	pairs := make([]string, 0, len(params))
+	for _, key := range sortedStringKeys(params) {
+		if params[key] == "" {
+			continue
+		}
+		pairs = append(pairs, key+"="+quotePostgresDSNValue(params[key]))
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// quotePostgresDSNValue 按 libpq 规则为包含空格、引号或反斜杠的值加单引号。
+func quotePostgresDSNValue(value string) string {
+	if !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// buildSQLiteDSN 用来生成 SQLite DSN，Database 为文件路径，为空时使用内存库，Params 作为查询参数追加。
+// 例如 Params: {"_pragma": "foreign_keys(1)"}。
+func buildSQLiteDSN(gcc GormConnConfig) (string, error) {
+	database := strings.TrimSpace(gcc.Database)
+	if database == "" {
+		database = sqliteMemoryDatabase
+	}
+
+	values := url.Values{}
+	for key, value := range gcc.Params {
+		if value == nil {
+			continue
+		}
+		rawValue := strings.TrimSpace(fmt.Sprint(value))
+		if rawValue == "" {
+			continue
+		}
+		values.Add(key, rawValue)
+	}
+	if len(values) == 0 {
+		return database, nil
+	}
+
+	separator := "?"
+	if strings.Contains(database, "?") {
+		separator = "&"
+	}
+	return database + separator + values.Encode(), nil
+}
+
+// isSQLiteMemory 判断配置是否为 SQLite 内存库，内存库的每个连接都是独立的数据库。
+func isSQLiteMemory(gcc GormConnConfig) bool {
+	if gcc.Dialect != GormDialectSQLite {
+		return false
+	}
+	database := strings.TrimSpace(gcc.Database)
+	if gcc.DSN != "" {
+		database = gcc.DSN
+	}
+	return database == "" || strings.Contains(database, sqliteMemoryDatabase) || strings.Contains(database, "mode=memory")
+}
@@ -0,0 +1,470 @@
+package wd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// fixtureNameKey 行数据中的符号名，其它数据通过 {{ ref "<fixture>.<name>" }} 引用该行
+	fixtureNameKey = "_name"
+	fixtureTag     = "fixture"
+)
+
+// Fixture 一张表的种子数据，数据来自 File 和 Rows，两者同时存在时先加载文件。
+//
+// YAML/JSON 文件内容为对象数组，键为列名或字段名，_name 为该行的符号名，未设置时使用从 1 开始的行号：
+//
+//	# users.yaml
+//	- _name: alice
+//	  id: '{{ snowflake }}'
+//	  name: Alice
+//	  created_at: '{{ addDays -3 }}'
+//	- name: Bob
+//	  inviter_id: '{{ ref "users.alice" }}'
+//
+// 字符串值中可以使用模板函数，见 FixtureLoader.Funcs。
+type Fixture struct {
+	// Name 符号名前缀，默认为表名
+	Name string
+	// Model 模型，例如 &model.User{}
+	Model any
+	// File 数据文件，支持 .yaml、.yml、.json、.xlsx
+	File string
+	// Rows 直接提供的数据
+	Rows []map[string]any
+
+	// ExcelRow Excel 行结构体，例如 UserRow{}，字段带 excel 标签，按 fixture 标签或字段名匹配模型字段；
+	// 为空时直接把 Excel 映射为 Model，此时不支持符号名和模板
+	ExcelRow any
+	// ExcelOptions 传给 InitExcelMapper 的选项
+	ExcelOptions []WithExcelMapperOption
+}
+
+// FixtureSet 加载完成的种子数据，按 "<fixture>.<name>" 查找。
+type FixtureSet struct {
+	records map[string]*fixtureRecord
+	names   []string
+}
+
+type fixtureRecord struct {
+	schema *schema.Schema
+	value  reflect.Value
+}
+
+// Get 返回符号名对应的模型指针，不存在时返回 nil。
+func (s *FixtureSet) Get(name string) any {
+	record, ok := s.records[name]
+	if !ok {
+		return nil
+	}
+	return record.value.Interface()
+}
+
+// ID 返回符号名对应记录的主键，不存在时返回 nil。
+func (s *FixtureSet) ID(name string) any {
+	record, ok := s.records[name]
+	if !ok || record.schema.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	value, _ := record.schema.PrioritizedPrimaryField.ValueOf(context.Background(), record.value.Elem())
+	return value
+}
+
+// Names 返回按加载顺序排列的全部符号名。
+func (s *FixtureSet) Names() []string {
+	return slices.Clone(s.names)
+}
+
+// FixtureGet 用来按符号名取得指定类型的模型。
+func FixtureGet[T any](s *FixtureSet, name string) *T {
+	value, _ := s.Get(name).(*T)
+	return value
+}
+
+// FixtureLoader 种子数据加载器。
+type FixtureLoader struct {
+	db       *gorm.DB
+	truncate bool
+	funcs    template.FuncMap
+}
+
+type WithFixtureOption func(*FixtureLoader)
+
+// WithFixtureTruncate 设置加载前是否清空表，默认清空，清空与加载在同一事务中完成。
+func WithFixtureTruncate(truncate bool) WithFixtureOption {
+	return func(l *FixtureLoader) {
+		l.truncate = truncate
+	}
+}
+
+// WithFixtureFuncs 添加或覆盖模板函数。
+func WithFixtureFuncs(funcs template.FuncMap) WithFixtureOption {
+	return func(l *FixtureLoader) {
+		for name, fn := range funcs {
+			l.funcs[name] = fn
+		}
+	}
+}
+
+// NewFixtureLoader 用来基于当前连接创建种子数据加载器。
+func (db *GormClient) NewFixtureLoader(opts ...WithFixtureOption) *FixtureLoader {
+	l := &FixtureLoader{
+		db:       db.DB,
+		truncate: true,
+		funcs:    defaultFixtureFuncs(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LoadFixtures 用来清空并按顺序重新加载种子数据，被引用的 fixture 需排在前面。
+func (db *GormClient) LoadFixtures(ctx context.Context, fixtures []Fixture, opts ...WithFixtureOption) (*FixtureSet, error) {
+	return db.NewFixtureLoader(opts...).Load(ctx, fixtures...)
+}
+
+// Funcs 返回模板函数，内置：
+//   - snowflake：GetSnowflakeID 生成的 ID
+//   - now、today：当前日期时间、当前日期
+//   - addDays n、addHours n、addMinutes n：相对当前时间的日期时间，n 为负数表示之前
+//   - addDate n：相对今天的日期
+//   - ref "<fixture>.<name>" [字段名]：已加载记录的主键或指定字段
+func (l *FixtureLoader) Funcs() template.FuncMap {
+	return l.funcs
+}
+
+// Load 用来在一个事务中清空并加载种子数据，清空按逆序进行以满足外键约束。
+func (l *FixtureLoader) Load(ctx context.Context, fixtures ...Fixture) (*FixtureSet, error) {
+	set := &FixtureSet{records: make(map[string]*fixtureRecord)}
+	err := WithTx(ctx, func(ctx context.Context) error {
+		tx := DB(ctx)
+		schemas := make([]*schema.Schema, len(fixtures))
+		for i, fixture := range fixtures {
+			sch, err := parseFixtureSchema(tx, fixture.Model)
+			if err != nil {
+				return err
+			}
+			schemas[i] = sch
+		}
+
+		if l.truncate {
+			for i := len(fixtures) - 1; i >= 0; i-- {
+				model := reflect.New(schemas[i].ModelType).Interface()
+				if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+					return fmt.Errorf("清空表 %s 失败: %w", schemas[i].Table, err)
+				}
+			}
+		}
+
+		for i, fixture := range fixtures {
+			if err := l.loadFixture(ctx, tx, set, fixture, schemas[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, WithTxDB(l.db))
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (l *FixtureLoader) loadFixture(ctx context.Context, tx *gorm.DB, set *FixtureSet, fixture Fixture, sch *schema.Schema) error {
+	prefix := fixture.Name
+	if prefix == "" {
+		prefix = sch.Table
+	}
+
+	// 未设置符号名的行以行号命名，直接映射的 Excel 行排在 Rows 之前
+	loaded := 0
+	if fixture.File != "" && fixture.ExcelRow == nil && strings.EqualFold(filepath.Ext(fixture.File), ".xlsx") {
+		count, err := l.loadExcelModels(tx, set, fixture, sch, prefix)
+		if err != nil {
+			return err
+		}
+		loaded = count
+		fixture.File = ""
+	}
+
+	rows, err := readFixtureRows(fixture)
+	if err != nil {
+		return err
+	}
+
+	funcs := make(template.FuncMap, len(l.funcs)+1)
+	for name, fn := range l.funcs {
+		funcs[name] = fn
+	}
+	funcs["ref"] = func(name string, field ...string) (any, error) {
+		return set.ref(ctx, name, field...)
+	}
+
+	for i, row := range rows {
+		name := fmt.Sprintf("%s.%d", prefix, loaded+i+1)
+		if value, ok := row[fixtureNameKey]; ok {
+			name = fmt.Sprintf("%s.%v", prefix, value)
+		}
+		if _, ok := set.records[name]; ok {
+			return fmt.Errorf("种子数据 %s 重复", name)
+		}
+
+		value := reflect.New(sch.ModelType)
+		for key, raw := range row {
+			if key == fixtureNameKey {
+				continue
+			}
+			field := sch.LookUpField(key)
+			if field == nil {
+				return fmt.Errorf("种子数据 %s 中的字段 %s 不存在", name, key)
+			}
+			raw, err = renderFixtureValue(raw, funcs)
+			if err != nil {
+				return fmt.Errorf("种子数据 %s 字段 %s 模板错误: %w", name, key, err)
+			}
+			if err = setFixtureField(ctx, field, value.Elem(), raw); err != nil {
+				return fmt.Errorf("种子数据 %s 字段 %s 赋值失败: %w", name, key, err)
+			}
+		}
+
+		if err = tx.Create(value.Interface()).Error; err != nil {
+			return fmt.Errorf("写入种子数据 %s 失败: %w", name, err)
+		}
+		set.add(name, sch, value)
+	}
+	return nil
+}
+
+// loadExcelModels 用来把 Excel 直接映射为模型切片后写入。
+func (l *FixtureLoader) loadExcelModels(tx *gorm.DB, set *FixtureSet, fixture Fixture, sch *schema.Schema, prefix string) (int, error) {
+	models := reflect.New(reflect.SliceOf(sch.ModelType))
+	if err := InitExcelMapper(fixture.ExcelOptions...).MapToStructs(fixture.File, models.Interface()); err != nil {
+		return 0, fmt.Errorf("读取种子数据 %s 失败: %w", fixture.File, err)
+	}
+	for i := 0; i < models.Elem().Len(); i++ {
+		value := models.Elem().Index(i).Addr()
+		name := fmt.Sprintf("%s.%d", prefix, i+1)
+		if err := tx.Create(value.Interface()).Error; err != nil {
+			return 0, fmt.Errorf("写入种子数据 %s 失败: %w", name, err)
+		}
+		set.add(name, sch, value)
+	}
+	return models.Elem().Len(), nil
+}
+
+func (s *FixtureSet) add(name string, sch *schema.Schema, value reflect.Value) {
+	s.records[name] = &fixtureRecord{schema: sch, value: value}
+	s.names = append(s.names, name)
+}
+
+func (s *FixtureSet) ref(ctx context.Context, name string, field ...string) (any, error) {
+	record, ok := s.records[name]
+	if !ok {
+		return nil, fmt.Errorf("引用的种子数据 %s 不存在或尚未加载", name)
+	}
+	target := record.schema.PrioritizedPrimaryField
+	if len(field) > 0 {
+		target = record.schema.LookUpField(field[0])
+	}
+	if target == nil {
+		return nil, fmt.Errorf("引用的种子数据 %s 缺少字段 %v", name, field)
+	}
+	value, _ := target.ValueOf(ctx, record.value.Elem())
+	return value, nil
+}
+
+func parseFixtureSchema(tx *gorm.DB, model any) (*schema.Schema, error) {
+	if model == nil {
+		return nil, fmt.Errorf("种子数据缺少 Model")
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("解析模型 %T 失败: %w", model, err)
+	}
+	return stmt.Schema, nil
+}
+
+// readFixtureRows 用来读取 YAML/JSON 文件、Excel 行结构体和 Rows 中的数据。
+func readFixtureRows(fixture Fixture) ([]map[string]any, error) {
+	var rows []map[string]any
+	if fixture.File != "" {
+		if strings.EqualFold(filepath.Ext(fixture.File), ".xlsx") {
+			excelRows, err := readFixtureExcelRows(fixture)
+			if err != nil {
+				return nil, err
+			}
+			rows = excelRows
+		} else if err := InitConfig(fixture.File, &rows); err != nil {
+			return nil, fmt.Errorf("读取种子数据 %s 失败: %w", fixture.File, err)
+		}
+	}
+	return append(rows, fixture.Rows...), nil
+}
+
+// readFixtureExcelRows 用来通过 ExcelMapper 读取行结构体并转换为键值，零值指针视为未设置。
+func readFixtureExcelRows(fixture Fixture) ([]map[string]any, error) {
+	rowType := reflect.TypeOf(fixture.ExcelRow)
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ExcelRow 必须是结构体")
+	}
+
+	excelRows := reflect.New(reflect.SliceOf(rowType))
+	if err := InitExcelMapper(fixture.ExcelOptions...).MapToStructs(fixture.File, excelRows.Interface()); err != nil {
+		return nil, fmt.Errorf("读取种子数据 %s 失败: %w", fixture.File, err)
+	}
+
+	rows := make([]map[string]any, 0, excelRows.Elem().Len())
+	for i := 0; i < excelRows.Elem().Len(); i++ {
+		excelRow := excelRows.Elem().Index(i)
+		row := make(map[string]any, rowType.NumField())
+		for j := 0; j < rowType.NumField(); j++ {
+			structField := rowType.Field(j)
+			if !structField.IsExported() {
+				continue
+			}
+			key := structField.Tag.Get(fixtureTag)
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = structField.Name
+			}
+			value := excelRow.Field(j)
+			if value.Kind() == reflect.Ptr && value.IsNil() {
+				continue
+			}
+			if key == fixtureNameKey && value.IsZero() {
+				continue
+			}
+			row[key] = value.Interface()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// renderFixtureValue 用来渲染字符串中的模板，其余值原样返回。
+func renderFixtureValue(raw any, funcs template.FuncMap) (any, error) {
+	text, ok := raw.(string)
+	if !ok || !strings.Contains(text, "{{") {
+		return raw, nil
+	}
+	tpl, err := template.New("fixture").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf strings.Builder
+	if err = tpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
+
+// setFixtureField 用来为字段赋值，对象和数组按 JSON 解码到字段类型，适用于 JSON 列和数组列。
+func setFixtureField(ctx context.Context, field *schema.Field, value reflect.Value, raw any) error {
+	switch raw.(type) {
+	case map[string]any, []any:
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		decoded := reflect.New(field.FieldType)
+		if err = json.Unmarshal(data, decoded.Interface()); err != nil {
+			return err
+		}
+		raw = decoded.Elem().Interface()
+	case string:
+		converted, err := convertFixtureString(raw.(string), field.FieldType)
+		if err != nil {
+			return err
+		}
+		raw = converted
+	}
+	return field.Set(ctx, value, raw)
+}
+
+// convertFixtureString 用来把字符串转换为字段类型，实现了 sql.Scanner 的类型（如 DateTime、decimal.Decimal）通过 Scan 解析，
+// 数值和布尔按 Cast 规则转换，其余类型交给 gorm 处理。
+func convertFixtureString(text string, fieldType reflect.Type) (any, error) {
+	baseType := fieldType
+	if baseType.Kind() == reflect.Ptr {
+		baseType = baseType.Elem()
+	}
+
+	if scanner, ok := reflect.New(baseType).Interface().(sql.Scanner); ok {
+		if err := scanner.Scan(text); err != nil {
+			return nil, err
+		}
+		if fieldType.Kind() == reflect.Ptr {
+			return scanner, nil
+		}
+		return reflect.ValueOf(scanner).Elem().Interface(), nil
+	}
+
+	var (
+		converted any
+		err       error
+	)
+	switch baseType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		converted, err = castInt64(text)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		converted, err = castUint64(text)
+	case reflect.Float32, reflect.Float64:
+		converted, err = castFloat64(text)
+	case reflect.Bool:
+		converted, err = castBool(text)
+	default:
+		return text, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := reflect.ValueOf(converted).Convert(baseType)
+	if fieldType.Kind() == reflect.Ptr {
+		ptr := reflect.New(baseType)
+		ptr.Elem().Set(result)
+		return ptr.Interface(), nil
+	}
+	return result.Interface(), nil
+}
+
+func defaultFixtureFuncs() template.FuncMap {
+	return template.FuncMap{
+		"snowflake": GetSnowflakeIDErr,
+		"now": func() string {
+			return NowAsDateTime().String()
+		},
+		"today": func() string {
+			return NowAsDateOnly().String()
+		},
+		"addDays": func(days int) string {
+			return ToDateTime(Now().AddDate(0, 0, days)).String()
+		},
+		"addHours": func(hours int) string {
+			return ToDateTime(Now().Add(time.Duration(hours) * time.Hour)).String()
+		},
+		"addMinutes": func(minutes int) string {
+			return ToDateTime(NowAddMinutes(minutes)).String()
+		},
+		"addDate": func(days int) string {
+			return NowAsDateOnly().AddDays(days).String()
+		},
+	}
+}
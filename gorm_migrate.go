@@ -0,0 +1,761 @@
+package wd
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMigrateTable       = "schema_migrations"
+	defaultMigrateLockKey     = "schema-migrate-lock"
+	defaultMigrateLockTimeout = 10 * time.Minute
+
+	// migrateNoTransactionDirective 写在 SQL 文件首行时该迁移不包裹事务，例如 CREATE INDEX CONCURRENTLY。
+	migrateNoTransactionDirective = "-- wd:no-transaction"
+)
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)\.sql$`)
+
+// MigrationFunc Go 迁移函数，tx 在迁移包裹事务时为事务连接。
+type MigrationFunc func(ctx context.Context, tx *gorm.DB) error
+
+// Migration 一个版本的迁移，SQL 迁移来自 fs.FS，Go 迁移通过 WithMigratorGoMigrations 注册。
+type Migration struct {
+	Version int64
+	Name    string
+	Up      MigrationFunc
+	Down    MigrationFunc
+	UpSQL   string
+	DownSQL string
+
+	// NoTransaction 为 true 时不包裹事务执行
+	NoTransaction bool
+}
+
+// Checksum 返回 SQL 迁移 up 脚本的 sha256，Go 迁移返回空字符串。
+func (m *Migration) Checksum() string {
+	if m.UpSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) hasDown() bool {
+	return m.Down != nil || m.DownSQL != ""
+}
+
+// SchemaMigration 迁移历史表中的一条记录。
+type SchemaMigration struct {
+	Version     int64     `gorm:"column:version;primaryKey;autoIncrement:false" json:"version"`
+	Name        string    `gorm:"column:name;type:varchar(255);not null" json:"name"`
+	Checksum    string    `gorm:"column:checksum;type:varchar(64);not null;default:''" json:"checksum"`
+	ExecutionMs int64     `gorm:"column:execution_ms;not null;default:0" json:"execution_ms"`
+	AppliedAt   time.Time `gorm:"column:applied_at;not null" json:"applied_at"`
+}
+
+// TableName 返回默认的迁移历史表名。
+func (SchemaMigration) TableName() string {
+	return defaultMigrateTable
+}
+
+// MigrationStatus 单个版本的迁移状态。
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+	// Drifted 表示已执行脚本的校验和与当前文件不一致
+	Drifted bool `json:"drifted"`
+	// Missing 表示历史表中存在但迁移源中已找不到该版本
+	Missing bool `json:"missing"`
+}
+
+// MigrateLockMode 多实例部署时保证只有一个实例执行迁移的加锁方式。
+type MigrateLockMode string
+
+const (
+	MigrateLockAuto  MigrateLockMode = "auto"  // InsRedis 已初始化时使用 Redis 锁，否则使用数据库锁
+	MigrateLockRedis MigrateLockMode = "redis" // redsync 分布式锁
+	MigrateLockDB    MigrateLockMode = "db"    // MySQL GET_LOCK / Postgres pg_advisory_lock，SQLite 不加锁
+	MigrateLockNone  MigrateLockMode = "none"
+)
+
+// Migrator 版本化迁移执行器。
+type Migrator struct {
+	db           *gorm.DB
+	table        string
+	fsys         fs.FS
+	dir          string
+	goMigrations []*Migration
+	dryRun       bool
+	allowDrift   bool
+	lockMode     MigrateLockMode
+	lockKey      string
+	lockTimeout  time.Duration
+	logf         func(format string, args ...any)
+}
+
+type WithMigratorOption func(*Migrator)
+
+// WithMigratorFS 指定 SQL 迁移所在的文件系统和目录，文件名格式为 <version>_<name>.up.sql / <version>_<name>.down.sql。
+func WithMigratorFS(fsys fs.FS, dir string) WithMigratorOption {
+	return func(m *Migrator) {
+		m.fsys = fsys
+		m.dir = dir
+	}
+}
+
+// WithMigratorGoMigrations 注册 Go 迁移，版本号不能与 SQL 迁移重复。
+func WithMigratorGoMigrations(migrations ...*Migration) WithMigratorOption {
+	return func(m *Migrator) {
+		m.goMigrations = append(m.goMigrations, migrations...)
+	}
+}
+
+// WithMigratorTable 设置迁移历史表名，默认 schema_migrations。
+func WithMigratorTable(table string) WithMigratorOption {
+	return func(m *Migrator) {
+		if table != "" {
+			m.table = table
+		}
+	}
+}
+
+// WithMigratorDryRun 只输出执行计划和 SQL，不执行也不写历史表。
+func WithMigratorDryRun(dryRun bool) WithMigratorOption {
+	return func(m *Migrator) {
+		m.dryRun = dryRun
+	}
+}
+
+// WithMigratorAllowDrift 允许已执行脚本的校验和与当前文件不一致，默认发现不一致时拒绝执行。
+func WithMigratorAllowDrift(allow bool) WithMigratorOption {
+	return func(m *Migrator) {
+		m.allowDrift = allow
+	}
+}
+
+// WithMigratorLock 设置加锁方式、锁键名和最长等待时间。
+func WithMigratorLock(mode MigrateLockMode, key string, timeout time.Duration) WithMigratorOption {
+	return func(m *Migrator) {
+		if mode != "" {
+			m.lockMode = mode
+		}
+		if key != "" {
+			m.lockKey = key
+		}
+		if timeout > 0 {
+			m.lockTimeout = timeout
+		}
+	}
+}
+
+// WithMigratorLogger 设置迁移过程的日志输出，默认使用标准库 log.Printf。
+func WithMigratorLogger(logf func(format string, args ...any)) WithMigratorOption {
+	return func(m *Migrator) {
+		if logf != nil {
+			m.logf = logf
+		}
+	}
+}
+
+// NewMigrator 用来基于当前连接创建迁移执行器。
+func (db *GormClient) NewMigrator(opts ...WithMigratorOption) *Migrator {
+	m := &Migrator{
+		db:          db.DB,
+		table:       defaultMigrateTable,
+		lockMode:    MigrateLockAuto,
+		lockKey:     defaultMigrateLockKey,
+		lockTimeout: defaultMigrateLockTimeout,
+		logf:        log.Printf,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Migrate 用来在应用启动时执行全部待执行的迁移。
+func (db *GormClient) Migrate(ctx context.Context, opts ...WithMigratorOption) error {
+	_, err := db.NewMigrator(opts...).Up(ctx)
+	return err
+}
+
+// Migrations 返回按版本升序排列的全部迁移。
+func (m *Migrator) Migrations() ([]*Migration, error) {
+	byVersion := make(map[int64]*Migration)
+	if m.fsys != nil {
+		dir := m.dir
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := fs.ReadDir(m.fsys, dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移目录失败: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+			if matches == nil {
+				continue
+			}
+			version, err := strconv.ParseInt(matches[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("迁移文件 %s 版本号无效: %w", entry.Name(), err)
+			}
+			content, err := fs.ReadFile(m.fsys, path.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			migration, ok := byVersion[version]
+			if !ok {
+				migration = &Migration{Version: version, Name: matches[2]}
+				byVersion[version] = migration
+			} else if migration.Name != matches[2] {
+				return nil, fmt.Errorf("迁移版本 %d 存在多个名称: %s、%s", version, migration.Name, matches[2])
+			}
+			if matches[3] == "up" {
+				migration.UpSQL = string(content)
+				migration.NoTransaction = strings.HasPrefix(strings.TrimSpace(migration.UpSQL), migrateNoTransactionDirective)
+			} else {
+				migration.DownSQL = string(content)
+			}
+		}
+	}
+
+	for _, migration := range m.goMigrations {
+		if migration == nil {
+			continue
+		}
+		if migration.Up == nil {
+			return nil, fmt.Errorf("Go 迁移 %d 缺少 Up", migration.Version)
+		}
+		if _, ok := byVersion[migration.Version]; ok {
+			return nil, fmt.Errorf("迁移版本 %d 重复", migration.Version)
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == nil && migration.UpSQL == "" {
+			return nil, fmt.Errorf("迁移版本 %d 缺少 up 脚本", migration.Version)
+		}
+		migrations = append(migrations, migration)
+	}
+	slices.SortFunc(migrations, func(a, b *Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Status 返回全部迁移以及历史表中已执行版本的状态。
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatuses(migrations, applied), nil
+}
+
+// Up 执行全部待执行的迁移，返回本次执行（dry-run 时为计划执行）的迁移。
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo 执行版本号不大于 target 的待执行迁移，target<=0 表示全部。
+func (m *Migrator) UpTo(ctx context.Context, target int64) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		migrations, applied, err := m.prepare(db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if target > 0 && migration.Version > target {
+				break
+			}
+			if err = m.run(ctx, db, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// DownTo 按版本号倒序回滚所有大于 target 的已执行迁移，target 为 0 表示全部回滚。
+func (m *Migrator) DownTo(ctx context.Context, target int64) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		migrations, applied, err := m.prepare(db)
+		if err != nil {
+			return err
+		}
+		byVersion := make(map[int64]*Migration, len(migrations))
+		for _, migration := range migrations {
+			byVersion[migration.Version] = migration
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			if version > target {
+				versions = append(versions, version)
+			}
+		}
+		slices.Sort(versions)
+		slices.Reverse(versions)
+		for _, version := range versions {
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("迁移版本 %d 已执行但迁移源中不存在，无法回滚", version)
+			}
+			if !migration.hasDown() {
+				return fmt.Errorf("迁移版本 %d 没有 down 脚本，无法回滚", version)
+			}
+			if err = m.run(ctx, db, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// prepare 用来建表、加载迁移并检查校验和漂移。
+func (m *Migrator) prepare(db *gorm.DB) ([]*Migration, map[int64]SchemaMigration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !m.dryRun {
+		if err = db.Table(m.table).AutoMigrate(&SchemaMigration{}); err != nil {
+			return nil, nil, fmt.Errorf("创建迁移历史表失败: %w", err)
+		}
+	}
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !m.allowDrift {
+		var drifted []string
+		for _, status := range migrationStatuses(migrations, applied) {
+			if status.Drifted {
+				drifted = append(drifted, strconv.FormatInt(status.Version, 10))
+			}
+		}
+		if len(drifted) > 0 {
+			return nil, nil, fmt.Errorf("迁移脚本已被修改(校验和不一致): %s", strings.Join(drifted, ","))
+		}
+	}
+	return migrations, applied, nil
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	applied := make(map[int64]SchemaMigration)
+	if !db.Migrator().HasTable(m.table) {
+		return applied, nil
+	}
+	var records []SchemaMigration
+	if err := db.Table(m.table).Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func migrationStatuses(migrations []*Migration, applied map[int64]SchemaMigration) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	known := make(map[int64]struct{}, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = struct{}{}
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			checksum := migration.Checksum()
+			status.Drifted = record.Checksum != "" && checksum != "" && record.Checksum != checksum
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		if _, ok := known[version]; ok {
+			continue
+		}
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses
+}
+
+// run 用来执行单个迁移的 up 或 down，并在同一事务中写入或删除历史记录。
+func (m *Migrator) run(ctx context.Context, db *gorm.DB, migration *Migration, up bool) error {
+	direction, script, fn := "up", migration.UpSQL, migration.Up
+	if !up {
+		direction, script, fn = "down", migration.DownSQL, migration.Down
+	}
+
+	if m.dryRun {
+		m.logf("[migrate] dry-run %s %d_%s", direction, migration.Version, migration.Name)
+		if fn != nil {
+			m.logf("[migrate]   (Go 迁移)")
+		}
+		for _, statement := range splitSQLStatements(script) {
+			m.logf("[migrate]   %s;", statement)
+		}
+		return nil
+	}
+
+	m.logf("[migrate] %s %d_%s", direction, migration.Version, migration.Name)
+	start := time.Now()
+	apply := func(tx *gorm.DB) error {
+		if fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				return err
+			}
+		} else {
+			for _, statement := range splitSQLStatements(script) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return fmt.Errorf("执行语句失败: %s: %w", statement, err)
+				}
+			}
+		}
+
+		if !up {
+			return tx.Table(m.table).Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		}
+		return tx.Table(m.table).Create(&SchemaMigration{
+			Version:     migration.Version,
+			Name:        migration.Name,
+			Checksum:    migration.Checksum(),
+			ExecutionMs: time.Since(start).Milliseconds(),
+			AppliedAt:   time.Now(),
+		}).Error
+	}
+
+	var err error
+	if migration.NoTransaction {
+		err = apply(db)
+	} else {
+		err = db.Transaction(apply)
+	}
+	if err != nil {
+		return fmt.Errorf("迁移 %d_%s %s 失败: %w", migration.Version, migration.Name, direction, err)
+	}
+	return nil
+}
+
+// withLock 用来在加锁后执行 fn，数据库锁需要在同一个连接上加锁和释放，因此 fn 收到的是固定连接。
+func (m *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	if m.db == nil {
+		return gormClientNilErr()
+	}
+	db := m.db.WithContext(ctx)
+
+	mode := m.lockMode
+	if mode == MigrateLockAuto {
+		mode = MigrateLockDB
+		if InsRedis != nil && InsRedis.UniversalClient != nil {
+			mode = MigrateLockRedis
+		}
+	}
+	if m.dryRun {
+		mode = MigrateLockNone
+	}
+
+	switch mode {
+	case MigrateLockNone:
+		return fn(db)
+	case MigrateLockRedis:
+		return m.withRedisLock(ctx, db, fn)
+	case MigrateLockDB:
+		return db.Connection(func(conn *gorm.DB) error {
+			return m.withDBLock(ctx, conn, fn)
+		})
+	default:
+		return fmt.Errorf("不支持的迁移加锁方式: %s", mode)
+	}
+}
+
+func (m *Migrator) withRedisLock(ctx context.Context, db *gorm.DB, fn func(db *gorm.DB) error) error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	expiry := 30 * time.Second
+	mutex := InsRedis.NewLock(m.lockKey,
+		redsync.WithExpiry(expiry),
+		redsync.WithTries(max(int(m.lockTimeout/time.Second), 1)),
+		redsync.WithRetryDelay(time.Second),
+	)
+	if err := mutex.LockContext(ctx); err != nil {
+		return fmt.Errorf("获取迁移锁失败: %w", err)
+	}
+	defer mutex.Unlock()
+
+	// 迁移耗时可能超过锁的有效期，后台定期续期
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(expiry / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, _ = mutex.Extend()
+			}
+		}
+	}()
+	return fn(db)
+}
+
+func (m *Migrator) withDBLock(ctx context.Context, conn *gorm.DB, fn func(db *gorm.DB) error) error {
+	switch GormDialect(conn.Dialector.Name()) {
+	case GormDialectMySQL:
+		var acquired *int
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", m.lockKey, int(m.lockTimeout/time.Second)).Scan(&acquired).Error; err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		if acquired == nil || *acquired != 1 {
+			return errors.New("获取迁移锁超时")
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", m.lockKey)
+	case GormDialectPostgres:
+		lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+		defer cancel()
+		key := migrateAdvisoryLockKey(m.lockKey)
+		if err := conn.WithContext(lockCtx).Exec("SELECT pg_advisory_lock(?)", key).Error; err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		defer conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", key)
+	}
+	return fn(conn)
+}
+
+func migrateAdvisoryLockKey(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// RunCommand 用来实现一个迁移命令行入口，args 形如：
+//
+//	up [-dry-run] [version]
+//	down [-dry-run] <version>
+//	status
+//
+// 例如在 main 中：if len(os.Args) > 1 && os.Args[1] == "migrate" { err = m.RunCommand(ctx, os.Args[2:], os.Stdout) }
+func (m *Migrator) RunCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("用法: migrate up|down|status [-dry-run] [version]")
+	}
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false, "只输出执行计划，不执行")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var target int64
+	if flags.NArg() > 0 {
+		version, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("版本号无效: %s", flags.Arg(0))
+		}
+		target = version
+	}
+
+	runner := *m
+	runner.dryRun = runner.dryRun || *dryRun
+	runner.logf = func(format string, args ...any) {
+		_, _ = fmt.Fprintf(out, format+"\n", args...)
+	}
+
+	switch command {
+	case "up":
+		done, err := runner.UpTo(ctx, target)
+		_, _ = fmt.Fprintf(out, "%s %d 个迁移\n", migrateCommandVerb(runner.dryRun, "已执行"), len(done))
+		return err
+	case "down":
+		if flags.NArg() == 0 {
+			return errors.New("down 需要指定目标版本，0 表示全部回滚")
+		}
+		done, err := runner.DownTo(ctx, target)
+		_, _ = fmt.Fprintf(out, "%s %d 个迁移\n", migrateCommandVerb(runner.dryRun, "已回滚"), len(done))
+		return err
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED_AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Format(time.DateTime)
+			}
+			if status.Drifted {
+				state = "drifted"
+			}
+			if status.Missing {
+				state = "missing"
+			}
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("未知的迁移命令: %s", command)
+	}
+}
+
+func migrateCommandVerb(dryRun bool, verb string) string {
+	if dryRun {
+		return "[dry-run] 计划" + strings.TrimPrefix(verb, "已")
+	}
+	return verb
+}
+
+// splitSQLStatements 用来按分号拆分 SQL 脚本，会跳过引号、注释和 Postgres $$ 块中的分号。
+func splitSQLStatements(script string) []string {
+	var (
+		statements  []string
+		current     strings.Builder
+		quote       rune
+		dollarTag   string
+		dollarStart int
+	)
+	runes := []rune(script)
+	flush := func() {
+		statement := strings.TrimSpace(current.String())
+		current.Reset()
+		if statement != "" && !isSQLCommentOnly(statement) {
+			statements = append(statements, statement)
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case dollarTag != "":
+			current.WriteRune(r)
+			if r == '$' && current.Len()-dollarStart >= len(dollarTag) && strings.HasSuffix(current.String(), dollarTag) {
+				dollarTag = ""
+			}
+		case quote != 0:
+			current.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			current.WriteRune(r)
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				current.WriteRune(runes[i])
+				i++
+			}
+			if i < len(runes) {
+				current.WriteRune('\n')
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			j := i + 2
+			for j+1 < len(runes) && (runes[j] != '*' || runes[j+1] != '/') {
+				j++
+			}
+			end := min(j+2, len(runes))
+			current.WriteString(string(runes[i:end]))
+			i = end - 1
+		case r == '$':
+			tag := sqlDollarTag(runes[i:])
+			current.WriteRune(r)
+			if tag != "" {
+				current.WriteString(tag[1:])
+				i += len([]rune(tag)) - 1
+				dollarTag = tag
+				dollarStart = current.Len()
+			}
+		case r == ';':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return statements
+}
+
+// sqlDollarTag 返回 $tag$ 形式的起始标记，不是标记时返回空字符串。
+func sqlDollarTag(runes []rune) string {
+	for i := 1; i < len(runes); i++ {
+		r := runes[i]
+		if r == '$' {
+			return string(runes[:i+1])
+		}
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9' && i > 1) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isSQLCommentOnly(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") && !(strings.HasPrefix(line, "/*") && strings.HasSuffix(line, "*/")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,493 @@
+package wd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	CtxKeyTenantID      = "tenant_id"
+	HeaderTenantID      = "X-Tenant-ID"
+	defaultTenantColumn = "tenant_id"
+
+	tenantSettingKey     = "wd:tenant_id"
+	tenantSkipSettingKey = "wd:tenant_skip"
+	tenantClauseKey      = "wd:tenant"
+)
+
+// ErrTenantRequired 严格模式下缺少租户信息时返回。
+var ErrTenantRequired = errors.New("缺少租户信息")
+
+// ErrTenantRawSQL 严格模式下对带租户列的模型执行原生 SQL 时返回，需要用 WithoutTenant 或 SkipTenant 显式跳过。
+var ErrTenantRawSQL = errors.New("原生 SQL 无法自动追加租户条件")
+
+// tenantColumns 记录已注册插件使用的租户列，供 Repository 判断模型是否需要租户隔离。
+var tenantColumns sync.Map
+
+type tenantContextKey struct{}
+
+type tenantSkipContextKey struct{}
+
+// WithTenant 用来把租户 ID 写入 ctx，之后经由该 ctx 的 GORM 操作都会按租户隔离。
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// WithoutTenant 用来标记 ctx 跳过租户隔离，适用于管理后台、定时任务等需要跨租户的场景。
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantSkipContextKey{}, true)
+}
+
+// TenantFromContext 用来从 ctx 中取出租户 ID，同时兼容直接传入 *gin.Context 的写法。
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	if tenantID, ok := ctx.Value(tenantContextKey{}).(string); ok && tenantID != "" {
+		return tenantID, true
+	}
+	if tenantID, ok := ctx.Value(CtxKeyTenantID).(string); ok && tenantID != "" {
+		return tenantID, true
+	}
+	return "", false
+}
+
+// IsTenantSkipped 判断 ctx 是否被标记为跳过租户隔离。
+func IsTenantSkipped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(tenantSkipContextKey{}).(bool)
+	return skip
+}
+
+// GetTenantID 用来读取 MiddlewareTenant 写入的租户 ID。
+func GetTenantID(c *gin.Context) string {
+	return c.GetString(CtxKeyTenantID)
+}
+
+// SkipTenant 是一个 GORM scope，用于单条语句跳过租户隔离：db.Scopes(wd.SkipTenant)。
+func SkipTenant(db *gorm.DB) *gorm.DB {
+	return db.Set(tenantSkipSettingKey, true)
+}
+
+// TenantScope 返回一个 GORM scope，用于显式指定本条语句的租户，优先级高于 ctx。
+func TenantScope(tenantID string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(tenantSettingKey, tenantID)
+	}
+}
+
+// TenantResolver 用来从请求中解析租户 ID，返回空字符串表示未找到。
+type TenantResolver func(c *gin.Context) (string, error)
+
+// TenantFromHeader 从请求头读取租户 ID，请求头由客户端控制，必须通过 validate 校验当前用户是否属于该租户。
+// validate 返回的 *AppError 原样响应，其余错误按 403 处理。
+func TenantFromHeader(header string, validate func(c *gin.Context, tenantID string) error) TenantResolver {
+	if validate == nil {
+		panic("TenantFromHeader 需要校验函数，防止客户端伪造请求头访问其他租户")
+	}
+	return func(c *gin.Context) (string, error) {
+		tenantID := strings.TrimSpace(c.GetHeader(header))
+		if tenantID == "" {
+			return "", nil
+		}
+		if err := validate(c, tenantID); err != nil {
+			var appErr *AppError
+			if errors.As(err, &appErr) {
+				return "", appErr
+			}
+			return "", MsgErrForbiddenAuth("无权访问该租户", err)
+		}
+		return tenantID, nil
+	}
+}
+
+// TenantFromClaims 通过 ExtractClaimsAs 读取 JWT 载荷，再由 fn 取出租户 ID，需挂在 JWT 中间件之后。
+func TenantFromClaims[P any](fn func(payload P) string) TenantResolver {
+	return func(c *gin.Context) (string, error) {
+		if _, exists := c.Get(CtxKeyJWTPayload); !exists {
+			return "", nil
+		}
+		payload, err := ExtractClaimsAs[P](c)
+		if err != nil {
+			return "", err
+		}
+		return fn(payload), nil
+	}
+}
+
+type tenantMiddlewareConfig struct {
+	resolvers []TenantResolver
+	required  bool
+}
+
+// WithTenantMiddlewareOption 租户中间件的配置项。
+type WithTenantMiddlewareOption func(*tenantMiddlewareConfig)
+
+// WithTenantResolvers 设置租户解析器，按顺序取第一个非空结果，没有默认值，必须设置。
+func WithTenantResolvers(resolvers ...TenantResolver) WithTenantMiddlewareOption {
+	return func(cfg *tenantMiddlewareConfig) {
+		cfg.resolvers = resolvers
+	}
+}
+
+// WithTenantRequired 设置为 true 时，请求中没有租户信息直接返回 400。
+func WithTenantRequired(required bool) WithTenantMiddlewareOption {
+	return func(cfg *tenantMiddlewareConfig) {
+		cfg.required = required
+	}
+}
+
+// MiddlewareTenant 用来解析请求的租户 ID，写入 gin.Context 与 c.Request.Context()。
+// 必须通过 WithTenantResolvers 指定解析器，通常为 TenantFromClaims，或带成员校验的 TenantFromHeader。
+func MiddlewareTenant(opts ...WithTenantMiddlewareOption) gin.HandlerFunc {
+	cfg := &tenantMiddlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if len(cfg.resolvers) == 0 {
+		panic("租户中间件缺少解析器，需要使用WithTenantResolvers()设置")
+	}
+
+	return func(c *gin.Context) {
+		var tenantID string
+		for _, resolver := range cfg.resolvers {
+			resolved, err := resolver(c)
+			if err != nil {
+				var appErr *AppError
+				if !errors.As(err, &appErr) {
+					appErr = MsgErrBadRequest("租户信息解析失败", err)
+				}
+				ResponseError(c, appErr)
+				c.Abort()
+				return
+			}
+			if resolved != "" {
+				tenantID = resolved
+				break
+			}
+		}
+
+		if tenantID == "" {
+			if cfg.required {
+				ResponseError(c, MsgErrBadRequest(ErrTenantRequired.Error()))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Set(CtxKeyTenantID, tenantID)
+		c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenantID))
+		c.Next()
+	}
+}
+
+// TenantPlugin 是 GORM 插件：对带租户列的模型，查询、更新、删除自动追加租户条件，创建时自动写入租户列。
+// 原生 SQL（Raw/Exec）无法追加条件，严格模式下对带租户列的模型执行时返回 ErrTenantRawSQL；
+// 未通过 Model 指定模型的原生 SQL（包括 Raw(...).Scan）无从判断涉及的表，始终不做处理。
+type TenantPlugin struct {
+	column       string
+	strict       bool
+	ignoreTables map[string]struct{}
+}
+
+// WithTenantPluginOption 租户插件的配置项。
+type WithTenantPluginOption func(*TenantPlugin)
+
+// WithTenantColumn 设置租户列名，默认 tenant_id。
+func WithTenantColumn(column string) WithTenantPluginOption {
+	return func(p *TenantPlugin) {
+		p.column = column
+	}
+}
+
+// WithTenantStrict 开启严格模式：带租户列的模型在没有租户信息且未显式跳过时返回 ErrTenantRequired。
+func WithTenantStrict(strict bool) WithTenantPluginOption {
+	return func(p *TenantPlugin) {
+		p.strict = strict
+	}
+}
+
+// WithTenantIgnoreTables 设置不做租户隔离的表，例如各租户共享的字典表。
+func WithTenantIgnoreTables(tables ...string) WithTenantPluginOption {
+	return func(p *TenantPlugin) {
+		for _, table := range tables {
+			p.ignoreTables[table] = struct{}{}
+		}
+	}
+}
+
+// NewTenantPlugin 创建租户插件，通过 db.Use 注册。
+func NewTenantPlugin(opts ...WithTenantPluginOption) *TenantPlugin {
+	p := &TenantPlugin{
+		column:       defaultTenantColumn,
+		ignoreTables: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// UseTenant 返回可传给 InitGormDB 的初始化函数，用于在初始化时注册租户插件。
+func UseTenant(opts ...WithTenantPluginOption) func(db *gorm.DB) error {
+	return func(db *gorm.DB) error {
+		return db.Use(NewTenantPlugin(opts...))
+	}
+}
+
+// Name 实现 gorm.Plugin。
+func (p *TenantPlugin) Name() string {
+	return "wd:tenant"
+}
+
+// Initialize 实现 gorm.Plugin，注册各类回调。
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	tenantColumns.Store(p.column, struct{}{})
+	callbacks := db.Callback()
+	if err := callbacks.Raw().Before("gorm:raw").Register("wd:tenant_raw", p.beforeRaw); err != nil {
+		return err
+	}
+	if err := callbacks.Create().Before("gorm:create").Register("wd:tenant_create", p.beforeCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("wd:tenant_query", p.beforeQuery); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("wd:tenant_row", p.beforeQuery); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("wd:tenant_update", p.beforeModify); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("wd:tenant_delete", p.beforeModify)
+}
+
+// tenantField 用来判断当前语句的模型是否带租户列且未被跳过。
+func (p *TenantPlugin) tenantField(db *gorm.DB) (*schema.Field, bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return nil, false
+	}
+	if _, ok := p.ignoreTables[stmt.Table]; ok {
+		return nil, false
+	}
+	field := stmt.Schema.LookUpField(p.column)
+	if field == nil || field.DBName == "" {
+		return nil, false
+	}
+	if skip, ok := stmt.Settings.Load(tenantSkipSettingKey); (ok && skip == true) || IsTenantSkipped(stmt.Context) {
+		return nil, false
+	}
+	return field, true
+}
+
+// resolve 用来判断当前语句是否需要租户隔离，需要时返回租户列与转换后的租户值。
+func (p *TenantPlugin) resolve(db *gorm.DB) (*schema.Field, any, bool) {
+	stmt := db.Statement
+	field, ok := p.tenantField(db)
+	if !ok {
+		return nil, nil, false
+	}
+
+	tenantID, ok := "", false
+	if value, exists := stmt.Settings.Load(tenantSettingKey); exists {
+		tenantID, ok = value.(string)
+	}
+	if !ok || tenantID == "" {
+		tenantID, ok = TenantFromContext(stmt.Context)
+	}
+	if !ok {
+		if p.strict {
+			_ = db.AddError(fmt.Errorf("%w: 表 %s", ErrTenantRequired, stmt.Table))
+		}
+		return nil, nil, false
+	}
+
+	value := reflect.New(field.FieldType).Elem()
+	if err := patchFieldParseParam(tenantID, value); err != nil {
+		_ = db.AddError(fmt.Errorf("租户 ID 无法转换为列 %s 的类型: %w", field.DBName, err))
+		return nil, nil, false
+	}
+	return field, value.Interface(), true
+}
+
+func (p *TenantPlugin) addWhere(db *gorm.DB, field *schema.Field, tenant any) {
+	if _, ok := db.Statement.Clauses[tenantClauseKey]; ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+	}})
+	db.Statement.Clauses[tenantClauseKey] = clause.Clause{}
+}
+
+func (p *TenantPlugin) beforeQuery(db *gorm.DB) {
+	// Raw(...).Scan 在执行查询回调前已经生成了 SQL
+	if db.Statement.SQL.Len() > 0 {
+		p.beforeRaw(db)
+		return
+	}
+	if field, tenant, ok := p.resolve(db); ok {
+		p.addWhere(db, field, tenant)
+	}
+}
+
+// beforeRaw 用来在严格模式下拒绝对带租户列的模型执行原生 SQL。
+func (p *TenantPlugin) beforeRaw(db *gorm.DB) {
+	if !p.strict {
+		return
+	}
+	if _, ok := p.tenantField(db); ok {
+		_ = db.AddError(fmt.Errorf("%w: 表 %s", ErrTenantRawSQL, db.Statement.Table))
+	}
+}
+
+// beforeModify 用来给更新和删除追加租户条件；语句本身没有条件时不追加，保留 GORM 缺少 WHERE 的保护。
+func (p *TenantPlugin) beforeModify(db *gorm.DB) {
+	field, tenant, ok := p.resolve(db)
+	if !ok {
+		return
+	}
+	if !db.AllowGlobalUpdate && !tenantHasWhere(db.Statement) && !tenantHasPrimaryKey(db.Statement) {
+		return
+	}
+	p.addWhere(db, field, tenant)
+}
+
+// beforeCreate 用来给新记录写入租户列，已有值且与当前租户不同时返回错误。
+func (p *TenantPlugin) beforeCreate(db *gorm.DB) {
+	field, tenant, ok := p.resolve(db)
+	if !ok {
+		return
+	}
+
+	setRow := func(row reflect.Value) {
+		row = reflect.Indirect(row)
+		if row.Kind() != reflect.Struct {
+			return
+		}
+		current, isZero := field.ValueOf(db.Statement.Context, row)
+		if !isZero {
+			if !reflect.DeepEqual(current, tenant) {
+				_ = db.AddError(fmt.Errorf("不能写入其他租户的数据: %v", current))
+			}
+			return
+		}
+		if err := field.Set(db.Statement.Context, row, tenant); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]any:
+		tenantSetMap(db, dest, field, tenant)
+		return
+	case *map[string]any:
+		tenantSetMap(db, *dest, field, tenant)
+		return
+	case []map[string]any:
+		for _, row := range dest {
+			tenantSetMap(db, row, field, tenant)
+		}
+		return
+	}
+
+	reflectValue := db.Statement.ReflectValue
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range reflectValue.Len() {
+			setRow(reflectValue.Index(i))
+		}
+	default:
+		setRow(reflectValue)
+	}
+}
+
+func tenantSetMap(db *gorm.DB, row map[string]any, field *schema.Field, tenant any) {
+	for _, key := range []string{field.DBName, field.Name} {
+		if current, ok := row[key]; ok {
+			if fmt.Sprint(current) != fmt.Sprint(tenant) {
+				_ = db.AddError(fmt.Errorf("不能写入其他租户的数据: %v", current))
+			}
+			return
+		}
+	}
+	row[field.DBName] = tenant
+}
+
+func tenantHasWhere(stmt *gorm.Statement) bool {
+	where, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		return false
+	}
+	whereClause, _ := where.Expression.(clause.Where)
+	return len(whereClause.Exprs) > 0
+}
+
+// tenantHasPrimaryKey 判断 Model/Dest 是否带主键值，此时 GORM 会按主键生成条件。
+func tenantHasPrimaryKey(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil || len(stmt.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	hasPrimaryKey := func(row reflect.Value) bool {
+		row = reflect.Indirect(row)
+		if row.Kind() != reflect.Struct || row.Type() != stmt.Schema.ModelType {
+			return false
+		}
+		for _, field := range stmt.Schema.PrimaryFields {
+			if _, isZero := field.ValueOf(stmt.Context, row); !isZero {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, value := range []any{stmt.Model, stmt.Dest} {
+		reflectValue := reflect.Indirect(reflect.ValueOf(value))
+		if !reflectValue.IsValid() {
+			continue
+		}
+		switch reflectValue.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := range reflectValue.Len() {
+				if hasPrimaryKey(reflectValue.Index(i)) {
+					return true
+				}
+			}
+		default:
+			if hasPrimaryKey(reflectValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTenantModel 判断模型是否含有已注册租户插件的租户列。
+func isTenantModel(model any) bool {
+	modelSchema, err := parseModelSchema(model)
+	if err != nil {
+		return false
+	}
+	found := false
+	tenantColumns.Range(func(column, _ any) bool {
+		if field := modelSchema.LookUpField(column.(string)); field != nil && field.DBName != "" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,218 @@
+package wd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	mysqlErrLockDeadlock    = 1213
+	mysqlErrLockWaitTimeout = 1205
+
+	postgresErrDeadlock             = "40P01"
+	postgresErrSerializationFailure = "40001"
+
+	defaultTxRetryTimes   = 3
+	defaultTxRetryBackoff = 50 * time.Millisecond
+	maxTxRetryBackoff     = 2 * time.Second
+)
+
+type txContextKey struct{}
+
+// txScope 表示一层事务（最外层事务或一个保存点），用来收集提交后执行的回调。
+type txScope struct {
+	db    *gorm.DB
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
+}
+
+func (s *txScope) appendHooks(hooks ...func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hooks...)
+}
+
+func (s *txScope) takeHooks() []func(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := s.hooks
+	s.hooks = nil
+	return hooks
+}
+
+type txOptions struct {
+	db           *gorm.DB
+	sqlOptions   *sql.TxOptions
+	retryTimes   int
+	retryBackoff time.Duration
+}
+
+type WithTxOption func(*txOptions)
+
+// WithTxDB 指定开启事务使用的连接，默认 InsDB。
+func WithTxDB(db *gorm.DB) WithTxOption {
+	return func(o *txOptions) {
+		o.db = db
+	}
+}
+
+// WithTxSQLOptions 指定事务隔离级别、只读等选项，仅对最外层事务生效。
+func WithTxSQLOptions(opts *sql.TxOptions) WithTxOption {
+	return func(o *txOptions) {
+		o.sqlOptions = opts
+	}
+}
+
+// WithTxRetry 设置遇到死锁或锁等待超时时的重试次数和初始退避时间，times<=0 表示不重试。
+func WithTxRetry(times int, backoff time.Duration) WithTxOption {
+	return func(o *txOptions) {
+		o.retryTimes = times
+		if backoff > 0 {
+			o.retryBackoff = backoff
+		}
+	}
+}
+
+// WithTx 用来在事务中执行 fn，事务会写入 fn 收到的 ctx，通过 DB(ctx) 或 UseTx 获取。
+// 当前约定如下：
+// - ctx 中已存在事务时使用保存点嵌套，fn 返回错误只回滚到该保存点
+// - 最外层事务遇到死锁、锁等待超时或序列化失败时按指数退避整体重试，默认 3 次，见 IsRetryableTxError
+// - AfterCommit 注册的回调只在最外层事务提交成功后执行，回滚的保存点内注册的回调会被丢弃
+func WithTx(ctx context.Context, fn func(ctx context.Context) error, opts ...WithTxOption) error {
+	if parent := txScopeFromContext(ctx); parent != nil {
+		return runTxScope(ctx, parent.db, parent, nil, fn)
+	}
+
+	options := txOptions{
+		retryTimes:   defaultTxRetryTimes,
+		retryBackoff: defaultTxRetryBackoff,
+	}
+	if InsDB != nil {
+		options.db = InsDB.DB
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.db == nil {
+		return gormClientNilErr()
+	}
+
+	backoff := options.retryBackoff
+	for attempt := 0; ; attempt++ {
+		var hooks []func(ctx context.Context)
+		err := runTxScope(ctx, options.db.WithContext(ctx), nil, options.sqlOptions, func(txCtx context.Context) error {
+			if err := fn(txCtx); err != nil {
+				return err
+			}
+			hooks = txScopeFromContext(txCtx).takeHooks()
+			return nil
+		})
+		if err == nil {
+			for _, hook := range hooks {
+				hook(ctx)
+			}
+			return nil
+		}
+		if attempt >= options.retryTimes || !IsRetryableTxError(err) {
+			return err
+		}
+
+		wait := backoff + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, maxTxRetryBackoff)
+	}
+}
+
+func runTxScope(ctx context.Context, db *gorm.DB, parent *txScope, sqlOptions *sql.TxOptions, fn func(ctx context.Context) error) error {
+	var txOpts []*sql.TxOptions
+	if sqlOptions != nil {
+		txOpts = append(txOpts, sqlOptions)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		scope := &txScope{db: tx}
+		if err := fn(context.WithValue(ctx, txContextKey{}, scope)); err != nil {
+			return err
+		}
+		// 保存点成功释放后，回调上交给外层事务
+		if parent != nil {
+			parent.appendHooks(scope.takeHooks()...)
+		}
+		return nil
+	}, txOpts...)
+}
+
+func txScopeFromContext(ctx context.Context) *txScope {
+	if ctx == nil {
+		return nil
+	}
+	scope, _ := ctx.Value(txContextKey{}).(*txScope)
+	return scope
+}
+
+// InTx 判断 ctx 中是否存在事务。
+func InTx(ctx context.Context) bool {
+	return txScopeFromContext(ctx) != nil
+}
+
+// DB 返回 ctx 中的事务连接，不存在事务时返回绑定了 ctx 的 InsDB。
+func DB(ctx context.Context) *gorm.DB {
+	if scope := txScopeFromContext(ctx); scope != nil {
+		return scope.db.WithContext(ctx)
+	}
+	if InsDB == nil || InsDB.DB == nil {
+		panic(gormClientNilErr())
+	}
+	return InsDB.WithContext(ctx)
+}
+
+type genConnPoolReplacer interface {
+	ReplaceConnPool(pool gorm.ConnPool)
+}
+
+// UseTx 让 gorm/gen 查询对象使用 ctx 中的事务连接，例如 wd.UseTx(ctx, query.User.WithContext(ctx))。
+// ctx 中不存在事务时原样返回。
+func UseTx[D any](ctx context.Context, do D) D {
+	scope := txScopeFromContext(ctx)
+	if scope == nil {
+		return do
+	}
+	if replacer, ok := any(do).(genConnPoolReplacer); ok {
+		replacer.ReplaceConnPool(scope.db.Statement.ConnPool)
+	}
+	return do
+}
+
+// AfterCommit 注册事务提交成功后执行的回调，ctx 中不存在事务时立即执行。
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	scope := txScopeFromContext(ctx)
+	if scope == nil {
+		fn(ctx)
+		return
+	}
+	scope.appendHooks(fn)
+}
+
+// IsRetryableTxError 判断错误是否为可重试的 MySQL 死锁、锁等待超时或 Postgres 死锁、序列化失败。
+func IsRetryableTxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrLockDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == postgresErrDeadlock || pgErr.Code == postgresErrSerializationFailure
+	}
+	return false
+}
@@ -0,0 +1,765 @@
+package wd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultJobQueuePrefix       = "job-queue:"
+	defaultJobQueueGroup        = "default"
+	defaultJobQueueConcurrency  = 10
+	defaultJobQueueVisibility   = 5 * time.Minute
+	defaultJobQueuePollInterval = time.Second
+	defaultJobQueueMaxAttempts  = 5
+	defaultJobQueueBackoff      = 5 * time.Second
+	defaultJobQueueMaxBackoff   = 10 * time.Minute
+	defaultJobQueueDrainTimeout = 30 * time.Second
+	jobQueueMoveBatch           = 100
+)
+
+// ErrJobNoRetry 表示任务失败后不再重试，直接进入死信。
+var ErrJobNoRetry = errors.New("任务不再重试")
+
+// JobNoRetry 用来包装处理函数返回的错误，让任务跳过重试直接进入死信，例如参数错误。
+func JobNoRetry(err error) error {
+	return fmt.Errorf("%w: %w", ErrJobNoRetry, err)
+}
+
+// InsJobQueue 是全局的任务队列。
+var InsJobQueue *JobQueue
+
+// Job 是队列中的一个任务，Attempts 为已经失败的次数。
+type Job struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Payload    string    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	LastError  string    `json:"last_error"`
+
+	streamID string
+}
+
+// Bind 用来把任务参数解析到 dest。
+func (j *Job) Bind(dest any) error {
+	return json.Unmarshal([]byte(j.Payload), dest)
+}
+
+func (j *Job) values() map[string]any {
+	return map[string]any{
+		"id":          j.ID,
+		"type":        j.Type,
+		"payload":     j.Payload,
+		"attempts":    strconv.Itoa(j.Attempts),
+		"enqueued_at": strconv.FormatInt(j.EnqueuedAt.UnixMilli(), 10),
+		"last_error":  j.LastError,
+	}
+}
+
+// envelope 用来生成延迟集合中的成员，字段都是字符串，方便 Lua 直接写入 Stream。
+func (j *Job) envelope() string {
+	data, _ := json.Marshal(map[string]string{
+		"id":          j.ID,
+		"type":        j.Type,
+		"payload":     j.Payload,
+		"attempts":    strconv.Itoa(j.Attempts),
+		"enqueued_at": strconv.FormatInt(j.EnqueuedAt.UnixMilli(), 10),
+		"last_error":  j.LastError,
+	})
+	return string(data)
+}
+
+func jobFromMessage(msg redis.XMessage) *Job {
+	field := func(key string) string {
+		v, _ := msg.Values[key].(string)
+		return v
+	}
+	attempts, _ := strconv.Atoi(field("attempts"))
+	enqueuedAt, _ := strconv.ParseInt(field("enqueued_at"), 10, 64)
+	return &Job{
+		ID:         field("id"),
+		Type:       field("type"),
+		Payload:    field("payload"),
+		Attempts:   attempts,
+		EnqueuedAt: time.UnixMilli(enqueuedAt).In(ShangHaiTimeLocation),
+		LastError:  field("last_error"),
+		streamID:   msg.ID,
+	}
+}
+
+type jobHandler struct {
+	fn          func(ctx context.Context, job *Job) error
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	timeout     time.Duration
+	sem         chan struct{}
+}
+
+// WithJobHandlerOption 任务处理函数的配置项。
+type WithJobHandlerOption func(*jobHandler)
+
+// WithJobHandlerRetry 设置该类任务的最大执行次数与指数退避的初始、最大间隔，默认沿用队列配置。
+func WithJobHandlerRetry(maxAttempts int, backoff, maxBackoff time.Duration) WithJobHandlerOption {
+	return func(h *jobHandler) {
+		if maxAttempts > 0 {
+			h.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			h.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			h.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithJobHandlerTimeout 设置单次执行的超时时间，默认不限制。
+func WithJobHandlerTimeout(timeout time.Duration) WithJobHandlerOption {
+	return func(h *jobHandler) {
+		if timeout > 0 {
+			h.timeout = timeout
+		}
+	}
+}
+
+// WithJobHandlerConcurrency 限制该类任务同时执行的数量，等待期间会占用队列的并发名额。
+func WithJobHandlerConcurrency(n int) WithJobHandlerOption {
+	return func(h *jobHandler) {
+		if n > 0 {
+			h.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+type jobEnqueueConfig struct {
+	id    string
+	runAt time.Time
+}
+
+// WithJobEnqueueOption 投递任务的配置项。
+type WithJobEnqueueOption func(*jobEnqueueConfig)
+
+// WithJobDelay 延迟 d 之后再执行。
+func WithJobDelay(d time.Duration) WithJobEnqueueOption {
+	return func(cfg *jobEnqueueConfig) {
+		cfg.runAt = Now().Add(d)
+	}
+}
+
+// WithJobRunAt 在指定时间执行。
+func WithJobRunAt(t time.Time) WithJobEnqueueOption {
+	return func(cfg *jobEnqueueConfig) {
+		cfg.runAt = t
+	}
+}
+
+// WithJobID 指定任务 ID，默认生成 UUID，便于和业务单号关联排查。
+func WithJobID(id string) WithJobEnqueueOption {
+	return func(cfg *jobEnqueueConfig) {
+		cfg.id = id
+	}
+}
+
+// JobQueue 是基于 Redis Stream 消费者组的任务队列。
+// 处理成功才确认删除；处理中的进程崩溃后，超过可见超时的任务由 XAUTOCLAIM 转交其他消费者；
+// 失败的任务按指数退避重新投递，超过最大次数进入死信 Stream。延迟任务与重试都先放在有序集合中，到期后写入 Stream。
+type JobQueue struct {
+	prefix       string
+	group        string
+	consumer     string
+	concurrency  int
+	visibility   time.Duration
+	pollInterval time.Duration
+	drainTimeout time.Duration
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	errorHandler func(err error)
+	deadHandler  func(job *Job, err error)
+
+	mu       sync.RWMutex
+	handlers map[string]*jobHandler
+
+	lifecycle   sync.Mutex
+	running     bool
+	hookOnce    sync.Once
+	stop        chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	fetchCancel context.CancelFunc
+	loops       sync.WaitGroup
+	inflight    sync.WaitGroup
+	sem         chan struct{}
+}
+
+// WithJobQueueOption 任务队列的配置项。
+type WithJobQueueOption func(*JobQueue)
+
+// WithJobQueuePrefix 设置 Redis 键前缀，默认 job-queue:，实际使用 stream、delayed、dead 三个键。
+func WithJobQueuePrefix(prefix string) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if prefix != "" {
+			q.prefix = prefix
+		}
+	}
+}
+
+// WithJobQueueGroup 设置消费者组与当前消费者名称，consumer 为空时使用主机名加进程号。
+func WithJobQueueGroup(group, consumer string) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if group != "" {
+			q.group = group
+		}
+		if consumer != "" {
+			q.consumer = consumer
+		}
+	}
+}
+
+// WithJobQueueConcurrency 设置当前进程同时执行任务的数量，默认 10。
+func WithJobQueueConcurrency(n int) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if n > 0 {
+			q.concurrency = n
+		}
+	}
+}
+
+// WithJobQueueVisibilityTimeout 设置可见超时，默认 5 分钟，消费者在这段时间内没有续期的任务会被其他消费者接管。
+// 执行中的任务每隔三分之一超时时间自动续期一次。
+func WithJobQueueVisibilityTimeout(d time.Duration) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if d >= time.Second {
+			q.visibility = d
+		}
+	}
+}
+
+// WithJobQueuePollInterval 设置阻塞读取与延迟任务检查的间隔，默认 1 秒。
+func WithJobQueuePollInterval(d time.Duration) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if d > 0 {
+			q.pollInterval = d
+		}
+	}
+}
+
+// WithJobQueueRetry 设置默认的最大执行次数与指数退避的初始、最大间隔，默认 5 次、5 秒、10 分钟。
+func WithJobQueueRetry(maxAttempts int, backoff, maxBackoff time.Duration) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if maxAttempts > 0 {
+			q.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			q.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			q.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithJobQueueDrainTimeout 设置停止时等待执行中任务的最长时间，默认 30 秒，超时后取消任务的 context。
+func WithJobQueueDrainTimeout(d time.Duration) WithJobQueueOption {
+	return func(q *JobQueue) {
+		if d > 0 {
+			q.drainTimeout = d
+		}
+	}
+}
+
+// WithJobQueueErrorHandler 设置读取、确认等 Redis 操作出错时的回调。
+func WithJobQueueErrorHandler(handler func(err error)) WithJobQueueOption {
+	return func(q *JobQueue) {
+		q.errorHandler = handler
+	}
+}
+
+// WithJobQueueDeadHandler 设置任务进入死信时的回调。
+func WithJobQueueDeadHandler(handler func(job *Job, err error)) WithJobQueueOption {
+	return func(q *JobQueue) {
+		q.deadHandler = handler
+	}
+}
+
+// NewJobQueue 创建任务队列。
+func NewJobQueue(opts ...WithJobQueueOption) *JobQueue {
+	host, _ := os.Hostname()
+	q := &JobQueue{
+		prefix:       defaultJobQueuePrefix,
+		group:        defaultJobQueueGroup,
+		consumer:     host + "-" + strconv.Itoa(os.Getpid()),
+		concurrency:  defaultJobQueueConcurrency,
+		visibility:   defaultJobQueueVisibility,
+		pollInterval: defaultJobQueuePollInterval,
+		drainTimeout: defaultJobQueueDrainTimeout,
+		maxAttempts:  defaultJobQueueMaxAttempts,
+		backoff:      defaultJobQueueBackoff,
+		maxBackoff:   defaultJobQueueMaxBackoff,
+		handlers:     make(map[string]*jobHandler),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// InitJobQueue 初始化全局任务队列 InsJobQueue。
+func InitJobQueue(opts ...WithJobQueueOption) {
+	InsJobQueue = NewJobQueue(opts...)
+}
+
+func (q *JobQueue) streamKey() string  { return q.prefix + "stream" }
+func (q *JobQueue) delayedKey() string { return q.prefix + "delayed" }
+func (q *JobQueue) deadKey() string    { return q.prefix + "dead" }
+
+// Handle 用来注册任务处理函数，返回 nil 表示成功，返回错误会按重试策略重新投递。
+func (q *JobQueue) Handle(jobType string, fn func(ctx context.Context, job *Job) error, opts ...WithJobHandlerOption) {
+	h := &jobHandler{
+		fn:          fn,
+		maxAttempts: q.maxAttempts,
+		backoff:     q.backoff,
+		maxBackoff:  q.maxBackoff,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// RegisterJobHandler 用来注册带类型的任务处理函数，参数解析失败时任务直接进入死信。
+func RegisterJobHandler[T any](q *JobQueue, jobType string, fn func(ctx context.Context, job *Job, payload T) error, opts ...WithJobHandlerOption) {
+	q.Handle(jobType, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := job.Bind(&payload); err != nil {
+			return JobNoRetry(fmt.Errorf("任务参数解析失败: %w", err))
+		}
+		return fn(ctx, job, payload)
+	}, opts...)
+}
+
+// Enqueue 用来投递任务，payload 会编码成 JSON，返回任务 ID。
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload any, opts ...WithJobEnqueueOption) (string, error) {
+	if InsRedis == nil {
+		return "", redisClientNilErr()
+	}
+	cfg := &jobEnqueueConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var data []byte
+	if raw, ok := payload.(json.RawMessage); ok {
+		data = raw
+	} else {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return "", fmt.Errorf("任务参数编码失败: %w", err)
+		}
+	}
+	if cfg.id == "" {
+		cfg.id = GetUUID()
+	}
+
+	job := &Job{ID: cfg.id, Type: jobType, Payload: string(data), EnqueuedAt: Now()}
+	if cfg.runAt.After(job.EnqueuedAt) {
+		err := InsRedis.ZAdd(ctx, q.delayedKey(), redis.Z{Score: float64(cfg.runAt.UnixMilli()), Member: job.envelope()}).Err()
+		return job.ID, err
+	}
+	return job.ID, InsRedis.XAdd(ctx, &redis.XAddArgs{Stream: q.streamKey(), Values: job.values()}).Err()
+}
+
+// Start 用来创建消费者组并开始消费，InsGlobalHook 触发时自动 Stop；重复调用不会重复启动。
+func (q *JobQueue) Start() error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	q.lifecycle.Lock()
+	defer q.lifecycle.Unlock()
+	if q.running {
+		return nil
+	}
+	if err := q.createGroup(BackgroundContext()); err != nil {
+		return err
+	}
+
+	q.running = true
+	q.stop = make(chan struct{})
+	q.sem = make(chan struct{}, q.concurrency)
+	q.ctx, q.cancel = context.WithCancel(BackgroundContext())
+	var fetchCtx context.Context
+	fetchCtx, q.fetchCancel = context.WithCancel(q.ctx)
+	q.loops.Add(2)
+	go q.fetchLoop(fetchCtx)
+	go q.moveLoop()
+	q.hookOnce.Do(func() {
+		InsGlobalHook.AppendFun(q.Stop)
+	})
+	return nil
+}
+
+// Stop 用来停止消费，等待执行中的任务完成，超过 WithJobQueueDrainTimeout 后取消它们的 context。
+// 未确认的任务留在消费者组中，超过可见超时后由其他消费者接管。
+func (q *JobQueue) Stop() {
+	q.lifecycle.Lock()
+	if !q.running {
+		q.lifecycle.Unlock()
+		return
+	}
+	q.running = false
+	close(q.stop)
+	q.fetchCancel()
+	q.lifecycle.Unlock()
+
+	q.loops.Wait()
+	done := make(chan struct{})
+	go func() {
+		q.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(q.drainTimeout):
+	}
+	q.cancel()
+}
+
+func (q *JobQueue) createGroup(ctx context.Context) error {
+	err := InsRedis.XGroupCreateMkStream(ctx, q.streamKey(), q.group, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (q *JobQueue) fetchLoop(ctx context.Context) {
+	defer q.loops.Done()
+	claimInterval := max(q.visibility/2, time.Second)
+	var lastClaim time.Time
+	for {
+		select {
+		case <-q.stop:
+			return
+		case q.sem <- struct{}{}:
+		}
+		slots := 1
+		for more := true; more && slots < q.concurrency; {
+			select {
+			case q.sem <- struct{}{}:
+				slots++
+			default:
+				more = false
+			}
+		}
+
+		var messages []redis.XMessage
+		reclaimed := 0
+		if time.Since(lastClaim) >= claimInterval {
+			lastClaim = time.Now()
+			messages = q.reclaim(ctx, slots)
+			reclaimed = len(messages)
+		}
+		if len(messages) < slots {
+			read, err := q.read(ctx, slots-len(messages))
+			if err != nil && ctx.Err() == nil {
+				q.handleError(err)
+				select {
+				case <-q.stop:
+				case <-time.After(q.pollInterval):
+				}
+			}
+			messages = append(messages, read...)
+		}
+
+		for range slots - len(messages) {
+			<-q.sem
+		}
+		for i, msg := range messages {
+			q.inflight.Add(1)
+			go q.process(msg, i < reclaimed)
+		}
+	}
+}
+
+func (q *JobQueue) read(ctx context.Context, count int) ([]redis.XMessage, error) {
+	streams, err := InsRedis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: q.consumer,
+		Streams:  []string{q.streamKey(), ">"},
+		Count:    int64(count),
+		Block:    q.pollInterval,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "NOGROUP") {
+			return nil, q.createGroup(ctx)
+		}
+		return nil, err
+	}
+	var messages []redis.XMessage
+	for _, stream := range streams {
+		messages = append(messages, stream.Messages...)
+	}
+	return messages, nil
+}
+
+func (q *JobQueue) reclaim(ctx context.Context, count int) []redis.XMessage {
+	messages, _, err := InsRedis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.streamKey(),
+		Group:    q.group,
+		Consumer: q.consumer,
+		MinIdle:  q.visibility,
+		Start:    "0-0",
+		Count:    int64(count),
+	}).Result()
+	if err != nil && ctx.Err() == nil && !errors.Is(err, redis.Nil) {
+		q.handleError(err)
+	}
+	return messages
+}
+
+// jobMoveScript 把到期的延迟任务写入 Stream，多实例同时执行时由 ZREM 的结果保证只写入一次。
+var jobMoveScript = redis.NewScript(`local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+	if redis.call('ZREM', KEYS[1], item) == 1 then
+		local job = cjson.decode(item)
+		redis.call('XADD', KEYS[2], '*', 'id', job.id, 'type', job.type, 'payload', job.payload,
+			'attempts', job.attempts, 'enqueued_at', job.enqueued_at, 'last_error', job.last_error)
+	end
+end
+return #items`)
+
+func (q *JobQueue) moveLoop() {
+	defer q.loops.Done()
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+		for {
+			moved, err := jobMoveScript.Run(q.ctx, InsRedis, []string{q.delayedKey(), q.streamKey()},
+				Now().UnixMilli(), jobQueueMoveBatch).Int()
+			if err != nil {
+				q.handleError(err)
+				break
+			}
+			if moved < jobQueueMoveBatch {
+				break
+			}
+		}
+	}
+}
+
+func (q *JobQueue) process(msg redis.XMessage, reclaimed bool) {
+	defer q.inflight.Done()
+	defer func() { <-q.sem }()
+
+	ctx := q.ctx
+	job := jobFromMessage(msg)
+	q.mu.RLock()
+	h := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if h == nil {
+		q.dead(ctx, job, JobNoRetry(fmt.Errorf("任务类型 %s 未注册处理函数", job.Type)))
+		return
+	}
+	if reclaimed && q.deliveries(ctx, job.streamID) > int64(h.maxAttempts) {
+		q.dead(ctx, job, JobNoRetry(errors.New("任务多次超过可见超时仍未确认")))
+		return
+	}
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+			defer func() { <-h.sem }()
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	err := q.run(ctx, h, job)
+	if err == nil {
+		q.ack(ctx, job)
+		return
+	}
+	if ctx.Err() != nil {
+		// 停止时被取消的任务不计入失败，留给其他消费者接管
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if errors.Is(err, ErrJobNoRetry) || job.Attempts >= h.maxAttempts {
+		q.dead(ctx, job, err)
+		return
+	}
+	q.retry(ctx, job, retryBackoff(job.Attempts, h.backoff, h.maxBackoff))
+}
+
+func (q *JobQueue) run(ctx context.Context, h *jobHandler, job *Job) (err error) {
+	var cancel context.CancelFunc
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	go q.heartbeat(ctx, job.streamID)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务 %s 执行异常: %v", job.Type, r)
+		}
+	}()
+	return h.fn(ctx, job)
+}
+
+// heartbeat 定期重新认领执行中的任务，重置空闲时间，避免长任务被其他消费者接管。
+func (q *JobQueue) heartbeat(ctx context.Context, streamID string) {
+	ticker := time.NewTicker(max(q.visibility/3, 300*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := InsRedis.XClaimJustID(ctx, &redis.XClaimArgs{
+				Stream:   q.streamKey(),
+				Group:    q.group,
+				Consumer: q.consumer,
+				Messages: []string{streamID},
+			}).Err()
+			if err != nil && ctx.Err() == nil {
+				q.handleError(err)
+			}
+		}
+	}
+}
+
+func (q *JobQueue) deliveries(ctx context.Context, streamID string) int64 {
+	pending, err := InsRedis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.streamKey(),
+		Group:  q.group,
+		Start:  streamID,
+		End:    streamID,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+func (q *JobQueue) ack(ctx context.Context, job *Job) {
+	_, err := InsRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, q.streamKey(), q.group, job.streamID)
+		pipe.XDel(ctx, q.streamKey(), job.streamID)
+		return nil
+	})
+	q.handleError(err)
+}
+
+func (q *JobQueue) retry(ctx context.Context, job *Job, backoff time.Duration) {
+	_, err := InsRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, q.delayedKey(), redis.Z{Score: float64(Now().Add(backoff).UnixMilli()), Member: job.envelope()})
+		pipe.XAck(ctx, q.streamKey(), q.group, job.streamID)
+		pipe.XDel(ctx, q.streamKey(), job.streamID)
+		return nil
+	})
+	q.handleError(err)
+}
+
+func (q *JobQueue) dead(ctx context.Context, job *Job, cause error) {
+	job.LastError = cause.Error()
+	values := job.values()
+	values["failed_at"] = Now().Format(CSTLayout)
+	_, err := InsRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.deadKey(), Values: values})
+		pipe.XAck(ctx, q.streamKey(), q.group, job.streamID)
+		pipe.XDel(ctx, q.streamKey(), job.streamID)
+		return nil
+	})
+	q.handleError(err)
+	if q.deadHandler != nil {
+		q.deadHandler(job, cause)
+	}
+}
+
+func (q *JobQueue) handleError(err error) {
+	if err != nil && q.errorHandler != nil {
+		q.errorHandler(err)
+	}
+}
+
+// JobQueueStats 是任务队列的积压情况。
+type JobQueueStats struct {
+	Ready   int64 `json:"ready"`
+	Pending int64 `json:"pending"`
+	Delayed int64 `json:"delayed"`
+	Dead    int64 `json:"dead"`
+}
+
+// Stats 用来查询待执行、执行中、延迟与死信任务的数量。
+func (q *JobQueue) Stats(ctx context.Context) (*JobQueueStats, error) {
+	if InsRedis == nil {
+		return nil, redisClientNilErr()
+	}
+	var length, delayed, dead *redis.IntCmd
+	var pending *redis.XPendingCmd
+	_, err := InsRedis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.XLen(ctx, q.streamKey())
+		pending = pipe.XPending(ctx, q.streamKey(), q.group)
+		delayed = pipe.ZCard(ctx, q.delayedKey())
+		dead = pipe.XLen(ctx, q.deadKey())
+		return nil
+	})
+	if err != nil && !strings.Contains(err.Error(), "NOGROUP") {
+		return nil, err
+	}
+	stats := &JobQueueStats{Delayed: delayed.Val(), Dead: dead.Val()}
+	if pending.Err() == nil {
+		stats.Pending = pending.Val().Count
+	}
+	stats.Ready = max(length.Val()-stats.Pending, 0)
+	return stats, nil
+}
+
+// RetryDeadJobs 用来把最早的 count 个死信任务重新投递，失败次数清零，返回重新投递的数量。
+func (q *JobQueue) RetryDeadJobs(ctx context.Context, count int64) (int, error) {
+	if InsRedis == nil {
+		return 0, redisClientNilErr()
+	}
+	messages, err := InsRedis.XRangeN(ctx, q.deadKey(), "-", "+", count).Result()
+	if err != nil {
+		return 0, err
+	}
+	for i, msg := range messages {
+		job := jobFromMessage(msg)
+		job.Attempts = 0
+		_, err := InsRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.streamKey(), Values: job.values()})
+			pipe.XDel(ctx, q.deadKey(), msg.ID)
+			return nil
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
@@ -0,0 +1,336 @@
+package wd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	HeaderSignAppID     = "X-App-Id"
+	HeaderSignTimestamp = "X-Timestamp"
+	HeaderSignNonce     = "X-Nonce"
+	HeaderSignature     = "X-Signature"
+
+	defaultSecureMaxSkew     = 5 * time.Minute
+	defaultSecureMaxBody     = 10 << 20
+	defaultSecureNoncePrefix = "secure-nonce:"
+)
+
+// SecureNonceChecker 用来登记一次性随机数，首次出现返回 true，已用过返回 false。
+type SecureNonceChecker func(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+// RedisSecureNonceChecker 使用 InsRedis 的 SETNX 登记随机数，是 MiddlewareSecureRequest 的默认实现。
+func RedisSecureNonceChecker(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if InsRedis == nil {
+		return false, redisClientNilErr()
+	}
+	return InsRedis.SetNX(ctx, key, 1, ttl).Result()
+}
+
+// SignRequest 计算请求签名：对 "METHOD\nURI\n时间戳\n随机数\nHex(SHA256(body))" 做 HMAC-SHA256，返回十六进制。
+// uri 为路径加查询串，例如 /api/orders?page=1，服务端与客户端都使用 URL.RequestURI()。
+func SignRequest(secret, method, uri string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	payload := strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type secureRequestConfig struct {
+	signSecret   func(c *gin.Context, appID string) (string, error)
+	decryptKey   func(c *gin.Context, timestamp int64, nonce string) (string, error)
+	maxSkew      time.Duration
+	maxBody      int64
+	noncePrefix  string
+	nonceChecker SecureNonceChecker
+}
+
+// WithSecureRequestOption 加密签名中间件的配置项。
+type WithSecureRequestOption func(*secureRequestConfig)
+
+// WithSecureRequestSign 开启签名校验，secret 根据 X-App-Id 请求头返回签名密钥，单应用时可以忽略 appID。
+func WithSecureRequestSign(secret func(c *gin.Context, appID string) (string, error)) WithSecureRequestOption {
+	return func(cfg *secureRequestConfig) {
+		cfg.signSecret = secret
+	}
+}
+
+// WithSecureRequestDecrypt 开启请求体解密，请求体由 EncryptRequestData 生成，key 与它的 custom 对应。
+// 密文以 "时间戳|随机数" 作为附加认证数据，只开启解密时也能防止替换时间戳与随机数后重放。
+func WithSecureRequestDecrypt(key func(c *gin.Context, timestamp int64, nonce string) (string, error)) WithSecureRequestOption {
+	return func(cfg *secureRequestConfig) {
+		cfg.decryptKey = key
+	}
+}
+
+// WithSecureRequestMaxSkew 设置允许的时间戳偏差，默认 5 分钟，随机数的保留时间为它的两倍。
+func WithSecureRequestMaxSkew(d time.Duration) WithSecureRequestOption {
+	return func(cfg *secureRequestConfig) {
+		if d > 0 {
+			cfg.maxSkew = d
+		}
+	}
+}
+
+// WithSecureRequestMaxBody 设置请求体大小上限，默认 10MB。
+func WithSecureRequestMaxBody(size int64) WithSecureRequestOption {
+	return func(cfg *secureRequestConfig) {
+		if size > 0 {
+			cfg.maxBody = size
+		}
+	}
+}
+
+// WithSecureRequestNonceChecker 替换随机数的存储方式，默认 RedisSecureNonceChecker，prefix 为空时使用 secure-nonce:。
+func WithSecureRequestNonceChecker(checker SecureNonceChecker, prefix string) WithSecureRequestOption {
+	return func(cfg *secureRequestConfig) {
+		if checker != nil {
+			cfg.nonceChecker = checker
+		}
+		if prefix != "" {
+			cfg.noncePrefix = prefix
+		}
+	}
+}
+
+// MiddlewareSecureRequest 用来校验请求签名并解密请求体，需要放在参数绑定之前。
+// 同时开启签名与解密时先对原始请求体验签再解密，时间戳与随机数取自请求头；只开启解密时取自请求体。
+func MiddlewareSecureRequest(opts ...WithSecureRequestOption) gin.HandlerFunc {
+	cfg := &secureRequestConfig{
+		maxSkew:      defaultSecureMaxSkew,
+		maxBody:      defaultSecureMaxBody,
+		noncePrefix:  defaultSecureNoncePrefix,
+		nonceChecker: RedisSecureNonceChecker,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(c *gin.Context) {
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, cfg.maxBody))
+			if err != nil {
+				ResponseError(c, MsgErrBadRequest("请求体读取失败", err))
+				c.Abort()
+				return
+			}
+		}
+
+		if cfg.signSecret != nil {
+			if appErr := cfg.verifySign(c, body); appErr != nil {
+				ResponseError(c, appErr)
+				c.Abort()
+				return
+			}
+		}
+
+		if cfg.decryptKey != nil && len(bytes.TrimSpace(body)) > 0 {
+			plaintext, appErr := cfg.decrypt(c, body)
+			if appErr != nil {
+				ResponseError(c, appErr)
+				c.Abort()
+				return
+			}
+			body = plaintext
+			c.Request.Header.Set("Content-Type", gin.MIMEJSON)
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Next()
+	}
+}
+
+func (cfg *secureRequestConfig) verifySign(c *gin.Context, body []byte) *AppError {
+	appID := c.GetHeader(HeaderSignAppID)
+	timestampText := c.GetHeader(HeaderSignTimestamp)
+	nonce := c.GetHeader(HeaderSignNonce)
+	signature := c.GetHeader(HeaderSignature)
+	if timestampText == "" || nonce == "" || signature == "" {
+		return MsgErrUnauthorized("缺少签名参数")
+	}
+	timestamp, err := strconv.ParseInt(timestampText, 10, 64)
+	if err != nil {
+		return MsgErrUnauthorized("签名时间戳格式不正确", err)
+	}
+	if appErr := cfg.checkTimestamp(timestamp); appErr != nil {
+		return appErr
+	}
+
+	secret, err := cfg.signSecret(c, appID)
+	if err != nil || secret == "" {
+		return MsgErrUnauthorized("签名密钥不存在", err)
+	}
+	expected := SignRequest(secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return MsgErrUnauthorized("签名校验失败")
+	}
+	return cfg.useNonce(c, appID, nonce)
+}
+
+func (cfg *secureRequestConfig) decrypt(c *gin.Context, body []byte) ([]byte, *AppError) {
+	var encrypted EncryptedResponse
+	if err := json.Unmarshal(body, &encrypted); err != nil || encrypted.Data == "" {
+		return nil, MsgErrBadRequest("加密请求体格式不正确", err)
+	}
+	if cfg.signSecret == nil {
+		if encrypted.Nonce == "" {
+			return nil, MsgErrBadRequest("加密请求体缺少随机数")
+		}
+		if appErr := cfg.checkTimestamp(encrypted.Timestamp); appErr != nil {
+			return nil, appErr
+		}
+		if appErr := cfg.useNonce(c, "", encrypted.Nonce); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	key, err := cfg.decryptKey(c, encrypted.Timestamp, encrypted.Nonce)
+	if err != nil {
+		return nil, MsgErrBadRequest("解密密钥获取失败", err)
+	}
+	plaintext, err := decryptAESGCM(encrypted.Data, []byte(key), encryptedRequestAAD(encrypted.Timestamp, encrypted.Nonce))
+	if err != nil {
+		return nil, MsgErrBadRequest("请求体解密失败", err)
+	}
+	return plaintext, nil
+}
+
+func (cfg *secureRequestConfig) checkTimestamp(timestamp int64) *AppError {
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > cfg.maxSkew || skew < -cfg.maxSkew {
+		return MsgErrUnauthorized("请求已过期")
+	}
+	return nil
+}
+
+func (cfg *secureRequestConfig) useNonce(c *gin.Context, appID, nonce string) *AppError {
+	key := cfg.noncePrefix + nonce
+	if appID != "" {
+		key = cfg.noncePrefix + appID + ":" + nonce
+	}
+	ok, err := cfg.nonceChecker(c.Request.Context(), key, 2*cfg.maxSkew)
+	if err != nil {
+		return MsgErrRedis("", err)
+	}
+	if !ok {
+		return MsgErrUnauthorized("重复的请求")
+	}
+	return nil
+}
+
+// SecureClient 是与 MiddlewareSecureRequest 配套的客户端，发送前自动加密请求体并签名。
+type SecureClient struct {
+	client     *resty.Client
+	appID      string
+	secret     string
+	encryptKey func(now int64) (key, nonce string)
+}
+
+// WithSecureClientOption 加密签名客户端的配置项。
+type WithSecureClientOption func(*SecureClient)
+
+// WithSecureClientSign 设置签名使用的应用 ID 与密钥，appID 为空时不发送 X-App-Id。
+func WithSecureClientSign(appID, secret string) WithSecureClientOption {
+	return func(s *SecureClient) {
+		s.appID = appID
+		s.secret = secret
+	}
+}
+
+// WithSecureClientEncrypt 开启请求体加密，custom 与 EncryptRequestData 的参数相同。
+func WithSecureClientEncrypt(custom func(now int64) (key, nonce string)) WithSecureClientOption {
+	return func(s *SecureClient) {
+		s.encryptKey = custom
+	}
+}
+
+// NewSecureClient 创建加密签名客户端，底层复用 RestyClient() 的 http.Client。
+func NewSecureClient(opts ...WithSecureClientOption) *SecureClient {
+	s := &SecureClient{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.client = resty.NewWithClient(RestyClient().GetClient())
+	s.client.OnBeforeRequest(s.encryptBody)
+	s.client.SetPreRequestHook(s.sign)
+	return s
+}
+
+// R 用来创建请求，用法与 R() 相同。
+func (s *SecureClient) R() *resty.Request {
+	return s.client.R()
+}
+
+func (s *SecureClient) encryptBody(_ *resty.Client, r *resty.Request) error {
+	if s.encryptKey == nil || r.Body == nil {
+		return nil
+	}
+	if _, ok := r.Body.(*EncryptedResponse); ok {
+		return nil
+	}
+	data := r.Body
+	switch v := data.(type) {
+	case []byte:
+		data = json.RawMessage(v)
+	case string:
+		data = json.RawMessage(v)
+	}
+	encrypted, err := EncryptRequestData(data, s.encryptKey)
+	if err != nil {
+		return err
+	}
+	r.SetBody(encrypted).SetHeader("Content-Type", gin.MIMEJSON)
+	return nil
+}
+
+func (s *SecureClient) sign(_ *resty.Client, r *http.Request) error {
+	if s.secret == "" {
+		return nil
+	}
+	var body []byte
+	if r.GetBody != nil {
+		reader, err := r.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+	} else if r.Body != nil && r.Body != http.NoBody {
+		return errors.New("请求体无法重复读取，不能签名")
+	}
+
+	timestamp := time.Now().Unix()
+	nonce := GetUUID()
+	if s.appID != "" {
+		r.Header.Set(HeaderSignAppID, s.appID)
+	}
+	r.Header.Set(HeaderSignTimestamp, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(HeaderSignNonce, nonce)
+	r.Header.Set(HeaderSignature, SignRequest(s.secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	return nil
+}
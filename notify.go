@@ -0,0 +1,385 @@
+package wd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	NotifyChannelEmail   = "email"
+	NotifyChannelWebhook = "webhook"
+	NotifyChannelSMS     = "sms"
+
+	defaultNotifyQueueKey     = "notify-queue"
+	defaultNotifyMaxAttempts  = 5
+	defaultNotifyBackoff      = 10 * time.Second
+	defaultNotifyMaxBackoff   = 30 * time.Minute
+	defaultNotifyLease        = time.Minute
+	defaultNotifyConcurrency  = 4
+	defaultNotifyPollInterval = time.Second
+	notifyJobType             = "notify"
+	notifyRetryDeadBatch      = 100
+)
+
+// InsNotifier 是全局的通知分发器。
+var InsNotifier *Notifier
+
+// NotifyRecipient 描述一个接收人。
+// Addresses 为渠道名到地址的映射，例如 email 对应邮箱、sms 对应手机号、webhook 对应机器人地址；
+// Channels 为接收人愿意接收的渠道，为空表示不限制；Data 会覆盖通知中的同名模板变量。
+type NotifyRecipient struct {
+	ID        string            `json:"id"`
+	Addresses map[string]string `json:"addresses"`
+	Channels  []string          `json:"channels"`
+	Data      map[string]any    `json:"data"`
+}
+
+// Notification 是一次通知，按模板渲染后发给每个接收人的每个渠道。
+// Channels 为空时使用模板的默认渠道；Recipients 为空时只发给配置了默认地址的渠道，例如群机器人。
+type Notification struct {
+	Template   string            `json:"template"`
+	Data       map[string]any    `json:"data"`
+	Channels   []string          `json:"channels"`
+	Recipients []NotifyRecipient `json:"recipients"`
+}
+
+// NotifyTemplate 描述一个通知模板。
+// Subject 与 Text 使用 TemplateReplaceText 渲染，HTML 使用 TemplateReplace 渲染并自动转义变量；
+// SMSTemplate 为短信模板编号或 SMSClient 中注册的模板名，SMSParams 指定作为短信参数的变量，为空时使用全部变量。
+type NotifyTemplate struct {
+	Subject     string
+	Text        string
+	HTML        string
+	SMSTemplate string
+	SMSParams   []string
+	Channels    []string
+}
+
+// NotifyMessage 是渲染后发给某个渠道的一条消息，也是异步任务的参数。
+type NotifyMessage struct {
+	ID          string         `json:"id"`
+	Channel     string         `json:"channel"`
+	RecipientID string         `json:"recipient_id"`
+	Address     string         `json:"address"`
+	Subject     string         `json:"subject"`
+	Text        string         `json:"text"`
+	HTML        string         `json:"html"`
+	SMSTemplate string         `json:"sms_template"`
+	SMSParams   map[string]any `json:"sms_params"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error"`
+}
+
+// NotifyChannel 是通知渠道的驱动。
+type NotifyChannel interface {
+	Name() string
+	Send(ctx context.Context, msg *NotifyMessage) error
+}
+
+// notifyDefaultAddresser 由带默认地址的渠道实现，接收人没有该渠道地址时仍然发送。
+type notifyDefaultAddresser interface {
+	hasDefaultAddress() bool
+}
+
+// Notifier 是通知分发器，支持同步发送与基于 JobQueue 的异步投递。
+// 异步投递时每条渠道消息是一个独立的任务，重试、可见超时与死信都由 JobQueue 负责。
+type Notifier struct {
+	channels     map[string]NotifyChannel
+	templates    map[string]NotifyTemplate
+	queueKey     string
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	lease        time.Duration
+	concurrency  int
+	pollInterval time.Duration
+	failHandler  func(msg *NotifyMessage, err error)
+	errorHandler func(err error)
+
+	queue *JobQueue
+}
+
+// WithNotifierOption 通知分发器的配置项。
+type WithNotifierOption func(*Notifier)
+
+// WithNotifierChannel 注册通知渠道，同名渠道后注册的生效。
+func WithNotifierChannel(channels ...NotifyChannel) WithNotifierOption {
+	return func(n *Notifier) {
+		for _, ch := range channels {
+			if ch != nil {
+				n.channels[ch.Name()] = ch
+			}
+		}
+	}
+}
+
+// WithNotifierTemplate 注册通知模板。
+func WithNotifierTemplate(name string, tpl NotifyTemplate) WithNotifierOption {
+	return func(n *Notifier) {
+		n.templates[name] = tpl
+	}
+}
+
+// WithNotifierQueue 设置异步任务队列的 Redis 键前缀，默认 notify-queue，实际键名为前缀加 :stream、:delayed、:dead。
+func WithNotifierQueue(key string) WithNotifierOption {
+	return func(n *Notifier) {
+		if key != "" {
+			n.queueKey = key
+		}
+	}
+}
+
+// WithNotifierRetry 设置异步投递的最大次数与指数退避的初始、最大间隔。
+func WithNotifierRetry(maxAttempts int, backoff, maxBackoff time.Duration) WithNotifierOption {
+	return func(n *Notifier) {
+		if maxAttempts > 0 {
+			n.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			n.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			n.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithNotifierWorker 设置异步投递的并发数、消息租期与空闲时的轮询间隔。
+// 租期即任务队列的可见超时，单条消息的发送超时为租期的一半。
+func WithNotifierWorker(concurrency int, lease, pollInterval time.Duration) WithNotifierOption {
+	return func(n *Notifier) {
+		if concurrency > 0 {
+			n.concurrency = concurrency
+		}
+		if lease > 0 {
+			n.lease = lease
+		}
+		if pollInterval > 0 {
+			n.pollInterval = pollInterval
+		}
+	}
+}
+
+// WithNotifierFailHandler 设置异步投递最终失败时的回调，消息同时会写入死信队列。
+func WithNotifierFailHandler(handler func(msg *NotifyMessage, err error)) WithNotifierOption {
+	return func(n *Notifier) {
+		n.failHandler = handler
+	}
+}
+
+// WithNotifierErrorHandler 设置任务队列读取、确认、重试等 Redis 操作出错时的回调。
+func WithNotifierErrorHandler(handler func(err error)) WithNotifierOption {
+	return func(n *Notifier) {
+		n.errorHandler = handler
+	}
+}
+
+// NewNotifier 创建通知分发器。
+func NewNotifier(opts ...WithNotifierOption) *Notifier {
+	n := &Notifier{
+		channels:     make(map[string]NotifyChannel),
+		templates:    make(map[string]NotifyTemplate),
+		queueKey:     defaultNotifyQueueKey,
+		maxAttempts:  defaultNotifyMaxAttempts,
+		backoff:      defaultNotifyBackoff,
+		maxBackoff:   defaultNotifyMaxBackoff,
+		lease:        defaultNotifyLease,
+		concurrency:  defaultNotifyConcurrency,
+		pollInterval: defaultNotifyPollInterval,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.queue = NewJobQueue(
+		WithJobQueuePrefix(n.queueKey+":"),
+		WithJobQueueConcurrency(n.concurrency),
+		WithJobQueueVisibilityTimeout(n.lease),
+		WithJobQueuePollInterval(n.pollInterval),
+		WithJobQueueRetry(n.maxAttempts, n.backoff, n.maxBackoff),
+		WithJobQueueErrorHandler(n.errorHandler),
+		WithJobQueueDeadHandler(n.dead),
+	)
+	RegisterJobHandler(n.queue, notifyJobType, n.deliver, WithJobHandlerTimeout(n.lease/2))
+	return n
+}
+
+// InitNotifier 初始化全局通知分发器 InsNotifier。
+func InitNotifier(opts ...WithNotifierOption) {
+	InsNotifier = NewNotifier(opts...)
+}
+
+// Render 用来把通知渲染成逐条渠道消息，不发送。
+func (n *Notifier) Render(notification *Notification) ([]*NotifyMessage, error) {
+	if notification == nil {
+		return nil, errors.New("通知内容不能为空")
+	}
+	tpl, ok := n.templates[notification.Template]
+	if !ok {
+		return nil, fmt.Errorf("通知模板 %s 未注册", notification.Template)
+	}
+	channels := notification.Channels
+	if len(channels) == 0 {
+		channels = tpl.Channels
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("通知模板 %s 未指定渠道", notification.Template)
+	}
+	for _, ch := range channels {
+		if _, ok := n.channels[ch]; !ok {
+			return nil, fmt.Errorf("通知渠道 %s 未注册", ch)
+		}
+	}
+
+	recipients := notification.Recipients
+	if len(recipients) == 0 {
+		recipients = []NotifyRecipient{{}}
+	}
+	var messages []*NotifyMessage
+	for _, recipient := range recipients {
+		data := make(map[string]any, len(notification.Data)+len(recipient.Data))
+		maps.Copy(data, notification.Data)
+		maps.Copy(data, recipient.Data)
+
+		for _, ch := range channels {
+			if len(recipient.Channels) > 0 && !slices.Contains(recipient.Channels, ch) {
+				continue
+			}
+			address := recipient.Addresses[ch]
+			if address == "" {
+				if d, ok := n.channels[ch].(notifyDefaultAddresser); !ok || !d.hasDefaultAddress() {
+					continue
+				}
+			}
+			msg, err := renderNotifyMessage(tpl, data)
+			if err != nil {
+				return nil, fmt.Errorf("通知模板 %s 渲染失败: %w", notification.Template, err)
+			}
+			msg.ID = GetUUID()
+			msg.Channel = ch
+			msg.RecipientID = recipient.ID
+			msg.Address = address
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func renderNotifyMessage(tpl NotifyTemplate, data map[string]any) (*NotifyMessage, error) {
+	msg := &NotifyMessage{SMSTemplate: tpl.SMSTemplate}
+	var err error
+	if tpl.Subject != "" {
+		if msg.Subject, err = TemplateReplaceText(tpl.Subject, data); err != nil {
+			return nil, err
+		}
+	}
+	if tpl.Text != "" {
+		if msg.Text, err = TemplateReplaceText(tpl.Text, data); err != nil {
+			return nil, err
+		}
+	}
+	if tpl.HTML != "" {
+		if msg.HTML, err = TemplateReplace(tpl.HTML, data); err != nil {
+			return nil, err
+		}
+	}
+	if tpl.SMSTemplate != "" {
+		msg.SMSParams = make(map[string]any)
+		if len(tpl.SMSParams) == 0 {
+			maps.Copy(msg.SMSParams, data)
+		}
+		for _, key := range tpl.SMSParams {
+			if v, ok := data[key]; ok {
+				msg.SMSParams[key] = v
+			}
+		}
+	}
+	return msg, nil
+}
+
+// Send 用来同步发送通知，每条渠道消息只尝试一次，返回全部失败消息的错误。
+func (n *Notifier) Send(ctx context.Context, notification *Notification) error {
+	messages, err := n.Render(notification)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, msg := range messages {
+		if err := n.channels[msg.Channel].Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", msg.Channel, msg.RecipientID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Enqueue 用来把通知渲染后写入任务队列异步投递，每条渠道消息是一个独立的任务，单独重试，互不影响。
+func (n *Notifier) Enqueue(ctx context.Context, notification *Notification) error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	messages, err := n.Render(notification)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if _, err := n.queue.Enqueue(ctx, notifyJobType, msg, WithJobID(msg.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start 用来启动异步投递，InsGlobalHook 触发时自动停止；重复调用不会重复启动。
+func (n *Notifier) Start() error {
+	return n.queue.Start()
+}
+
+// Stop 用来停止异步投递，等待正在发送的消息处理完再返回，未处理的消息留在队列中。
+func (n *Notifier) Stop() {
+	n.queue.Stop()
+}
+
+// Queue 用来获取承载异步投递的任务队列，可以查询 Stats 等积压情况。
+func (n *Notifier) Queue() *JobQueue {
+	return n.queue
+}
+
+// deliver 是通知任务的处理函数，渠道未注册时不再重试。
+func (n *Notifier) deliver(ctx context.Context, job *Job, msg NotifyMessage) error {
+	channel, ok := n.channels[msg.Channel]
+	if !ok {
+		return JobNoRetry(fmt.Errorf("通知渠道 %s 未注册", msg.Channel))
+	}
+	msg.Attempts = job.Attempts
+	msg.LastError = job.LastError
+	return channel.Send(ctx, &msg)
+}
+
+func (n *Notifier) dead(job *Job, err error) {
+	if n.failHandler == nil {
+		return
+	}
+	var msg NotifyMessage
+	if job.Bind(&msg) != nil {
+		msg.ID = job.ID
+	}
+	msg.Attempts = job.Attempts
+	msg.LastError = job.LastError
+	n.failHandler(&msg, err)
+}
+
+// RetryDeadNotify 用来把死信队列中的消息全部重新投递，失败次数清零，返回重新投递的条数。
+func (n *Notifier) RetryDeadNotify(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		retried, err := n.queue.RetryDeadJobs(ctx, notifyRetryDeadBatch)
+		count += retried
+		if err != nil || retried < notifyRetryDeadBatch {
+			return count, err
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package wd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// SMTPConfig 描述发信使用的 SMTP 服务。
+// Port 为 465 或 ImplicitTLS 为 true 时直接建立 TLS 连接，否则在服务端支持时使用 STARTTLS。
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	From        string
+	ImplicitTLS bool
+	Timeout     time.Duration
+}
+
+// NotifySMTPChannel 通过 SMTP 发送邮件，HTML 与纯文本同时存在时发送 multipart/alternative 邮件。
+type NotifySMTPChannel struct {
+	name   string
+	config SMTPConfig
+	from   *mail.Address
+}
+
+// NewNotifySMTPChannel 创建邮件渠道，渠道名为 email。
+func NewNotifySMTPChannel(config SMTPConfig) (*NotifySMTPChannel, error) {
+	if config.Host == "" {
+		return nil, errors.New("SMTP 地址不能为空")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("发件人地址不正确: %w", err)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.Port == 465 {
+		config.ImplicitTLS = true
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &NotifySMTPChannel{name: NotifyChannelEmail, config: config, from: from}, nil
+}
+
+// Name 用来返回渠道名称。
+func (s *NotifySMTPChannel) Name() string {
+	return s.name
+}
+
+// Send 用来发送一封邮件，msg.Address 为收件人，可以是 "张三 <a@example.com>" 形式。
+func (s *NotifySMTPChannel) Send(ctx context.Context, msg *NotifyMessage) error {
+	to, err := mail.ParseAddress(msg.Address)
+	if err != nil {
+		return fmt.Errorf("收件人地址不正确: %w", err)
+	}
+	body, err := buildNotifyMail(s.from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	var conn net.Conn
+	if s.config.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.config.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.config.Timeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !s.config.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func buildNotifyMail(from, to *mail.Address, msg *NotifyMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	buf.WriteString("Message-ID: <" + msg.ID + "@" + domain + ">\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	switch {
+	case msg.HTML != "" && msg.Text != "":
+		boundary := "wd-" + GetUUID()
+		buf.WriteString("Content-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n\r\n")
+		writeNotifyMailPart(&buf, boundary, "text/plain", msg.Text)
+		writeNotifyMailPart(&buf, boundary, "text/html", msg.HTML)
+		buf.WriteString("--" + boundary + "--\r\n")
+	case msg.HTML != "":
+		writeNotifyMailPart(&buf, "", "text/html", msg.HTML)
+	case msg.Text != "":
+		writeNotifyMailPart(&buf, "", "text/plain", msg.Text)
+	default:
+		return nil, errors.New("邮件正文为空")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeNotifyMailPart(buf *bytes.Buffer, boundary, contentType, content string) {
+	if boundary != "" {
+		buf.WriteString("--" + boundary + "\r\n")
+	}
+	buf.WriteString("Content-Type: " + contentType + "; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
+
+// NotifyWebhookChannel 以 JSON 形式 POST 到 webhook 地址，适用于钉钉、企业微信等机器人。
+type NotifyWebhookChannel struct {
+	name    string
+	url     string
+	headers map[string]string
+	body    func(msg *NotifyMessage) any
+}
+
+// WithNotifyWebhookOption webhook 渠道的配置项。
+type WithNotifyWebhookOption func(*NotifyWebhookChannel)
+
+// WithNotifyWebhookHeaders 设置每次请求附带的请求头。
+func WithNotifyWebhookHeaders(headers map[string]string) WithNotifyWebhookOption {
+	return func(w *NotifyWebhookChannel) {
+		for k, v := range headers {
+			w.headers[k] = v
+		}
+	}
+}
+
+// WithNotifyWebhookBody 自定义请求体，默认 {"id","title","text","recipient_id"}，
+// 钉钉与企业微信可以直接使用 DingTalkWebhookBody、WeComWebhookBody。
+func WithNotifyWebhookBody(body func(msg *NotifyMessage) any) WithNotifyWebhookOption {
+	return func(w *NotifyWebhookChannel) {
+		if body != nil {
+			w.body = body
+		}
+	}
+}
+
+// DingTalkWebhookBody 生成钉钉机器人的 markdown 消息。
+func DingTalkWebhookBody(msg *NotifyMessage) any {
+	return map[string]any{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": msg.Subject, "text": msg.Text},
+	}
+}
+
+// WeComWebhookBody 生成企业微信机器人的 markdown 消息。
+func WeComWebhookBody(msg *NotifyMessage) any {
+	content := msg.Text
+	if msg.Subject != "" {
+		content = "**" + msg.Subject + "**\n" + content
+	}
+	return map[string]any{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": content},
+	}
+}
+
+// NewNotifyWebhookChannel 创建 webhook 渠道，name 为空时使用 webhook；
+// url 为默认地址，接收人配置了该渠道地址时优先使用接收人的地址。
+func NewNotifyWebhookChannel(name, url string, opts ...WithNotifyWebhookOption) *NotifyWebhookChannel {
+	if name == "" {
+		name = NotifyChannelWebhook
+	}
+	w := &NotifyWebhookChannel{
+		name:    name,
+		url:     url,
+		headers: make(map[string]string),
+		body: func(msg *NotifyMessage) any {
+			return map[string]string{
+				"id":           msg.ID,
+				"title":        msg.Subject,
+				"text":         msg.Text,
+				"recipient_id": msg.RecipientID,
+			}
+		},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Name 用来返回渠道名称。
+func (w *NotifyWebhookChannel) Name() string {
+	return w.name
+}
+
+func (w *NotifyWebhookChannel) hasDefaultAddress() bool {
+	return w.url != ""
+}
+
+// Send 用来发送 webhook，非 2xx 或响应中 errcode 不为 0 时视为失败。
+func (w *NotifyWebhookChannel) Send(ctx context.Context, msg *NotifyMessage) error {
+	url := msg.Address
+	if url == "" {
+		url = w.url
+	}
+	if url == "" {
+		return errors.New("webhook 地址为空")
+	}
+	resp, err := R().
+		SetContext(ctx).
+		SetHeaders(w.headers).
+		SetHeader("Content-Type", "application/json").
+		SetBody(w.body(msg)).
+		Post(url)
+	if err != nil {
+		return err
+	}
+	return checkNotifyWebhookResponse(w.name, resp)
+}
+
+func checkNotifyWebhookResponse(name string, resp *resty.Response) error {
+	if resp.IsError() {
+		return newResponseStatusError(name+" 发送失败", resp)
+	}
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if json.Unmarshal(resp.Body(), &result) == nil && result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("%s 发送失败: %d %s", name, *result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// NotifySMSChannel 通过 SMSSender 发送短信通知，msg.Address 为手机号。
+type NotifySMSChannel struct {
+	sender   SMSSender
+	signName string
+}
+
+// NewNotifySMSChannel 创建短信渠道，渠道名为 sms，sender 可以是 *SMSService、*SMSClient 或 *SMSLogSender。
+func NewNotifySMSChannel(sender SMSSender, signName string) *NotifySMSChannel {
+	return &NotifySMSChannel{sender: sender, signName: signName}
+}
+
+// Name 用来返回渠道名称。
+func (s *NotifySMSChannel) Name() string {
+	return NotifyChannelSMS
+}
+
+// Send 用来发送短信，模板为 NotifyTemplate.SMSTemplate。
+func (s *NotifySMSChannel) Send(ctx context.Context, msg *NotifyMessage) error {
+	if msg.SMSTemplate == "" {
+		return errors.New("通知模板未配置短信模板")
+	}
+	_, err := s.sender.Send(ctx, &SMSMessage{
+		Phone:        msg.Address,
+		SignName:     s.signName,
+		TemplateCode: msg.SMSTemplate,
+		Params:       msg.SMSParams,
+	})
+	return err
+}
+
+// NotifyMemoryChannel 是只记录不发送的渠道，用于单元测试与本地开发。
+type NotifyMemoryChannel struct {
+	mu       sync.Mutex
+	name     string
+	err      error
+	messages []NotifyMessage
+}
+
+// NewNotifyMemoryChannel 创建内存渠道，name 与要替换的渠道同名即可，例如 email。
+func NewNotifyMemoryChannel(name string) *NotifyMemoryChannel {
+	return &NotifyMemoryChannel{name: name}
+}
+
+// Name 用来返回渠道名称。
+func (m *NotifyMemoryChannel) Name() string {
+	return m.name
+}
+
+// Send 用来记录消息，设置了 SetError 时直接返回该错误。
+func (m *NotifyMemoryChannel) Send(_ context.Context, msg *NotifyMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// SetError 让之后的发送都返回 err，传 nil 恢复正常。
+func (m *NotifyMemoryChannel) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Messages 用来返回已记录的全部消息。
+func (m *NotifyMemoryChannel) Messages() []NotifyMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.messages)
+}
+
+// Reset 用来清空记录与错误。
+func (m *NotifyMemoryChannel) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+	m.err = nil
+}
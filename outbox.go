@@ -0,0 +1,484 @@
+package wd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/esutil"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxStatusPending   int8 = 0 // 待投递
+	OutboxStatusDelivered int8 = 1 // 已投递
+	OutboxStatusFailed    int8 = 2 // 超过最大重试次数
+
+	// OutboxAnyTopic 用来注册兜底 sink，未单独注册的 topic 都会交给它处理。
+	OutboxAnyTopic = "*"
+
+	defaultOutboxBatchSize   = 100
+	defaultOutboxMaxAttempts = 10
+	defaultOutboxBackoff     = 5 * time.Second
+	defaultOutboxMaxBackoff  = 30 * time.Minute
+	defaultOutboxLockKey     = "outbox-relay-lock"
+	maxOutboxErrorLength     = 512
+)
+
+// OutboxMessage 事务性发件箱中的一条事件。
+type OutboxMessage struct {
+	ID            uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Topic         string     `gorm:"column:topic;type:varchar(128);not null;index" json:"topic"`
+	MsgKey        string     `gorm:"column:msg_key;type:varchar(128);not null;default:''" json:"msg_key"`
+	Payload       string     `gorm:"column:payload;type:text;not null" json:"payload"`
+	Status        int8       `gorm:"column:status;not null;default:0;index:idx_outbox_status_next,priority:1" json:"status"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_outbox_status_next,priority:2" json:"next_attempt_at"`
+	LastError     string     `gorm:"column:last_error;type:varchar(512);not null;default:''" json:"last_error"`
+	CreatedAt     time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	DeliveredAt   *time.Time `gorm:"column:delivered_at" json:"delivered_at"`
+}
+
+// TableName 返回发件箱表名。
+func (OutboxMessage) TableName() string {
+	return "outbox_message"
+}
+
+// InitOutboxTable 在数据库中创建发件箱表，如果mandatory为true则会强制迁移，否则则会先去检查是否存在，不存在才创建
+func InitOutboxTable(mandatory ...bool) error {
+	if InsDB == nil {
+		return gormClientNilErr()
+	}
+	if len(mandatory) == 0 || (len(mandatory) > 0 && !mandatory[0]) {
+		if InsDB.DB.Migrator().HasTable(&OutboxMessage{}) {
+			return nil
+		}
+	}
+
+	return InsDB.DB.AutoMigrate(&OutboxMessage{})
+}
+
+// PublishOutbox 用来把事件写入发件箱，应在 WithTx 开启的业务事务中调用，保证事件与业务数据同时提交。
+// payload 为 string 或 []byte 时原样保存，其余类型按 JSON 序列化。
+func PublishOutbox(ctx context.Context, topic, key string, payload any) error {
+	if !InTx(ctx) && (InsDB == nil || InsDB.DB == nil) {
+		return gormClientNilErr()
+	}
+	var body string
+	switch v := payload.(type) {
+	case string:
+		body = v
+	case []byte:
+		body = string(v)
+	default:
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = string(data)
+	}
+
+	now := Now()
+	return DB(ctx).Create(&OutboxMessage{
+		Topic:         topic,
+		MsgKey:        key,
+		Payload:       body,
+		Status:        OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}).Error
+}
+
+// OutboxSink 发件箱事件的投递目标。
+// Deliver 返回的切片与 messages 一一对应，nil 表示投递成功。
+type OutboxSink interface {
+	Deliver(ctx context.Context, messages []*OutboxMessage) []error
+}
+
+// OutboxSinkFunc 把逐条投递的函数适配为 OutboxSink。
+type OutboxSinkFunc func(ctx context.Context, message *OutboxMessage) error
+
+// Deliver 逐条调用投递函数。
+func (f OutboxSinkFunc) Deliver(ctx context.Context, messages []*OutboxMessage) []error {
+	errs := make([]error, len(messages))
+	for i, message := range messages {
+		errs[i] = f(ctx, message)
+	}
+	return errs
+}
+
+// NewOutboxRedisStreamSink 投递到 Redis Stream，stream 为空时使用事件 topic 作为 stream 名，maxLen>0 时近似裁剪长度。
+func NewOutboxRedisStreamSink(stream string, maxLen int64) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		if InsRedis == nil {
+			return redisClientNilErr()
+		}
+		name := stream
+		if name == "" {
+			name = message.Topic
+		}
+		return InsRedis.XAdd(ctx, &redis.XAddArgs{
+			Stream: name,
+			MaxLen: maxLen,
+			Approx: maxLen > 0,
+			Values: map[string]any{
+				"outbox_id":  message.ID,
+				"topic":      message.Topic,
+				"key":        message.MsgKey,
+				"payload":    message.Payload,
+				"created_at": message.CreatedAt.Format(CSTLayout),
+			},
+		}).Err()
+	})
+}
+
+// NewOutboxWebhookSink 以 JSON 形式 POST 到 url，非 2xx 响应视为失败。
+// 请求头 X-Outbox-Id 携带事件 ID，接收方可据此做幂等。
+func NewOutboxWebhookSink(url string, headers map[string]string) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		var payload any = message.Payload
+		if json.Valid([]byte(message.Payload)) {
+			payload = json.RawMessage(message.Payload)
+		}
+		resp, err := R().
+			SetContext(ctx).
+			SetHeaders(headers).
+			SetHeader("X-Outbox-Id", strconv.FormatUint(message.ID, 10)).
+			SetBody(map[string]any{
+				"id":         message.ID,
+				"topic":      message.Topic,
+				"key":        message.MsgKey,
+				"payload":    payload,
+				"created_at": message.CreatedAt.Format(CSTLayout),
+			}).
+			Post(url)
+		if err != nil {
+			return err
+		}
+		if resp.IsError() {
+			return newResponseStatusError("webhook 投递失败", resp)
+		}
+		return nil
+	})
+}
+
+type outboxEsSink struct {
+	index string
+}
+
+// NewOutboxEsSink 通过 ES bulk 批量写入，index 为空时使用事件 topic 作为索引名，事件 key 作为文档 ID，key 为空时使用发件箱 ID。
+// 每批事件使用独立的 BulkIndexer 并在返回前 flush，确保能拿到逐条写入结果。
+func NewOutboxEsSink(index string) OutboxSink {
+	return &outboxEsSink{index: index}
+}
+
+// Deliver 批量写入 ES 并收集逐条结果。
+func (s *outboxEsSink) Deliver(ctx context.Context, messages []*OutboxMessage) []error {
+	errs := make([]error, len(messages))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	if InsEs == nil {
+		return fail(errors.New("InsEs为空,需要先使用InitEs()进行初始化"))
+	}
+
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client: InsEs.TypedClient,
+		Index:  s.index,
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	var mu sync.Mutex
+	for i, message := range messages {
+		index := s.index
+		if index == "" {
+			index = message.Topic
+		}
+		// 没有 key 时使用发件箱 ID 作为文档 ID，重试与 RetryFailedOutbox 覆盖同一个文档而不是重复写入
+		documentID := message.MsgKey
+		if documentID == "" && message.ID > 0 {
+			documentID = strconv.FormatUint(message.ID, 10)
+		}
+		errs[i] = errors.New("未收到 ES 写入结果")
+		addErr := indexer.Add(ctx, esutil.BulkIndexerItem{
+			Index:      index,
+			Action:     "index",
+			DocumentID: documentID,
+			Body:       bytes.NewReader([]byte(message.Payload)),
+			OnSuccess: func(context.Context, esutil.BulkIndexerItem, esutil.BulkIndexerResponseItem) {
+				mu.Lock()
+				errs[i] = nil
+				mu.Unlock()
+			},
+			OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, resp esutil.BulkIndexerResponseItem, err error) {
+				if err == nil {
+					err = fmt.Errorf("%s: %s", resp.Error.Type, resp.Error.Reason)
+				}
+				mu.Lock()
+				errs[i] = err
+				mu.Unlock()
+			},
+		})
+		if addErr != nil {
+			errs[i] = addErr
+		}
+	}
+	if err = indexer.Close(ctx); err != nil {
+		mu.Lock()
+		for i := range errs {
+			if errs[i] != nil {
+				errs[i] = errors.Join(errs[i], err)
+			}
+		}
+		mu.Unlock()
+	}
+	return errs
+}
+
+// OutboxRelay 轮询发件箱并把事件投递到 sink。
+type OutboxRelay struct {
+	db           *gorm.DB
+	sinks        map[string]OutboxSink
+	batchSize    int
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	lockKey      string
+	errorHandler func(err error)
+}
+
+type WithOutboxRelayOption func(*OutboxRelay)
+
+// WithOutboxRelaySink 为指定 topic 注册 sink，topic 传 OutboxAnyTopic 表示兜底。
+func WithOutboxRelaySink(topic string, sink OutboxSink) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.sinks[topic] = sink
+	}
+}
+
+// WithOutboxRelayDB 指定发件箱所在的数据库连接，默认 InsDB。
+func WithOutboxRelayDB(db *gorm.DB) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.db = db
+	}
+}
+
+// WithOutboxRelayBatchSize 设置每次轮询的最大条数。
+func WithOutboxRelayBatchSize(size int) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithOutboxRelayRetry 设置最大投递次数与指数退避的初始、最大间隔。
+func WithOutboxRelayRetry(maxAttempts int, backoff, maxBackoff time.Duration) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if maxAttempts > 0 {
+			r.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			r.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			r.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithOutboxRelayLockKey 设置多实例部署时互斥轮询使用的 Redis 锁键名。
+func WithOutboxRelayLockKey(key string) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if key != "" {
+			r.lockKey = key
+		}
+	}
+}
+
+// WithOutboxRelayErrorHandler 设置轮询出错时的回调，单条投递失败会记录在 last_error 中不会触发该回调。
+func WithOutboxRelayErrorHandler(handler func(err error)) WithOutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.errorHandler = handler
+	}
+}
+
+// NewOutboxRelay 创建发件箱投递器。
+func NewOutboxRelay(opts ...WithOutboxRelayOption) *OutboxRelay {
+	relay := &OutboxRelay{
+		sinks:       make(map[string]OutboxSink),
+		batchSize:   defaultOutboxBatchSize,
+		maxAttempts: defaultOutboxMaxAttempts,
+		backoff:     defaultOutboxBackoff,
+		maxBackoff:  defaultOutboxMaxBackoff,
+		lockKey:     defaultOutboxLockKey,
+	}
+	for _, opt := range opts {
+		opt(relay)
+	}
+	return relay
+}
+
+// Register 把投递器注册到定时任务中，每个周期先获取 Redis 锁，保证多实例下同一时间只有一个实例在投递。
+func (r *OutboxRelay) Register(cron *CronConfig, interval time.Duration, options ...gocron.JobOption) (gocron.Job, error) {
+	if cron == nil {
+		return nil, errors.New("CronConfig为空,需要先使用InitCronJob()进行初始化")
+	}
+	if InsRedis == nil {
+		return nil, redisClientNilErr()
+	}
+	options = append([]gocron.JobOption{gocron.WithSingletonMode(gocron.LimitModeReschedule)}, options...)
+	return cron.RunJobEveryDuration(interval, gocron.NewTask(func() {
+		if err := r.runWithLock(interval); err != nil && r.errorHandler != nil {
+			r.errorHandler(err)
+		}
+	}), options...)
+}
+
+func (r *OutboxRelay) runWithLock(interval time.Duration) error {
+	expiry := max(interval*2, 10*time.Second)
+	mutex := InsRedis.NewLock(r.lockKey, redsync.WithExpiry(expiry), redsync.WithTries(1))
+	if err := mutex.TryLock(); err != nil {
+		return nil
+	}
+	defer mutex.Unlock()
+
+	ctx, cancel := BackgroundTimeout(expiry)
+	defer cancel()
+	_, err := r.RunOnce(ctx)
+	return err
+}
+
+// RunOnce 执行一次轮询投递，返回投递成功的条数。
+func (r *OutboxRelay) RunOnce(ctx context.Context) (int, error) {
+	db := r.db
+	if db == nil {
+		if InsDB == nil || InsDB.DB == nil {
+			return 0, gormClientNilErr()
+		}
+		db = InsDB.DB
+	}
+	db = db.WithContext(ctx)
+
+	var messages []*OutboxMessage
+	if err := db.
+		Where("status = ? AND next_attempt_at <= ?", OutboxStatusPending, Now()).
+		Order("id").
+		Limit(r.batchSize).
+		Find(&messages).Error; err != nil {
+		return 0, err
+	}
+
+	groups := make(map[string][]*OutboxMessage)
+	var order []string
+	delivered := 0
+	var errs []error
+	for _, message := range messages {
+		sinkKey, ok := r.sinkKey(message.Topic)
+		if !ok {
+			if err := r.markFailed(db, message, fmt.Errorf("topic %s 未注册 sink", message.Topic)); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if _, ok := groups[sinkKey]; !ok {
+			order = append(order, sinkKey)
+		}
+		groups[sinkKey] = append(groups[sinkKey], message)
+	}
+
+	for _, sinkKey := range order {
+		batch := groups[sinkKey]
+		results := r.sinks[sinkKey].Deliver(ctx, batch)
+		for i, message := range batch {
+			var deliverErr error
+			if i < len(results) {
+				deliverErr = results[i]
+			} else {
+				deliverErr = errors.New("sink 未返回投递结果")
+			}
+			if deliverErr != nil {
+				if err := r.markFailed(db, message, deliverErr); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			if err := r.markDelivered(db, message); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			delivered++
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+func (r *OutboxRelay) sinkKey(topic string) (string, bool) {
+	if _, ok := r.sinks[topic]; ok {
+		return topic, true
+	}
+	if _, ok := r.sinks[OutboxAnyTopic]; ok {
+		return OutboxAnyTopic, true
+	}
+	return "", false
+}
+
+func (r *OutboxRelay) markDelivered(db *gorm.DB, message *OutboxMessage) error {
+	now := Now()
+	return db.Model(&OutboxMessage{}).
+		Where("id = ? AND status = ?", message.ID, OutboxStatusPending).
+		Updates(map[string]any{
+			"status":       OutboxStatusDelivered,
+			"attempts":     message.Attempts + 1,
+			"delivered_at": now,
+			"last_error":   "",
+		}).Error
+}
+
+func (r *OutboxRelay) markFailed(db *gorm.DB, message *OutboxMessage, deliverErr error) error {
+	attempts := message.Attempts + 1
+	status := OutboxStatusPending
+	if attempts >= r.maxAttempts {
+		status = OutboxStatusFailed
+	}
+
+	lastError := []rune(deliverErr.Error())
+	if len(lastError) > maxOutboxErrorLength {
+		lastError = lastError[:maxOutboxErrorLength]
+	}
+	return db.Model(&OutboxMessage{}).
+		Where("id = ? AND status = ?", message.ID, OutboxStatusPending).
+		Updates(map[string]any{
+			"status":          status,
+			"attempts":        attempts,
+			"next_attempt_at": Now().Add(retryBackoff(attempts, r.backoff, r.maxBackoff)),
+			"last_error":      string(lastError),
+		}).Error
+}
+
+// RetryFailedOutbox 把超过最大重试次数的事件重新置为待投递，ids 为空时重置全部。
+func RetryFailedOutbox(ctx context.Context, ids ...uint64) (int64, error) {
+	db := DB(ctx).Model(&OutboxMessage{}).Where("status = ?", OutboxStatusFailed)
+	if len(ids) > 0 {
+		db = db.Where("id IN ?", ids)
+	}
+	result := db.Updates(map[string]any{
+		"status":          OutboxStatusPending,
+		"attempts":        0,
+		"next_attempt_at": Now(),
+	})
+	return result.RowsAffected, result.Error
+}
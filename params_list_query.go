@@ -0,0 +1,656 @@
+package wd
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+)
+
+// ListFilterOp 列表过滤操作符。
+type ListFilterOp string
+
+const (
+	ListFilterEq      ListFilterOp = "eq"
+	ListFilterNe      ListFilterOp = "ne"
+	ListFilterIn      ListFilterOp = "in"
+	ListFilterGt      ListFilterOp = "gt"
+	ListFilterLt      ListFilterOp = "lt"
+	ListFilterBetween ListFilterOp = "between"
+	ListFilterLike    ListFilterOp = "like"
+	ListFilterIsNull  ListFilterOp = "isnull"
+)
+
+const (
+	defaultReqListSize     = 20
+	maxReqListSize         = 100
+	defaultListCursorField = "id"
+)
+
+// ListFilter 表示一条解析后的过滤条件，Field 为数据库列名。
+type ListFilter struct {
+	Field  string       `json:"field"`
+	Op     ListFilterOp `json:"op"`
+	Values []string     `json:"values"`
+}
+
+// ListSort 表示一条解析后的排序规则，Field 为数据库列名。
+type ListSort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+type listQueryOptions struct {
+	sortFields   []string
+	filterFields []string
+	defaultSort  string
+	defaultSize  int
+	maxSize      int
+	cursorField  string
+	nullable     []string
+}
+
+type WithListQueryOption func(*listQueryOptions)
+
+// WithListSortFields 设置允许排序的列名白名单。
+func WithListSortFields(fields ...string) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		o.sortFields = append(o.sortFields, fields...)
+	}
+}
+
+// WithListFilterFields 设置允许过滤的列名白名单。
+func WithListFilterFields(fields ...string) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		o.filterFields = append(o.filterFields, fields...)
+	}
+}
+
+// WithListDefaultSort 设置未传 sort 时使用的排序，格式同 sort 参数，例如 "-created_at"。
+func WithListDefaultSort(sort string) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		o.defaultSort = sort
+	}
+}
+
+// WithListDefaultSize 设置未传 size 时的每页数量。
+func WithListDefaultSize(size int) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		if size > 0 {
+			o.defaultSize = size
+		}
+	}
+}
+
+// WithListMaxSize 设置每页数量上限，超出时回退为上限值。
+func WithListMaxSize(size int) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		if size > 0 {
+			o.maxSize = size
+		}
+	}
+}
+
+// WithListCursorField 设置游标分页的兜底唯一列，默认 id。
+func WithListCursorField(field string) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		if field != "" {
+			o.cursorField = field
+		}
+	}
+}
+
+// WithListNullableFields 声明可能为 NULL 的排序列，排序与游标条件按 NULL 小于任何值处理。
+// 未声明的排序列出现 NULL 时无法生成游标，NewPageResult 会返回错误。
+func WithListNullableFields(fields ...string) WithListQueryOption {
+	return func(o *listQueryOptions) {
+		o.nullable = append(o.nullable, fields...)
+	}
+}
+
+// ReqList 通用列表请求参数，支持白名单排序、过滤和游标分页。
+// 查询参数约定如下：
+// - sort=-created_at,name：逗号分隔，"-" 前缀表示倒序
+// - name[like]=foo、status[in]=1,2、created_at[between]=a,b、deleted_at[isnull]=true
+// - 白名单字段直接传 status=1 等同于 status[eq]=1
+// - cursor 为上一页返回的 next_cursor，传入后忽略 page
+type ReqList struct {
+	Page   int    `json:"page" form:"page"`
+	Size   int    `json:"size" form:"size"`
+	Sort   string `json:"sort" form:"sort"`
+	Cursor string `json:"cursor" form:"cursor"`
+
+	Filters []ListFilter `json:"-" form:"-"`
+	Sorts   []ListSort   `json:"-" form:"-"`
+
+	opts          listQueryOptions
+	cursorValues  []any
+	cursorApplied bool
+}
+
+// BindReqList 从 gin 查询参数中解析列表请求。
+func BindReqList(c *gin.Context, opts ...WithListQueryOption) (*ReqList, error) {
+	return ParseReqList(c.Request.URL.Query(), opts...)
+}
+
+// ParseReqList 从 url.Values 中解析列表请求。
+func ParseReqList(values url.Values, opts ...WithListQueryOption) (*ReqList, error) {
+	req := new(ReqList)
+	req.Page, _ = strconv.Atoi(values.Get("page"))
+	req.Size, _ = strconv.Atoi(values.Get("size"))
+	req.Sort = values.Get("sort")
+	req.Cursor = values.Get("cursor")
+	if err := req.ParseQuery(values, opts...); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ParseQuery 解析过滤、排序和游标参数，适用于 ReqList 被嵌入到其他请求结构体并已完成绑定的场景。
+func (r *ReqList) ParseQuery(values url.Values, opts ...WithListQueryOption) error {
+	r.opts = listQueryOptions{
+		defaultSize: defaultReqListSize,
+		maxSize:     maxReqListSize,
+		cursorField: defaultListCursorField,
+	}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	filters, err := parseListFilters(values, r.opts.filterFields)
+	if err != nil {
+		return err
+	}
+	r.Filters = filters
+
+	sortValue := strings.TrimSpace(r.Sort)
+	if sortValue == "" {
+		sortValue = r.opts.defaultSort
+	}
+	sorts, err := parseListSorts(sortValue, r.opts.sortFields, r.Sort != "")
+	if err != nil {
+		return err
+	}
+	r.Sorts = appendListCursorSort(sorts, r.opts.cursorField)
+
+	r.cursorValues = nil
+	r.cursorApplied = false
+	if r.Cursor != "" {
+		values, err := decodeListCursor(r.Cursor, r.sortSignature())
+		if err != nil {
+			return err
+		}
+		if len(values) != len(r.Sorts) {
+			return MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+		}
+		for i, sort := range r.Sorts {
+			if values[i] == nil && !r.isNullable(sort.Field) {
+				return MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+			}
+		}
+		r.cursorValues = values
+		r.cursorApplied = true
+	}
+	return nil
+}
+
+// PageNumber 返回当前页码，游标模式下恒为 1。
+func (r *ReqList) PageNumber() int {
+	if r.cursorApplied || r.Page <= 0 {
+		return 1
+	}
+	return r.Page
+}
+
+// PageSize 返回每页数量。
+func (r *ReqList) PageSize() int {
+	defaultSize, maxSize := r.opts.defaultSize, r.opts.maxSize
+	if defaultSize <= 0 {
+		defaultSize = defaultReqListSize
+	}
+	if maxSize <= 0 {
+		maxSize = maxReqListSize
+	}
+	if r.Size <= 0 {
+		return min(defaultSize, maxSize)
+	}
+	if r.Size > maxSize {
+		return maxSize
+	}
+	return r.Size
+}
+
+// Offset 返回偏移量，游标模式下恒为 0。
+func (r *ReqList) Offset() int {
+	return (r.PageNumber() - 1) * r.PageSize()
+}
+
+// listFieldQuery 由 gen 生成的根查询对象（例如 query.User）实现。
+type listFieldQuery interface {
+	GetFieldByName(string) (field.OrderExpr, bool)
+}
+
+// Conditions 生成过滤条件，不包含游标条件，可直接用于 Count 统计总数。
+func (r *ReqList) Conditions(query listFieldQuery) ([]gen.Condition, error) {
+	conds := make([]gen.Condition, 0, len(r.Filters))
+	for _, filter := range r.Filters {
+		column, err := listColumn(query, filter.Field)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := buildListFilterExpr(column, filter)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, expr)
+	}
+	return conds, nil
+}
+
+// CursorConditions 生成游标分页条件，未传 cursor 时返回 nil。
+func (r *ReqList) CursorConditions(query listFieldQuery) ([]gen.Condition, error) {
+	if !r.cursorApplied {
+		return nil, nil
+	}
+
+	columns := make([]field.OrderExpr, 0, len(r.Sorts))
+	for _, sort := range r.Sorts {
+		column, err := listColumn(query, sort.Field)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	// (a > ?) OR (a = ? AND b > ?) OR ...
+	// 可空列按 NULL 最小处理：正序时 NULL 之后是所有非 NULL 值，倒序时非 NULL 值之后还有 NULL
+	branches := make([]field.Expr, 0, len(r.Sorts))
+	for i, sort := range r.Sorts {
+		value := r.cursorValues[i]
+		if value == nil && sort.Desc {
+			continue
+		}
+		parts := make([]field.Expr, 0, i+1)
+		for j := 0; j < i; j++ {
+			if r.cursorValues[j] == nil {
+				parts = append(parts, field.NewUnsafeFieldRaw("? IS NULL", columns[j]))
+			} else {
+				parts = append(parts, field.NewUnsafeFieldRaw("? = ?", columns[j], r.cursorValues[j]))
+			}
+		}
+		switch {
+		case value == nil:
+			parts = append(parts, field.NewUnsafeFieldRaw("? IS NOT NULL", columns[i]))
+		case !sort.Desc:
+			parts = append(parts, field.NewUnsafeFieldRaw("? > ?", columns[i], value))
+		case r.isNullable(sort.Field):
+			parts = append(parts, field.NewUnsafeFieldRaw("(? < ? OR ? IS NULL)", columns[i], value, columns[i]))
+		default:
+			parts = append(parts, field.NewUnsafeFieldRaw("? < ?", columns[i], value))
+		}
+		branches = append(branches, field.And(parts...))
+	}
+	if len(branches) == 0 {
+		return []gen.Condition{field.NewUnsafeFieldRaw("1 = 0")}, nil
+	}
+	return []gen.Condition{field.Or(branches...)}, nil
+}
+
+// Orders 生成排序表达式，末尾总会带上游标兜底列。
+// 可空列会先按是否为 NULL 排序，使各数据库中 NULL 都排在正序的最前、倒序的最后。
+func (r *ReqList) Orders(query listFieldQuery) ([]field.Expr, error) {
+	orders := make([]field.Expr, 0, len(r.Sorts))
+	for _, sort := range r.Sorts {
+		column, err := listColumn(query, sort.Field)
+		if err != nil {
+			return nil, err
+		}
+		if r.isNullable(sort.Field) {
+			isNull := field.NewUnsafeFieldRaw("? IS NULL", column)
+			if sort.Desc {
+				orders = append(orders, isNull)
+			} else {
+				orders = append(orders, isNull.Desc())
+			}
+		}
+		if sort.Desc {
+			orders = append(orders, column.Desc())
+		} else {
+			orders = append(orders, column)
+		}
+	}
+	return orders, nil
+}
+
+type listRootQuery[R any] interface {
+	listFieldQuery
+	Where(...gen.Condition) R
+}
+
+type listChainQuery[R any] interface {
+	Order(...field.Expr) R
+	Limit(int) R
+	Offset(int) R
+}
+
+// ApplyList 将过滤、游标、排序和分页一次性应用到查询对象本身上，例如 query.User。
+// 查询会多取一条用于判断 has_more，结果需交给 NewPageResult 处理。
+// 与 ApplyPage 一样不支持传入 query.User.Where(...) 这类中间接口对象。
+func ApplyList[Q listRootQuery[R], R listChainQuery[R]](req *ReqList, query Q) (R, error) {
+	var zero R
+	conds, err := req.Conditions(query)
+	if err != nil {
+		return zero, err
+	}
+	cursorConds, err := req.CursorConditions(query)
+	if err != nil {
+		return zero, err
+	}
+	orders, err := req.Orders(query)
+	if err != nil {
+		return zero, err
+	}
+	return query.Where(append(conds, cursorConds...)...).
+		Order(orders...).
+		Limit(req.PageSize() + 1).
+		Offset(req.Offset()), nil
+}
+
+// PageResult 通用分页响应。
+type PageResult[T any] struct {
+	List       []T    `json:"list"`
+	Total      int64  `json:"total"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPageResult 根据 ApplyList 查询出的结果生成分页响应。
+// list 中多取的一条会被裁掉，并以当前页最后一条记录的排序列生成 next_cursor。
+func NewPageResult[T any](req *ReqList, list []T, total int64) (*PageResult[T], error) {
+	result := &PageResult[T]{List: list, Total: total}
+	if result.List == nil {
+		result.List = make([]T, 0)
+	}
+
+	size := req.PageSize()
+	if len(result.List) <= size {
+		return result, nil
+	}
+	result.List = result.List[:size]
+	result.HasMore = true
+
+	values, err := req.listCursorValues(&result.List[size-1])
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := encodeListCursor(req.sortSignature(), values)
+	if err != nil {
+		return nil, err
+	}
+	result.NextCursor = cursor
+	return result, nil
+}
+
+func (r *ReqList) isNullable(name string) bool {
+	return slices.Contains(r.opts.nullable, name)
+}
+
+func (r *ReqList) sortSignature() string {
+	items := make([]string, 0, len(r.Sorts))
+	for _, sort := range r.Sorts {
+		if sort.Desc {
+			items = append(items, "-"+sort.Field)
+		} else {
+			items = append(items, sort.Field)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func listColumn(query listFieldQuery, name string) (field.OrderExpr, error) {
+	column, ok := query.GetFieldByName(name)
+	if !ok {
+		return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 不存在", name))
+	}
+	return column, nil
+}
+
+func parseListFilters(values url.Values, allowed []string) ([]ListFilter, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	filters := make([]ListFilter, 0)
+	for _, key := range keys {
+		name, op, explicit := parseListFilterKey(key)
+		if !slices.Contains(allowed, name) {
+			if explicit {
+				return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 不支持过滤", name))
+			}
+			continue
+		}
+
+		items := splitListValues(values[key])
+		switch op {
+		case ListFilterEq, ListFilterNe, ListFilterGt, ListFilterLt, ListFilterLike, ListFilterIsNull:
+			if len(items) != 1 {
+				return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 的 %s 过滤只能传一个值", name, op))
+			}
+		case ListFilterIn:
+			if len(items) == 0 {
+				return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 的 in 过滤不能为空", name))
+			}
+		case ListFilterBetween:
+			if len(items) != 2 {
+				return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 的 between 过滤需要两个值", name))
+			}
+		default:
+			return nil, MsgErrInvalidParam(fmt.Errorf("不支持的过滤操作符 %s", op))
+		}
+		if op == ListFilterIsNull {
+			if _, err := strconv.ParseBool(items[0]); err != nil {
+				return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 的 isnull 过滤只能为 true 或 false", name))
+			}
+		}
+		filters = append(filters, ListFilter{Field: name, Op: op, Values: items})
+	}
+	return filters, nil
+}
+
+// parseListFilterKey 解析 name[op] 形式的查询参数名。
+func parseListFilterKey(key string) (string, ListFilterOp, bool) {
+	name, rest, found := strings.Cut(key, "[")
+	if !found || !strings.HasSuffix(rest, "]") {
+		return key, ListFilterEq, false
+	}
+	return name, ListFilterOp(strings.ToLower(strings.TrimSuffix(rest, "]"))), true
+}
+
+func splitListValues(values []string) []string {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		for item := range strings.SplitSeq(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func parseListSorts(value string, allowed []string, strict bool) ([]ListSort, error) {
+	sorts := make([]ListSort, 0)
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sort := ListSort{Field: strings.TrimLeft(item, "+-"), Desc: strings.HasPrefix(item, "-")}
+		// 默认排序由开发者配置，不受白名单限制
+		if strict && !slices.Contains(allowed, sort.Field) {
+			return nil, MsgErrInvalidParam(fmt.Errorf("字段 %s 不支持排序", sort.Field))
+		}
+		if slices.ContainsFunc(sorts, func(s ListSort) bool { return s.Field == sort.Field }) {
+			continue
+		}
+		sorts = append(sorts, sort)
+	}
+	return sorts, nil
+}
+
+// appendListCursorSort 在排序末尾追加唯一列，保证游标分页结果稳定。
+func appendListCursorSort(sorts []ListSort, cursorField string) []ListSort {
+	if slices.ContainsFunc(sorts, func(s ListSort) bool { return s.Field == cursorField }) {
+		return sorts
+	}
+	desc := len(sorts) > 0 && sorts[len(sorts)-1].Desc
+	return append(sorts, ListSort{Field: cursorField, Desc: desc})
+}
+
+func buildListFilterExpr(column field.Expr, filter ListFilter) (field.Expr, error) {
+	switch filter.Op {
+	case ListFilterEq:
+		return field.NewUnsafeFieldRaw("? = ?", column, filter.Values[0]), nil
+	case ListFilterNe:
+		return field.NewUnsafeFieldRaw("? <> ?", column, filter.Values[0]), nil
+	case ListFilterGt:
+		return field.NewUnsafeFieldRaw("? > ?", column, filter.Values[0]), nil
+	case ListFilterLt:
+		return field.NewUnsafeFieldRaw("? < ?", column, filter.Values[0]), nil
+	case ListFilterIn:
+		return field.NewUnsafeFieldRaw("? IN ?", column, filter.Values), nil
+	case ListFilterBetween:
+		return field.NewUnsafeFieldRaw("? BETWEEN ? AND ?", column, filter.Values[0], filter.Values[1]), nil
+	case ListFilterLike:
+		return field.NewUnsafeFieldRaw("? LIKE ?", column, fmt.Sprintf("%%%s%%", filter.Values[0])), nil
+	case ListFilterIsNull:
+		if isNull, _ := strconv.ParseBool(filter.Values[0]); isNull {
+			return field.NewUnsafeFieldRaw("? IS NULL", column), nil
+		}
+		return field.NewUnsafeFieldRaw("? IS NOT NULL", column), nil
+	}
+	return nil, MsgErrInvalidParam(fmt.Errorf("不支持的过滤操作符 %s", filter.Op))
+}
+
+type listCursorPayload struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+	// Times 为时间类型值的下标，时间按 RFC3339Nano 带时区编码，解码后还原为 time.Time
+	Times []int `json:"t,omitempty"`
+}
+
+func encodeListCursor(signature string, values []any) (string, error) {
+	payload := listCursorPayload{Sort: signature, Values: make([]any, len(values))}
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			payload.Values[i] = t.Format(time.RFC3339Nano)
+			payload.Times = append(payload.Times, i)
+			continue
+		}
+		payload.Values[i] = value
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", MsgErrServerBusy("生成游标失败", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeListCursor(cursor, signature string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var payload listCursorPayload
+	if err = decoder.Decode(&payload); err != nil {
+		return nil, MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+	}
+	if payload.Sort != signature {
+		return nil, MsgErrInvalidParam(fmt.Errorf("cursor 与排序参数不匹配"))
+	}
+	for i, value := range payload.Values {
+		if number, ok := value.(json.Number); ok {
+			payload.Values[i] = number.String()
+		}
+	}
+	for _, i := range payload.Times {
+		if i < 0 || i >= len(payload.Values) {
+			return nil, MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+		}
+		text, _ := payload.Values[i].(string)
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, MsgErrInvalidParam(fmt.Errorf("cursor 无效"))
+		}
+		payload.Values[i] = t
+	}
+	return payload.Values, nil
+}
+
+// listCursorValues 按排序列名从模型中取出游标值。
+func (r *ReqList) listCursorValues(row any) ([]any, error) {
+	columns := make([]string, 0, len(r.Sorts))
+	for _, sort := range r.Sorts {
+		columns = append(columns, sort.Field)
+	}
+	values, err := modelColumnValues(row, columns...)
+	if err != nil {
+		return nil, MsgErrServerBusy("生成游标失败", err)
+	}
+	for i, value := range values {
+		if values[i], err = normalizeListCursorValue(value); err != nil {
+			return nil, MsgErrServerBusy("生成游标失败", err)
+		}
+		if values[i] == nil && !r.isNullable(columns[i]) {
+			return nil, MsgErrServerBusy("生成游标失败", fmt.Errorf("排序字段 %s 为 NULL，需要通过 WithListNullableFields 声明", columns[i]))
+		}
+	}
+	return values, nil
+}
+
+func normalizeListCursorValue(value any) (any, error) {
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+	// 带时区的时间保留为 time.Time，由 encodeListCursor 按 RFC3339Nano 编码，避免按应用时区格式化后与数据库时区错位
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		return *v, nil
+	case DateTime:
+		return time.Time(v), nil
+	case *DateTime:
+		return time.Time(*v), nil
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer {
+		value = rv.Elem().Interface()
+	}
+	switch v := value.(type) {
+	case []byte:
+		return string(v), nil
+	}
+	return value, nil
+}
@@ -23,6 +23,7 @@ var (
 // init 初始化验证器、翻译器以及自定义规则。
 func init() {
 	binding.Validator = &patchFieldStructValidator{}
+	binding.YAML = patchFieldYAMLBinding{}
 
 	v, ok := binding.Validator.Engine().(*validator.Validate)
 	if !ok {
@@ -39,6 +40,8 @@ func init() {
 	registerPhoneValidator(v)
 	registerIDCarValidator(v)
 	registerDecimalPlacesValidator(v)
+	registerNotNullValidator(v)
+	registerJSONPatchValidator(v)
 }
 
 // TranslateError 将常见解析与校验错误转换为可读信息。
@@ -143,6 +146,55 @@ func registerDecimalPlacesValidator(v *validator.Validate) {
 	)
 }
 
+// registerNotNullValidator 注册 notnull 规则，用于 PATCH 请求中禁止把不可空的列显式设置为 null。
+func registerNotNullValidator(v *validator.Validate) {
+	v.RegisterValidation("notnull", func(fl validator.FieldLevel) bool {
+		field := fl.Field()
+		switch field.Kind() {
+		case reflect.Invalid:
+			return false
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			return !field.IsNil()
+		default:
+			return true
+		}
+	}, true)
+
+	v.RegisterTranslation("notnull", validatorTrans,
+		func(ut ut.Translator) error {
+			return ut.Add("notnull", "{0}不能为null", true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("notnull", fe.Field())
+			return t
+		},
+	)
+}
+
+// registerJSONPatchValidator 注册 jsonpatch 规则，校验 JSONMergePatch/JSONPatch 的结构，Field[T] 中会自动追加。
+func registerJSONPatchValidator(v *validator.Validate) {
+	v.RegisterValidation("jsonpatch", func(fl validator.FieldLevel) bool {
+		patch, ok := fl.Field().Interface().(patchJSONDocument)
+		return !ok || patch.Validate() == nil
+	})
+
+	v.RegisterTranslation("jsonpatch", validatorTrans,
+		func(ut ut.Translator) error {
+			return ut.Add("jsonpatch", "{0}格式不正确: {1}", true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			reason := ""
+			if patch, ok := fe.Value().(patchJSONDocument); ok {
+				if err := patch.Validate(); err != nil {
+					reason = err.Error()
+				}
+			}
+			t, _ := ut.T("jsonpatch", fe.Field(), reason)
+			return t
+		},
+	)
+}
+
 // registerTranslator 创建中文翻译器并挂载默认翻译。
 func registerTranslator(v *validator.Validate) (trans ut.Translator, err error) {
 	// 初始化中文翻译器
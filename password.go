@@ -0,0 +1,486 @@
+package wd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrPasswordHashUnknown = errors.New("无法识别的密码哈希格式")
+	ErrPasswordLength      = errors.New("密码长度不符合要求")
+	ErrPasswordComplexity  = errors.New("密码复杂度不符合要求")
+	ErrPasswordCommon      = errors.New("密码过于常见或已经泄露")
+	ErrPasswordPersonal    = errors.New("密码不能包含用户名、手机号等个人信息")
+)
+
+// InsPasswordHasher 是 PasswordEncryption 使用的哈希算法，为空时使用 bcrypt.DefaultCost。
+var InsPasswordHasher PasswordHasher
+
+// PasswordHasher 密码哈希算法。Verify 使用编码串里记录的参数，因此调整参数后旧哈希仍然可以校验。
+type PasswordHasher interface {
+	// Hash 生成编码后的哈希串。
+	Hash(password string) (string, error)
+	// Verify 校验密码与哈希串是否匹配。
+	Verify(password, encoded string) (bool, error)
+	// Identify 判断哈希串是否属于当前算法。
+	Identify(encoded string) bool
+	// NeedsRehash 判断同算法的哈希串参数是否与当前配置不同。
+	NeedsRehash(encoded string) bool
+}
+
+// InitPasswordHasher 设置 PasswordEncryption 使用的哈希算法，已有的其它格式哈希仍可通过 PasswordVerify 校验并提示升级。
+func InitPasswordHasher(hasher PasswordHasher) {
+	InsPasswordHasher = hasher
+}
+
+func currentPasswordHasher() PasswordHasher {
+	if InsPasswordHasher != nil {
+		return InsPasswordHasher
+	}
+	return NewBcryptHasher(bcrypt.DefaultCost)
+}
+
+// PasswordVerify 用来校验密码，needsRehash 为 true 表示哈希不是当前算法或参数，登录成功后应使用 PasswordEncryption 重新生成并保存。
+func PasswordVerify(password, encoded string) (ok bool, needsRehash bool, err error) {
+	if password == "" || encoded == "" {
+		return false, false, nil
+	}
+	current := currentPasswordHasher()
+	hashers := []PasswordHasher{current, NewArgon2idHasher(Argon2idParams{}), NewScryptHasher(ScryptParams{}), NewBcryptHasher(bcrypt.DefaultCost)}
+	for _, hasher := range hashers {
+		if !hasher.Identify(encoded) {
+			continue
+		}
+		if ok, err = hasher.Verify(password, encoded); err != nil || !ok {
+			return false, false, err
+		}
+		return true, !current.Identify(encoded) || current.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrPasswordHashUnknown
+}
+
+func passwordRandomSalt(size uint32) ([]byte, error) {
+	salt := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// passwordParseParams 用来解析 PHC 格式中 m=65536,t=1,p=4 形式的参数段。
+func passwordParseParams(text string) (map[string]uint64, error) {
+	params := make(map[string]uint64)
+	for _, item := range strings.Split(text, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("哈希参数 %q 格式不正确", item)
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("哈希参数 %q 格式不正确: %w", item, err)
+		}
+		params[key] = n
+	}
+	return params, nil
+}
+
+// BcryptHasher 使用 bcrypt，哈希串为 $2a$ 开头的标准格式。
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher 创建 bcrypt 哈希算法，cost 超出范围时使用 bcrypt.DefaultCost。
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+// Hash 实现 PasswordHasher。
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Verify 实现 PasswordHasher。
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Identify 实现 PasswordHasher。
+func (h *BcryptHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash 实现 PasswordHasher。
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// Argon2idParams argon2id 参数，零值字段使用默认值。
+type Argon2idParams struct {
+	Memory      uint32 // 内存，单位 KiB，默认 65536
+	Iterations  uint32 // 迭代次数，默认 1
+	Parallelism uint8  // 并行度，默认 4
+	SaltLength  uint32 // 盐长度，默认 16
+	KeyLength   uint32 // 输出长度，默认 32
+}
+
+// Argon2idHasher 使用 argon2id，哈希串为 $argon2id$v=19$m=65536,t=1,p=4$<盐>$<哈希>。
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher 创建 argon2id 哈希算法。
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = 64 * 1024
+	}
+	if params.Iterations == 0 {
+		params.Iterations = 1
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = 4
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = 16
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = 32
+	}
+	return &Argon2idHasher{params: params}
+}
+
+// Hash 实现 PasswordHasher。
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := passwordRandomSalt(h.params.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify 实现 PasswordHasher。
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+// Identify 实现 PasswordHasher。
+func (h *Argon2idHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// NeedsRehash 实现 PasswordHasher。
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory || params.Iterations != h.params.Iterations || params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength || uint32(len(key)) != h.params.KeyLength
+}
+
+func (h *Argon2idHasher) decode(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrPasswordHashUnknown
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return params, nil, nil, fmt.Errorf("不支持的 argon2 版本 %s", parts[2])
+	}
+	values, err := passwordParseParams(parts[3])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if values["m"] == 0 || values["t"] == 0 || values["p"] == 0 || values["p"] > 255 {
+		return params, nil, nil, fmt.Errorf("argon2id 参数 %s 不正确", parts[3])
+	}
+	params.Memory, params.Iterations, params.Parallelism = uint32(values["m"]), uint32(values["t"]), uint8(values["p"])
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// ScryptParams scrypt 参数，零值字段使用默认值。
+type ScryptParams struct {
+	LogN       uint8  // N 的以 2 为底的对数，默认 15，即 N=32768
+	R          int    // 块大小，默认 8
+	P          int    // 并行度，默认 1
+	SaltLength uint32 // 盐长度，默认 16
+	KeyLength  int    // 输出长度，默认 32
+}
+
+// ScryptHasher 使用 scrypt，哈希串为 $scrypt$ln=15,r=8,p=1$<盐>$<哈希>。
+type ScryptHasher struct {
+	params ScryptParams
+}
+
+// NewScryptHasher 创建 scrypt 哈希算法。
+func NewScryptHasher(params ScryptParams) *ScryptHasher {
+	if params.LogN == 0 {
+		params.LogN = 15
+	}
+	if params.R == 0 {
+		params.R = 8
+	}
+	if params.P == 0 {
+		params.P = 1
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = 16
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = 32
+	}
+	return &ScryptHasher{params: params}
+}
+
+// Hash 实现 PasswordHasher。
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := passwordRandomSalt(h.params.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	p := h.params
+	key, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", p.LogN, p.R, p.P,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify 实现 PasswordHasher。
+func (h *ScryptHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	actual, err := scrypt.Key([]byte(password), salt, 1<<params.LogN, params.R, params.P, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+// Identify 实现 PasswordHasher。
+func (h *ScryptHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
+}
+
+// NeedsRehash 实现 PasswordHasher。
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.LogN != h.params.LogN || params.R != h.params.R || params.P != h.params.P ||
+		uint32(len(salt)) != h.params.SaltLength || len(key) != h.params.KeyLength
+}
+
+func (h *ScryptHasher) decode(encoded string) (ScryptParams, []byte, []byte, error) {
+	var params ScryptParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return params, nil, nil, ErrPasswordHashUnknown
+	}
+	values, err := passwordParseParams(parts[2])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if values["ln"] == 0 || values["ln"] > 62 || values["r"] == 0 || values["p"] == 0 {
+		return params, nil, nil, fmt.Errorf("scrypt 参数 %s 不正确", parts[2])
+	}
+	params.LogN, params.R, params.P = uint8(values["ln"]), int(values["r"]), int(values["p"])
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// PasswordPolicy 密码策略，在 PasswordValidateStrength 的长度与复杂度规则之外，
+// 还会拒绝常见或已泄露的密码以及包含个人信息的密码。
+type PasswordPolicy struct {
+	minLen         int
+	maxLen         int
+	minClasses     int
+	allowSpace     bool
+	common         map[string]struct{}
+	breachedSHA1   map[string]struct{}
+	minPersonalLen int
+}
+
+// WithPasswordPolicyOption 密码策略的配置项。
+type WithPasswordPolicyOption func(*PasswordPolicy) error
+
+// WithPasswordPolicyLength 设置长度范围，默认 8 到 64。
+func WithPasswordPolicyLength(minLen, maxLen int) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		p.minLen, p.maxLen = minLen, maxLen
+		return nil
+	}
+}
+
+// WithPasswordPolicyMinClasses 设置至少包含大写、小写、数字、特殊字符中的几类，默认 4 类。
+func WithPasswordPolicyMinClasses(n int) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		p.minClasses = n
+		return nil
+	}
+}
+
+// WithPasswordPolicyAllowSpace 设置是否允许空格，默认不允许。
+func WithPasswordPolicyAllowSpace(allow bool) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		p.allowSpace = allow
+		return nil
+	}
+}
+
+// WithPasswordPolicyCommon 添加常见密码，比较时忽略大小写。
+func WithPasswordPolicyCommon(passwords ...string) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		for _, password := range passwords {
+			p.addListEntry(password)
+		}
+		return nil
+	}
+}
+
+// WithPasswordPolicyListFile 从本地文件加载常见或已泄露密码，每行一条，空行与 # 开头的行忽略。
+// 行内容为 40 位十六进制时按 SHA-1 处理，兼容 HIBP 导出的 "SHA1:次数" 格式；其余按明文忽略大小写比较。
+func WithPasswordPolicyListFile(path string) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			p.addListEntry(scanner.Text())
+		}
+		if err = scanner.Err(); err != nil {
+			return fmt.Errorf("读取密码列表 %s 失败: %w", path, err)
+		}
+		return nil
+	}
+}
+
+// WithPasswordPolicyPersonalMinLen 设置个人信息参与包含检查的最小长度，默认 4，过短的用户名不检查。
+func WithPasswordPolicyPersonalMinLen(n int) WithPasswordPolicyOption {
+	return func(p *PasswordPolicy) error {
+		p.minPersonalLen = n
+		return nil
+	}
+}
+
+// NewPasswordPolicy 创建密码策略，加载列表文件失败时返回错误。
+func NewPasswordPolicy(opts ...WithPasswordPolicyOption) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		minLen:         8,
+		maxLen:         64,
+		minClasses:     4,
+		common:         make(map[string]struct{}),
+		breachedSHA1:   make(map[string]struct{}),
+		minPersonalLen: 4,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *PasswordPolicy) addListEntry(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	if hash, _, _ := strings.Cut(line, ":"); len(hash) == sha1.Size*2 {
+		if _, err := hex.DecodeString(hash); err == nil {
+			p.breachedSHA1[strings.ToUpper(hash)] = struct{}{}
+			return
+		}
+	}
+	p.common[strings.ToLower(line)] = struct{}{}
+}
+
+// Validate 用来校验密码，personal 传入用户名、手机号、邮箱等，密码包含它们时返回 ErrPasswordPersonal。
+// 返回的错误可以用 errors.Is 判断类型。
+func (p *PasswordPolicy) Validate(password string, personal ...string) error {
+	stats := analyzePassword(password)
+	if stats.length < p.minLen || (p.maxLen > 0 && stats.length > p.maxLen) {
+		return fmt.Errorf("%w: 长度需要在 %d 到 %d 之间", ErrPasswordLength, p.minLen, p.maxLen)
+	}
+	if stats.space && !p.allowSpace {
+		return fmt.Errorf("%w: 不能包含空格", ErrPasswordComplexity)
+	}
+	if stats.classes() < p.minClasses {
+		return fmt.Errorf("%w: 需要至少包含大写字母、小写字母、数字、特殊字符中的 %d 类", ErrPasswordComplexity, p.minClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.common[lower]; ok {
+		return ErrPasswordCommon
+	}
+	if len(p.breachedSHA1) > 0 {
+		sum := sha1.Sum([]byte(password))
+		if _, ok := p.breachedSHA1[strings.ToUpper(hex.EncodeToString(sum[:]))]; ok {
+			return ErrPasswordCommon
+		}
+	}
+
+	for _, info := range personal {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len([]rune(info)) >= p.minPersonalLen && strings.Contains(lower, info) {
+			return ErrPasswordPersonal
+		}
+	}
+	return nil
+}
@@ -2,14 +2,25 @@ package wd
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
 )
 
+// FieldParamNull 是 form、query、multipart 参数中表示显式 null 的取值，可在启动时修改。
+var FieldParamNull = "null"
+
 // Field 用来区分字段是否传入、是否显式传入 null，以及最终的新值。
 type Field[T any] struct {
-	Set   bool
-	Null  bool
-	Value T
+	Set   bool `form:"-"`
+	Null  bool `form:"-"`
+	Value T    `form:"-"`
 }
 
 type patchFieldValidationMarker interface {
@@ -33,6 +44,13 @@ func (f Field[T]) patchFieldValidationValue() any {
 	return f.Value
 }
 
+func (f *Field[T]) patchFieldSetNull() {
+	var zero T
+	f.Set = true
+	f.Null = true
+	f.Value = zero
+}
+
 // IsSet 用来判断字段是否在请求中显式出现过。
 func (f Field[T]) IsSet() bool {
 	return f.Set
@@ -61,3 +79,152 @@ func (f *Field[T]) UnmarshalJSON(data []byte) error {
 	f.Null = false
 	return json.Unmarshal(trimmed, &f.Value)
 }
+
+// UnmarshalParam 用来支持 gin 的 form、query、multipart 绑定：参数缺失时保持未设置，
+// 值为 FieldParamNull 时视为 null，空字符串对非字符串类型视为零值。
+func (f *Field[T]) UnmarshalParam(param string) error {
+	f.Set = true
+	var zero T
+	f.Value = zero
+	if param == FieldParamNull {
+		f.Null = true
+		return nil
+	}
+
+	f.Null = false
+	return patchFieldParseParam(param, reflect.ValueOf(&f.Value).Elem())
+}
+
+// UnmarshalYAML 用来支持 YAML 解析。解码器遇到 null 时不会调用这里，gin 绑定中的显式 null 由 patchFieldYAMLBinding 补充标记。
+func (f *Field[T]) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw any
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	f.Set = true
+	var zero T
+	f.Value = zero
+	if raw == nil {
+		f.Null = true
+		return nil
+	}
+
+	f.Null = false
+	// go-yaml 不会为 nil 指针分配内存，先逐层分配再解码到最内层
+	value := reflect.ValueOf(&f.Value).Elem()
+	for value.Kind() == reflect.Ptr {
+		value.Set(reflect.New(value.Type().Elem()))
+		value = value.Elem()
+	}
+	return unmarshal(value.Addr().Interface())
+}
+
+// UnmarshalXML 用来支持 XML 解析，带 nil="true" 属性（如 xsi:nil）的元素视为显式 null，
+// 只实现了 UnmarshalParam 的类型（如 DateOnly）按元素文本解析。
+func (f *Field[T]) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	f.Set = true
+	var zero T
+	f.Value = zero
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "nil" && attr.Value == "true" {
+			f.Null = true
+			return d.Skip()
+		}
+	}
+
+	f.Null = false
+	if _, ok := any(&f.Value).(xml.Unmarshaler); !ok {
+		if _, ok := any(&f.Value).(binding.BindUnmarshaler); ok {
+			var text string
+			if err := d.DecodeElement(&text, &start); err != nil {
+				return err
+			}
+			return patchFieldParseParam(text, reflect.ValueOf(&f.Value).Elem())
+		}
+	}
+	return d.DecodeElement(&f.Value, &start)
+}
+
+// UnmarshalXMLAttr 用来支持 XML 属性，规则与 UnmarshalParam 相同。
+func (f *Field[T]) UnmarshalXMLAttr(attr xml.Attr) error {
+	return f.UnmarshalParam(attr.Value)
+}
+
+// patchFieldParseParam 用来把单个参数字符串解析到 value，优先使用类型自身的 UnmarshalParam/UnmarshalText。
+func patchFieldParseParam(text string, value reflect.Value) error {
+	if value.Kind() == reflect.Ptr {
+		elem := reflect.New(value.Type().Elem())
+		if err := patchFieldParseParam(text, elem.Elem()); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	}
+
+	switch target := value.Addr().Interface().(type) {
+	case binding.BindUnmarshaler:
+		return target.UnmarshalParam(text)
+	case encoding.TextUnmarshaler:
+		return target.UnmarshalText([]byte(text))
+	}
+
+	if value.Kind() == reflect.String {
+		value.SetString(text)
+		return nil
+	}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		value.SetZero()
+		return nil
+	}
+
+	var err error
+	switch value.Kind() {
+	case reflect.Bool:
+		var parsed bool
+		if parsed, err = strconv.ParseBool(trimmed); err == nil {
+			value.SetBool(parsed)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var parsed int64
+		if parsed, err = strconv.ParseInt(trimmed, 10, value.Type().Bits()); err == nil {
+			value.SetInt(parsed)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var parsed uint64
+		if parsed, err = strconv.ParseUint(trimmed, 10, value.Type().Bits()); err == nil {
+			value.SetUint(parsed)
+		}
+	case reflect.Float32, reflect.Float64:
+		var parsed float64
+		if parsed, err = strconv.ParseFloat(trimmed, value.Type().Bits()); err == nil {
+			value.SetFloat(parsed)
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes([]byte(text))
+			return nil
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal([]byte(trimmed), value.Addr().Interface())
+			break
+		}
+		// 非 JSON 数组时按逗号分隔
+		items := strings.Split(text, ",")
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err = patchFieldParseParam(strings.TrimSpace(item), slice.Index(i)); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			value.Set(slice)
+		}
+	default:
+		err = json.Unmarshal([]byte(trimmed), value.Addr().Interface())
+	}
+	if err != nil {
+		return fmt.Errorf("参数 %q 无法解析为 %s: %w", text, value.Type(), err)
+	}
+	return nil
+}
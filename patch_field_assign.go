@@ -1,6 +1,7 @@
 package wd
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"errors"
 	"fmt"
@@ -212,6 +213,12 @@ func parsePatchOldValue[T any](oldValue any) (patchOldValueInfo[T], error) {
 }
 
 func defaultPatchEqual[T any](oldValue, newValue T) bool {
+	// 加密列只比较明文，读取时记录的密钥 ID 与密文不参与比较
+	if isEncryptedValue(oldValue) && isEncryptedValue(newValue) {
+		oldPlain, oldErr := any(oldValue).(encryptedColumn).encryptedPlaintext()
+		newPlain, newErr := any(newValue).(encryptedColumn).encryptedPlaintext()
+		return oldErr == nil && newErr == nil && bytes.Equal(oldPlain, newPlain)
+	}
 	return reflect.DeepEqual(oldValue, newValue)
 }
 
@@ -0,0 +1,156 @@
+package wd
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"gorm.io/gen/field"
+)
+
+const (
+	GenUpdateSkipEqual       = "equal"        // 新值与旧值相同
+	GenUpdateSkipAlreadyNull = "already_null" // 请求置空，旧值已经是 null
+)
+
+// GenUpdateChange 请求中显式传入的一个字段的比较结果。
+type GenUpdateChange struct {
+	// Field 请求结构体的字段名
+	Field string `json:"field"`
+	// Column 目标列名
+	Column string `json:"column"`
+	// OldKnown 为 false 表示 oldModel 为 nil，没有旧值可比较
+	OldKnown bool `json:"old_known"`
+	Old      any  `json:"old"`
+	New      any  `json:"new"`
+	// SetNull 请求显式传了 null
+	SetNull bool `json:"set_null"`
+	// Changed 为 true 时会生成更新表达式
+	Changed bool `json:"changed"`
+	// SkipReason 未生成更新表达式的原因，见 GenUpdateSkip* 常量
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// GenUpdateDiffValue 变更列的新旧值。
+type GenUpdateDiffValue struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// GenUpdateChangeSet BuildGenUpdates 的比较结果，按请求结构体的字段顺序排列。
+type GenUpdateChangeSet []GenUpdateChange
+
+// DiffGenUpdates 用来预览 BuildGenUpdates 的结果，参数与 BuildGenUpdates 相同，不生成更新表达式也不访问数据库。
+// 未传入的字段和 patch:"-" 的字段不出现在结果中。
+func DiffGenUpdates(req any, oldModel any, table any) (GenUpdateChangeSet, error) {
+	_, changes, err := buildGenUpdates(req, oldModel, table, true)
+	return changes, err
+}
+
+// BuildGenUpdatesDiff 与 BuildGenUpdates 相同，同时返回每个字段的比较结果。
+func BuildGenUpdatesDiff(req any, oldModel any, table any) ([]field.AssignExpr, GenUpdateChangeSet, error) {
+	return buildGenUpdates(req, oldModel, table, true)
+}
+
+// Changed 返回会生成更新表达式的字段。
+func (s GenUpdateChangeSet) Changed() GenUpdateChangeSet {
+	changed := make(GenUpdateChangeSet, 0, len(s))
+	for _, change := range s {
+		if change.Changed {
+			changed = append(changed, change)
+		}
+	}
+	return changed
+}
+
+// Skipped 返回显式传入但因与旧值相同而跳过的字段。
+func (s GenUpdateChangeSet) Skipped() GenUpdateChangeSet {
+	skipped := make(GenUpdateChangeSet, 0, len(s))
+	for _, change := range s {
+		if !change.Changed {
+			skipped = append(skipped, change)
+		}
+	}
+	return skipped
+}
+
+// Get 用来按请求字段名或列名查找比较结果。
+func (s GenUpdateChangeSet) Get(name string) (GenUpdateChange, bool) {
+	for _, change := range s {
+		if change.Field == name || change.Column == name {
+			return change, true
+		}
+	}
+	return GenUpdateChange{}, false
+}
+
+// HasChanges 判断是否有需要更新的字段。
+func (s GenUpdateChangeSet) HasChanges() bool {
+	for _, change := range s {
+		if change.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 返回变更列的新旧值，键为列名，列名为空时使用字段名，适合直接作为接口响应返回“改了什么”。
+func (s GenUpdateChangeSet) Diff() map[string]GenUpdateDiffValue {
+	diff := make(map[string]GenUpdateDiffValue)
+	for _, change := range s {
+		if !change.Changed {
+			continue
+		}
+		key := change.Column
+		if key == "" {
+			key = change.Field
+		}
+		diff[key] = GenUpdateDiffValue{Old: change.Old, New: change.New}
+	}
+	return diff
+}
+
+// JSON 用来把比较结果序列化为 JSON。
+func (s GenUpdateChangeSet) JSON() ([]byte, error) {
+	if s == nil {
+		s = GenUpdateChangeSet{}
+	}
+	return json.Marshal(s)
+}
+
+// String 用来输出 JSON 格式的比较结果，便于日志和调试。
+func (s GenUpdateChangeSet) String() string {
+	data, err := s.JSON()
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func newGenUpdateChange(structField reflect.StructField, target any, marker patchFieldValidationMarker, oldValue any, changed bool) GenUpdateChange {
+	oldInfo := parsePatchDynamicOldValue(oldValue)
+	change := GenUpdateChange{
+		Field:    structField.Name,
+		Column:   patchColumnName(target),
+		OldKnown: oldInfo.known,
+		Old:      oldInfo.value,
+		SetNull:  marker.patchFieldValidationNull(),
+		Changed:  changed,
+	}
+	if !change.SetNull {
+		change.New = marker.patchFieldValidationValue()
+	}
+	// 加密列的新旧值只保留占位符，Diff、JSON 与审计都不会输出明文
+	if isEncryptedValue(change.Old) {
+		change.Old = encryptedRedactedValue
+	}
+	if isEncryptedValue(change.New) {
+		change.New = encryptedRedactedValue
+	}
+	if !changed {
+		change.SkipReason = GenUpdateSkipEqual
+		if change.SetNull {
+			change.SkipReason = GenUpdateSkipAlreadyNull
+		}
+	}
+	return change
+}
@@ -34,30 +34,44 @@ type patchResolvedDynamicTarget struct {
 // BuildGenUpdates 用来把 PATCH 请求中的 Field[T] 一次性转换成 gorm/gen 的更新表达式。
 // oldModel 允许传 nil，表示当前没有旧值可比较，此时只要请求显式传了字段就会生成更新表达式。
 func BuildGenUpdates(req any, oldModel any, table any) ([]field.AssignExpr, error) {
+	updates, _, err := buildGenUpdates(req, oldModel, table, false)
+	return updates, err
+}
+
+// buildGenUpdates 用来生成更新表达式，collect 为 true 时同时返回每个显式传入字段的比较结果。
+func buildGenUpdates(req any, oldModel any, table any, collect bool) ([]field.AssignExpr, GenUpdateChangeSet, error) {
 	reqValue, err := patchBuildStructValue(req, "req")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	tableValue, err := patchBuildStructValue(table, "table")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	oldValue, hasOldModel, err := patchBuildOptionalStructValue(oldModel)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	updates := make([]field.AssignExpr, 0)
-	if err := buildGenUpdatesFromStruct(&updates, reqValue, oldValue, hasOldModel, table, tableValue); err != nil {
-		return nil, err
+	var changes *GenUpdateChangeSet
+	if collect {
+		changes = &GenUpdateChangeSet{}
+	}
+	if err := buildGenUpdatesFromStruct(&updates, changes, reqValue, oldValue, hasOldModel, table, tableValue); err != nil {
+		return nil, nil, err
 	}
-	return updates, nil
+	if changes == nil {
+		return updates, nil, nil
+	}
+	return updates, *changes, nil
 }
 
 func buildGenUpdatesFromStruct(
 	updates *[]field.AssignExpr,
+	changes *GenUpdateChangeSet,
 	reqValue reflect.Value,
 	oldValue reflect.Value,
 	hasOldModel bool,
@@ -73,7 +87,7 @@ func buildGenUpdatesFromStruct(
 
 		fieldValue := reqValue.Field(i)
 		if marker, ok := patchFieldValidationFromValue(fieldValue); ok {
-			if err := appendBuildGenUpdate(updates, marker, structField, oldValue, hasOldModel, table, tableValue); err != nil {
+			if err := appendBuildGenUpdate(updates, changes, marker, structField, oldValue, hasOldModel, table, tableValue); err != nil {
 				return err
 			}
 			continue
@@ -87,7 +101,7 @@ func buildGenUpdatesFromStruct(
 		if !ok {
 			continue
 		}
-		if err := buildGenUpdatesFromStruct(updates, nestedValue, oldValue, hasOldModel, table, tableValue); err != nil {
+		if err := buildGenUpdatesFromStruct(updates, changes, nestedValue, oldValue, hasOldModel, table, tableValue); err != nil {
 			return err
 		}
 	}
@@ -96,6 +110,7 @@ func buildGenUpdatesFromStruct(
 
 func appendBuildGenUpdate(
 	updates *[]field.AssignExpr,
+	changes *GenUpdateChangeSet,
 	marker patchFieldValidationMarker,
 	structField reflect.StructField,
 	oldValue reflect.Value,
@@ -122,16 +137,41 @@ func appendBuildGenUpdate(
 		return fmt.Errorf("字段 %s 构建更新表达式失败: %w", structField.Name, err)
 	}
 
-	assignExpr, changed, err := patchBuildAssignExpr(marker, fieldOldValue, target)
+	var (
+		assignExpr field.AssignExpr
+		changed    bool
+		newValue   any
+	)
+	if patch, ok := patchJSONDocumentFromMarker(marker); ok {
+		assignExpr, changed, newValue, err = patchBuildJSONAssignExpr(patch, fieldOldValue, target)
+	} else {
+		assignExpr, changed, err = patchBuildAssignExpr(marker, fieldOldValue, target)
+	}
 	if err != nil {
 		return fmt.Errorf("字段 %s 构建更新表达式失败: %w", structField.Name, err)
 	}
 	if changed {
 		*updates = append(*updates, assignExpr)
 	}
+	if changes != nil {
+		change := newGenUpdateChange(structField, target, marker, fieldOldValue, changed)
+		if newValue != nil {
+			change.New = newValue
+		}
+		*changes = append(*changes, change)
+	}
 	return nil
 }
 
+// patchColumnName 用来取得 gorm/gen 字段对应的列名，取不到时返回空字符串。
+func patchColumnName(target any) string {
+	method := patchLookupMethod(reflect.ValueOf(target), "ColumnName")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	return fmt.Sprint(method.Call(nil)[0].Interface())
+}
+
 func patchBuildAssignExpr(marker patchFieldValidationMarker, oldValue any, target any) (field.AssignExpr, bool, error) {
 	oldInfo := parsePatchDynamicOldValue(oldValue)
 	resolvedTarget, err := resolvePatchDynamicTarget(target)
@@ -0,0 +1,860 @@
+package wd
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gen/field"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	JSONPatchOpAdd     = "add"
+	JSONPatchOpRemove  = "remove"
+	JSONPatchOpReplace = "replace"
+	JSONPatchOpMove    = "move"
+	JSONPatchOpCopy    = "copy"
+	JSONPatchOpTest    = "test"
+)
+
+// JSONMergePatch 是 RFC 7396 合并补丁，配合 Field[JSONMergePatch] 对 JSON 列做局部更新：
+// 值为 null 的键被删除，对象递归合并，其余值整体替换。
+type JSONMergePatch map[string]any
+
+// JSONPatch 是 RFC 6902 操作列表，配合 Field[JSONPatch] 对 JSON 列做局部更新。
+type JSONPatch []JSONPatchOperation
+
+// JSONPatchOperation RFC 6902 中的一个操作。
+type JSONPatchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// From move/copy 的来源路径
+	From string `json:"from,omitempty"`
+	// Value add/replace/test 的值，显式传 null 时为 "null"
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchJSONDocument 由 JSONMergePatch 与 JSONPatch 实现，BuildGenUpdates 遇到这类值时生成 JSON 函数表达式。
+type patchJSONDocument interface {
+	Validate() error
+	// patchJSONSteps 把补丁编译成 SQL 步骤；known 为 true 时同时在 doc 上应用补丁并返回新文档。
+	patchJSONSteps(doc any, known bool) ([]patchJSONStep, any, error)
+}
+
+type patchJSONStepKind int
+
+const (
+	patchJSONStepSet    patchJSONStepKind = iota // 设置路径上的值，不存在时创建
+	patchJSONStepInsert                          // 插入到数组指定下标之前
+	patchJSONStepAppend                          // 追加到数组末尾，path 为数组本身
+	patchJSONStepRemove                          // 删除路径
+	patchJSONStepObject                          // 路径不存在时写入空对象
+	patchJSONStepRoot                            // 替换整个文档
+)
+
+type patchJSONToken struct {
+	key   string
+	index bool
+}
+
+type patchJSONStep struct {
+	kind  patchJSONStepKind
+	path  []patchJSONToken
+	value []byte
+	// from 不为空时值取自文档中的 from 路径
+	from []patchJSONToken
+	// move 为 true 时取值后删除 from
+	move bool
+}
+
+// UnmarshalJSON 用来保留数字精度，并拒绝非对象的合并补丁。
+func (p *JSONMergePatch) UnmarshalJSON(data []byte) error {
+	value, err := patchJSONDecode(data)
+	if err != nil {
+		return err
+	}
+	object, ok := value.(map[string]any)
+	if !ok && value != nil {
+		return errors.New("JSON Merge Patch 必须是对象")
+	}
+	*p = object
+	return nil
+}
+
+// Validate 合并补丁只要是对象就合法。
+func (p JSONMergePatch) Validate() error {
+	return nil
+}
+
+// Apply 用来在内存中把合并补丁应用到 doc 上，doc 为空时视为空对象。
+func (p JSONMergePatch) Apply(doc []byte) ([]byte, error) {
+	return patchJSONApply(p, doc)
+}
+
+func (p JSONMergePatch) patchJSONSteps(doc any, known bool) ([]patchJSONStep, any, error) {
+	patch := map[string]any(p)
+	if known && doc != nil {
+		if _, ok := doc.(map[string]any); !ok {
+			merged := patchJSONMerge(nil, patch)
+			value, err := json.Marshal(merged)
+			if err != nil {
+				return nil, nil, err
+			}
+			return []patchJSONStep{{kind: patchJSONStepRoot, value: value}}, merged, nil
+		}
+	}
+
+	steps := make([]patchJSONStep, 0, len(patch))
+	if err := patchJSONMergeSteps(&steps, nil, patch, doc, known); err != nil {
+		return nil, nil, err
+	}
+	if !known {
+		return steps, nil, nil
+	}
+	return steps, patchJSONMerge(patchJSONClone(doc), patch), nil
+}
+
+func patchJSONMergeSteps(steps *[]patchJSONStep, path []patchJSONToken, patch map[string]any, old any, known bool) error {
+	oldObject, _ := old.(map[string]any)
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value := patch[key]
+		childPath := append(slices.Clone(path), patchJSONToken{key: key})
+		oldChild, hasOld := oldObject[key]
+
+		if value == nil {
+			if known && !hasOld {
+				continue
+			}
+			*steps = append(*steps, patchJSONStep{kind: patchJSONStepRemove, path: childPath})
+			continue
+		}
+
+		if object, ok := value.(map[string]any); ok {
+			if !known {
+				// 不知道旧值时先保证路径上是对象，再逐个键合并
+				*steps = append(*steps, patchJSONStep{kind: patchJSONStepObject, path: childPath})
+				if err := patchJSONMergeSteps(steps, childPath, object, nil, false); err != nil {
+					return err
+				}
+				continue
+			}
+			if oldChildObject, ok := oldChild.(map[string]any); ok {
+				if err := patchJSONMergeSteps(steps, childPath, object, oldChildObject, true); err != nil {
+					return err
+				}
+				continue
+			}
+			value = patchJSONMerge(nil, object)
+		} else if known && hasOld && reflect.DeepEqual(oldChild, value) {
+			continue
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		*steps = append(*steps, patchJSONStep{kind: patchJSONStepSet, path: childPath, value: data})
+	}
+	return nil
+}
+
+// patchJSONMerge 按 RFC 7396 合并，target 会被原地修改。
+func patchJSONMerge(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any, len(patchObject))
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = patchJSONMerge(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Validate 用来检查操作类型、路径以及 from/value 是否齐全。
+func (p JSONPatch) Validate() error {
+	for i, op := range p {
+		if err := op.validate(); err != nil {
+			return fmt.Errorf("第 %d 个操作%w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (op JSONPatchOperation) validate() error {
+	if _, err := patchJSONParsePointer(op.Path); err != nil {
+		return fmt.Errorf(" path %w", err)
+	}
+	switch op.Op {
+	case JSONPatchOpAdd, JSONPatchOpReplace, JSONPatchOpTest:
+		if len(op.Value) == 0 {
+			return fmt.Errorf(" %s 缺少 value", op.Op)
+		}
+	case JSONPatchOpMove, JSONPatchOpCopy:
+		if _, err := patchJSONParsePointer(op.From); err != nil {
+			return fmt.Errorf(" from %w", err)
+		}
+		if op.Op == JSONPatchOpMove && (op.Path == op.From || strings.HasPrefix(op.Path, op.From+"/")) {
+			return errors.New(" move 不能把节点移动到自身内部")
+		}
+	case JSONPatchOpRemove:
+		if op.Path == "" {
+			return errors.New(" remove 不能删除整个文档")
+		}
+	default:
+		return fmt.Errorf(" op 不支持: %q", op.Op)
+	}
+	return nil
+}
+
+// Apply 用来在内存中按顺序执行操作，doc 为空时视为空对象，任一操作失败都返回错误。
+func (p JSONPatch) Apply(doc []byte) ([]byte, error) {
+	return patchJSONApply(p, doc)
+}
+
+func (p JSONPatch) patchJSONSteps(doc any, known bool) ([]patchJSONStep, any, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if known && doc == nil {
+		doc = map[string]any{}
+	}
+
+	steps := make([]patchJSONStep, 0, len(p))
+	for i, op := range p {
+		step, next, err := op.compile(doc, known)
+		if err != nil {
+			return nil, nil, fmt.Errorf("第 %d 个操作 %s %s 失败: %w", i+1, op.Op, op.Path, err)
+		}
+		if step != nil {
+			steps = append(steps, *step)
+		}
+		doc = next
+	}
+	if !known {
+		return steps, nil, nil
+	}
+	return steps, doc, nil
+}
+
+func (op JSONPatchOperation) compile(doc any, known bool) (*patchJSONStep, any, error) {
+	path, _ := patchJSONParsePointer(op.Path)
+	var value any
+	if len(op.Value) > 0 {
+		decoded, err := patchJSONDecode(op.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		value = decoded
+	}
+
+	switch op.Op {
+	case JSONPatchOpTest:
+		if !known {
+			return nil, nil, errors.New("test 操作需要传入 oldModel")
+		}
+		current, err := patchJSONGet(doc, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, nil, errors.New("test 不通过")
+		}
+		return nil, doc, nil
+	case JSONPatchOpRemove:
+		step := &patchJSONStep{kind: patchJSONStepRemove, path: patchJSONTokens(doc, known, path)}
+		if !known {
+			return step, nil, nil
+		}
+		next, err := patchJSONRemove(doc, path)
+		return step, next, err
+	case JSONPatchOpAdd, JSONPatchOpReplace:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		step := patchJSONAddStep(doc, known, path, op.Op == JSONPatchOpReplace)
+		step.value = data
+		if !known {
+			return step, nil, nil
+		}
+		next, err := patchJSONAdd(doc, path, value, op.Op == JSONPatchOpReplace)
+		return step, next, err
+	default:
+		from, _ := patchJSONParsePointer(op.From)
+		if op.Op == JSONPatchOpMove && op.From == op.Path {
+			return nil, doc, nil
+		}
+		step := &patchJSONStep{from: patchJSONTokens(doc, known, from), move: op.Op == JSONPatchOpMove}
+		if !known {
+			added := patchJSONAddStep(nil, false, path, false)
+			step.kind, step.path = added.kind, added.path
+			return step, nil, nil
+		}
+		current, err := patchJSONGet(doc, from)
+		if err != nil {
+			return nil, nil, err
+		}
+		current = patchJSONClone(current)
+		next := doc
+		if step.move {
+			if next, err = patchJSONRemove(next, from); err != nil {
+				return nil, nil, err
+			}
+		}
+		added := patchJSONAddStep(next, true, path, false)
+		step.kind, step.path = added.kind, added.path
+		next, err = patchJSONAdd(next, path, current, false)
+		return step, next, err
+	}
+}
+
+// patchJSONAddStep 用来按父节点类型决定 add 是写对象键、插入数组还是追加到数组末尾。
+func patchJSONAddStep(doc any, known bool, path []string, replace bool) *patchJSONStep {
+	if len(path) == 0 {
+		return &patchJSONStep{kind: patchJSONStepRoot}
+	}
+	tokens := patchJSONTokens(doc, known, path)
+	last := tokens[len(tokens)-1]
+	switch {
+	case replace || !last.index:
+		return &patchJSONStep{kind: patchJSONStepSet, path: tokens}
+	case last.key == "-":
+		return &patchJSONStep{kind: patchJSONStepAppend, path: tokens[:len(tokens)-1]}
+	default:
+		return &patchJSONStep{kind: patchJSONStepInsert, path: tokens}
+	}
+}
+
+// patchJSONTokens 用来判断路径中的每一段是数组下标还是对象键；已知文档时看父节点类型，否则按是否为数字判断。
+func patchJSONTokens(doc any, known bool, path []string) []patchJSONToken {
+	tokens := make([]patchJSONToken, len(path))
+	current, ok := doc, known
+	for i, key := range path {
+		var index bool
+		switch node := current.(type) {
+		case []any:
+			index = ok
+			current = nil
+			if position, err := strconv.Atoi(key); err == nil && position >= 0 && position < len(node) {
+				current = node[position]
+			}
+		case map[string]any:
+			current = node[key]
+		default:
+			ok = false
+		}
+		if !ok {
+			index = key == "-" || patchJSONIsIndex(key)
+		}
+		tokens[i] = patchJSONToken{key: key, index: index}
+	}
+	return tokens
+}
+
+func patchJSONIsIndex(key string) bool {
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return false
+	}
+	for _, r := range key {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// patchJSONParsePointer 用来解析 RFC 6901 JSON Pointer。
+func patchJSONParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("必须以 / 开头: %q", pointer)
+	}
+	parts := strings.Split(pointer[1:], "/")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+func patchJSONIndex(key string, length int) (int, error) {
+	if !patchJSONIsIndex(key) {
+		return 0, fmt.Errorf("数组下标不合法: %q", key)
+	}
+	index, err := strconv.Atoi(key)
+	if err != nil || index >= length {
+		return 0, fmt.Errorf("数组下标越界: %s", key)
+	}
+	return index, nil
+}
+
+func patchJSONGet(doc any, path []string) (any, error) {
+	current := doc
+	for _, key := range path {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("路径不存在: %s", key)
+			}
+			current = value
+		case []any:
+			index, err := patchJSONIndex(key, len(node))
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("路径不存在: %s", key)
+		}
+	}
+	return current, nil
+}
+
+// patchJSONAdd 用来执行 add/replace，replace 要求目标已存在；返回新的根节点。
+func patchJSONAdd(doc any, path []string, value any, replace bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	key := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			if _, ok := node[key]; replace && !ok {
+				return nil, fmt.Errorf("路径不存在: %s", key)
+			}
+			node[key] = value
+			return node, nil
+		}
+		child, ok := node[key]
+		if !ok {
+			return nil, fmt.Errorf("路径不存在: %s", key)
+		}
+		next, err := patchJSONAdd(child, path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		node[key] = next
+		return node, nil
+	case []any:
+		if len(path) == 1 {
+			if replace {
+				index, err := patchJSONIndex(key, len(node))
+				if err != nil {
+					return nil, err
+				}
+				node[index] = value
+				return node, nil
+			}
+			if key == "-" {
+				return append(node, value), nil
+			}
+			index, err := patchJSONIndex(key, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(node, index, value), nil
+		}
+		index, err := patchJSONIndex(key, len(node))
+		if err != nil {
+			return nil, err
+		}
+		next, err := patchJSONAdd(node[index], path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = next
+		return node, nil
+	default:
+		return nil, fmt.Errorf("路径不存在: %s", key)
+	}
+}
+
+func patchJSONRemove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("不能删除整个文档")
+	}
+	key := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		if _, ok := node[key]; !ok {
+			return nil, fmt.Errorf("路径不存在: %s", key)
+		}
+		if len(path) == 1 {
+			delete(node, key)
+			return node, nil
+		}
+		next, err := patchJSONRemove(node[key], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[key] = next
+		return node, nil
+	case []any:
+		index, err := patchJSONIndex(key, len(node))
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return slices.Delete(node, index, index+1), nil
+		}
+		next, err := patchJSONRemove(node[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[index] = next
+		return node, nil
+	default:
+		return nil, fmt.Errorf("路径不存在: %s", key)
+	}
+}
+
+func patchJSONDecode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func patchJSONClone(value any) any {
+	switch node := value.(type) {
+	case map[string]any:
+		cloned := make(map[string]any, len(node))
+		for key, child := range node {
+			cloned[key] = patchJSONClone(child)
+		}
+		return cloned
+	case []any:
+		cloned := make([]any, len(node))
+		for i, child := range node {
+			cloned[i] = patchJSONClone(child)
+		}
+		return cloned
+	default:
+		return value
+	}
+}
+
+func patchJSONApply(patch patchJSONDocument, doc []byte) ([]byte, error) {
+	var current any
+	if len(bytes.TrimSpace(doc)) > 0 {
+		decoded, err := patchJSONDecode(doc)
+		if err != nil {
+			return nil, err
+		}
+		current = decoded
+	}
+	if current == nil {
+		current = map[string]any{}
+	}
+	_, next, err := patch.patchJSONSteps(current, true)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(next)
+}
+
+// patchJSONOldDocument 用来把旧值解析成 JSON 文档，同时返回旧值的结构体或 map 类型用于校验新文档。
+func patchJSONOldDocument(oldValue any) (any, bool, reflect.Type, error) {
+	oldInfo := parsePatchDynamicOldValue(oldValue)
+	if !oldInfo.known {
+		return nil, false, nil, nil
+	}
+	if oldInfo.isNull {
+		return nil, true, nil, nil
+	}
+
+	value := reflect.ValueOf(oldInfo.value)
+	var data []byte
+	var modelType reflect.Type
+	switch {
+	case value.Kind() == reflect.String:
+		data = []byte(value.String())
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		data = value.Bytes()
+	default:
+		if value.Kind() == reflect.Struct || value.Kind() == reflect.Map {
+			modelType = value.Type()
+		}
+		encoded, err := json.Marshal(oldInfo.value)
+		if err != nil {
+			return nil, false, nil, fmt.Errorf("旧值无法序列化为 JSON: %w", err)
+		}
+		data = encoded
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, true, modelType, nil
+	}
+	doc, err := patchJSONDecode(data)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("旧值不是合法的 JSON: %w", err)
+	}
+	return doc, true, modelType, nil
+}
+
+// patchBuildJSONAssignExpr 用来把 JSON 补丁转换成 JSON_SET/JSON_REMOVE 更新表达式，返回值中的 any 为比较结果中的新值。
+func patchBuildJSONAssignExpr(patch patchJSONDocument, oldValue any, target any) (field.AssignExpr, bool, any, error) {
+	column := patchColumnName(target)
+	if column == "" {
+		return nil, false, nil, fmt.Errorf("target 类型无法取得列名: %T", target)
+	}
+
+	doc, known, modelType, err := patchJSONOldDocument(oldValue)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	steps, next, err := patch.patchJSONSteps(patchJSONClone(doc), known)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	newValue := any(patch)
+	if known {
+		if doc != nil && reflect.DeepEqual(doc, next) {
+			return nil, false, nil, nil
+		}
+		data, err := json.Marshal(next)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		if modelType != nil {
+			if err := json.Unmarshal(data, reflect.New(modelType).Interface()); err != nil {
+				return nil, false, nil, fmt.Errorf("JSON 补丁结果不符合 %s: %w", modelType, err)
+			}
+		}
+		newValue = json.RawMessage(data)
+	}
+
+	resolvedTarget, err := resolvePatchDynamicTarget(target)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	assignExpr, err := resolvedTarget.setValue(patchJSONExpr{column: column, steps: steps})
+	if err != nil {
+		return nil, false, nil, err
+	}
+	return assignExpr, true, newValue, nil
+}
+
+// patchJSONExpr 在执行时按数据库方言生成 JSON 函数表达式。
+type patchJSONExpr struct {
+	column string
+	steps  []patchJSONStep
+}
+
+// Value 让 patchJSONExpr 可以传给 gen 字段的 Value，实际取值走 GormValue。
+func (e patchJSONExpr) Value() (driver.Value, error) {
+	return nil, errors.New("JSON 补丁表达式只能用于 gorm 更新语句")
+}
+
+// GormValue 用来按方言把补丁步骤嵌套成一个表达式。
+func (e patchJSONExpr) GormValue(_ context.Context, db *gorm.DB) clause.Expr {
+	column := clause.Expr{SQL: "?", Vars: []any{clause.Column{Name: e.column}}}
+	dialect := patchJSONDialect{name: GormDialect(db.Dialector.Name())}
+	if mysqlDialector, ok := db.Dialector.(*gormmysql.Dialector); ok {
+		dialect.mariadb = strings.Contains(mysqlDialector.ServerVersion, "MariaDB")
+	}
+
+	expr, err := dialect.coalesce(column)
+	if err != nil {
+		_ = db.AddError(err)
+		return column
+	}
+	for _, step := range e.steps {
+		if expr, err = dialect.build(expr, step); err != nil {
+			_ = db.AddError(err)
+			return column
+		}
+	}
+	return expr
+}
+
+type patchJSONDialect struct {
+	name    GormDialect
+	mariadb bool
+}
+
+func (d patchJSONDialect) coalesce(column clause.Expr) (clause.Expr, error) {
+	switch d.name {
+	case GormDialectMySQL:
+		return clause.Expr{SQL: "COALESCE(?, JSON_OBJECT())", Vars: []any{column}}, nil
+	case GormDialectSQLite:
+		return clause.Expr{SQL: "COALESCE(?, '{}')", Vars: []any{column}}, nil
+	case GormDialectPostgres:
+		return clause.Expr{SQL: "COALESCE(?::jsonb, '{}'::jsonb)", Vars: []any{column}}, nil
+	default:
+		return clause.Expr{}, fmt.Errorf("JSON 补丁不支持的数据库: %s", d.name)
+	}
+}
+
+func (d patchJSONDialect) literal(data []byte) clause.Expr {
+	switch {
+	case d.name == GormDialectSQLite:
+		return clause.Expr{SQL: "json(?)", Vars: []any{string(data)}}
+	case d.name == GormDialectPostgres:
+		return clause.Expr{SQL: "?::jsonb", Vars: []any{string(data)}}
+	case d.mariadb:
+		return clause.Expr{SQL: "JSON_EXTRACT(?, '$')", Vars: []any{string(data)}}
+	default:
+		return clause.Expr{SQL: "CAST(? AS JSON)", Vars: []any{string(data)}}
+	}
+}
+
+func (d patchJSONDialect) extract(doc clause.Expr, path []patchJSONToken) clause.Expr {
+	switch d.name {
+	case GormDialectSQLite:
+		return clause.Expr{SQL: "json(? -> ?)", Vars: []any{doc, d.path(path)}}
+	case GormDialectPostgres:
+		return clause.Expr{SQL: "(? #> ?::text[])", Vars: []any{doc, d.path(path)}}
+	default:
+		return clause.Expr{SQL: "JSON_EXTRACT(?, ?)", Vars: []any{doc, d.path(path)}}
+	}
+}
+
+func (d patchJSONDialect) build(doc clause.Expr, step patchJSONStep) (clause.Expr, error) {
+	var value clause.Expr
+	if step.from != nil {
+		value = d.extract(doc, step.from)
+		if step.move {
+			doc = d.remove(doc, step.from)
+		}
+	} else if step.value != nil {
+		value = d.literal(step.value)
+	}
+
+	switch step.kind {
+	case patchJSONStepRoot:
+		return value, nil
+	case patchJSONStepRemove:
+		return d.remove(doc, step.path), nil
+	case patchJSONStepObject:
+		switch d.name {
+		case GormDialectSQLite:
+			return clause.Expr{SQL: "json_insert(?, ?, json('{}'))", Vars: []any{doc, d.path(step.path)}}, nil
+		case GormDialectPostgres:
+			return clause.Expr{SQL: "jsonb_set(?, ?::text[], COALESCE(? #> ?::text[], '{}'::jsonb), true)", Vars: []any{doc, d.path(step.path), doc, d.path(step.path)}}, nil
+		default:
+			return clause.Expr{SQL: "JSON_INSERT(?, ?, JSON_OBJECT())", Vars: []any{doc, d.path(step.path)}}, nil
+		}
+	case patchJSONStepSet:
+		switch d.name {
+		case GormDialectSQLite:
+			return clause.Expr{SQL: "json_set(?, ?, ?)", Vars: []any{doc, d.path(step.path), value}}, nil
+		case GormDialectPostgres:
+			return clause.Expr{SQL: "jsonb_set(?, ?::text[], ?, true)", Vars: []any{doc, d.path(step.path), value}}, nil
+		default:
+			return clause.Expr{SQL: "JSON_SET(?, ?, ?)", Vars: []any{doc, d.path(step.path), value}}, nil
+		}
+	case patchJSONStepInsert:
+		switch d.name {
+		case GormDialectSQLite:
+			return clause.Expr{}, errors.New("SQLite 不支持在数组中间插入，请使用 /- 追加")
+		case GormDialectPostgres:
+			return clause.Expr{SQL: "jsonb_insert(?, ?::text[], ?)", Vars: []any{doc, d.path(step.path), value}}, nil
+		default:
+			return clause.Expr{SQL: "JSON_ARRAY_INSERT(?, ?, ?)", Vars: []any{doc, d.path(step.path), value}}, nil
+		}
+	case patchJSONStepAppend:
+		switch d.name {
+		case GormDialectSQLite:
+			return clause.Expr{SQL: "json_insert(?, ?, ?)", Vars: []any{doc, d.path(step.path).(string) + "[#]", value}}, nil
+		case GormDialectPostgres:
+			path := append(slices.Clone(step.path), patchJSONToken{key: "-1", index: true})
+			return clause.Expr{SQL: "jsonb_insert(?, ?::text[], ?, true)", Vars: []any{doc, d.path(path), value}}, nil
+		default:
+			return clause.Expr{SQL: "JSON_ARRAY_APPEND(?, ?, ?)", Vars: []any{doc, d.path(step.path), value}}, nil
+		}
+	default:
+		return clause.Expr{}, fmt.Errorf("未知的 JSON 补丁步骤: %d", step.kind)
+	}
+}
+
+func (d patchJSONDialect) remove(doc clause.Expr, path []patchJSONToken) clause.Expr {
+	switch d.name {
+	case GormDialectSQLite:
+		return clause.Expr{SQL: "json_remove(?, ?)", Vars: []any{doc, d.path(path)}}
+	case GormDialectPostgres:
+		return clause.Expr{SQL: "(? #- ?::text[])", Vars: []any{doc, d.path(path)}}
+	default:
+		return clause.Expr{SQL: "JSON_REMOVE(?, ?)", Vars: []any{doc, d.path(path)}}
+	}
+}
+
+// path 用来生成路径参数，MySQL/SQLite 为 $."a"[0]，PostgreSQL 为 text[] 字面量。
+func (d patchJSONDialect) path(tokens []patchJSONToken) any {
+	var builder strings.Builder
+	if d.name == GormDialectPostgres {
+		builder.WriteString("{")
+		for i, token := range tokens {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			key := strings.ReplaceAll(strings.ReplaceAll(token.key, `\`, `\\`), `"`, `\"`)
+			builder.WriteString(`"` + key + `"`)
+		}
+		builder.WriteString("}")
+		return builder.String()
+	}
+
+	builder.WriteString("$")
+	for _, token := range tokens {
+		if token.index {
+			builder.WriteString("[" + token.key + "]")
+			continue
+		}
+		builder.WriteString(`."` + strings.ReplaceAll(token.key, `"`, `\"`) + `"`)
+	}
+	return builder.String()
+}
+
+func patchJSONDocumentFromMarker(marker patchFieldValidationMarker) (patchJSONDocument, bool) {
+	if !marker.patchFieldValidationSet() || marker.patchFieldValidationNull() {
+		return nil, false
+	}
+	patch, ok := marker.patchFieldValidationValue().(patchJSONDocument)
+	return patch, ok
+}
+
+// patchJSONBindingTag 用来给 Field[JSONMergePatch]/Field[JSONPatch] 自动追加 jsonpatch 规则。
+func patchJSONBindingTag(bindingTag string, marker patchFieldValidationMarker) string {
+	if _, ok := patchJSONDocumentFromMarker(marker); !ok || bindingTag == "-" {
+		return bindingTag
+	}
+	for _, item := range strings.Split(bindingTag, ",") {
+		if item == "jsonpatch" {
+			return bindingTag
+		}
+	}
+	if bindingTag == "" {
+		return "jsonpatch"
+	}
+	return bindingTag + ",jsonpatch"
+}
@@ -0,0 +1,294 @@
+package wd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDelayQueueConcurrency  = 10
+	defaultDelayQueueLease        = 30 * time.Second
+	defaultDelayQueuePollInterval = time.Second
+	defaultDelayQueueRetryDelay   = 5 * time.Second
+	defaultDelayQueueMaxAttempts  = 5
+	defaultDelayQueueDrainTimeout = 30 * time.Second
+)
+
+// DelayQueueConsumer 用来消费 LuaRedisDelayQueuePush 写入的延迟消息。
+// 到期消息先移入处理中集合并持有租约，处理成功后 Ack；失败的消息延迟重试，进程崩溃导致租约过期的消息会重新入队，语义为至少一次。
+// 投递次数达到上限后消息移入 key+":dead"，不再重试。
+type DelayQueueConsumer struct {
+	key          string
+	handler      func(ctx context.Context, msg *DelayedMessage) error
+	concurrency  int
+	lease        time.Duration
+	pollInterval time.Duration
+	retryDelay   time.Duration
+	maxAttempts  int64
+	drainTimeout time.Duration
+	errorHandler func(err error)
+
+	lifecycle sync.Mutex
+	running   bool
+	hookOnce  sync.Once
+	stop      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	loop      sync.WaitGroup
+	inflight  sync.WaitGroup
+	sem       chan struct{}
+}
+
+// WithDelayQueueConsumerOption 延迟队列消费者的配置项。
+type WithDelayQueueConsumerOption func(*DelayQueueConsumer)
+
+// WithDelayQueueConcurrency 设置同时处理的消息数量，默认 10。
+func WithDelayQueueConcurrency(n int) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithDelayQueueLease 设置租约时长，默认 30 秒，处理期间每隔三分之一租约自动续租。
+func WithDelayQueueLease(d time.Duration) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if d >= time.Second {
+			c.lease = d
+		}
+	}
+}
+
+// WithDelayQueuePollInterval 设置轮询间隔，默认 1 秒，领取满一批时会立即继续领取。
+func WithDelayQueuePollInterval(d time.Duration) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if d > 0 {
+			c.pollInterval = d
+		}
+	}
+}
+
+// WithDelayQueueRetryDelay 设置处理失败后重新投递的延迟，默认 5 秒。
+func WithDelayQueueRetryDelay(d time.Duration) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if d >= 0 {
+			c.retryDelay = d
+		}
+	}
+}
+
+// WithDelayQueueMaxAttempts 设置最多投递次数，默认 5 次，租约过期后的重新投递同样计数，超过后移入死信。
+func WithDelayQueueMaxAttempts(n int) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if n > 0 {
+			c.maxAttempts = int64(n)
+		}
+	}
+}
+
+// WithDelayQueueDrainTimeout 设置停止时等待处理中消息的最长时间，默认 30 秒，超时后取消它们的 context。
+func WithDelayQueueDrainTimeout(d time.Duration) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		if d > 0 {
+			c.drainTimeout = d
+		}
+	}
+}
+
+// WithDelayQueueErrorHandler 设置 Redis 操作失败或处理函数返回错误时的回调。
+func WithDelayQueueErrorHandler(handler func(err error)) WithDelayQueueConsumerOption {
+	return func(c *DelayQueueConsumer) {
+		c.errorHandler = handler
+	}
+}
+
+// NewDelayQueueConsumer 创建延迟队列消费者，key 与 LuaRedisDelayQueuePush 使用的 key 相同。
+func NewDelayQueueConsumer(key string, handler func(ctx context.Context, msg *DelayedMessage) error, opts ...WithDelayQueueConsumerOption) *DelayQueueConsumer {
+	c := &DelayQueueConsumer{
+		key:          key,
+		handler:      handler,
+		concurrency:  defaultDelayQueueConcurrency,
+		lease:        defaultDelayQueueLease,
+		pollInterval: defaultDelayQueuePollInterval,
+		retryDelay:   defaultDelayQueueRetryDelay,
+		maxAttempts:  defaultDelayQueueMaxAttempts,
+		drainTimeout: defaultDelayQueueDrainTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Start 用来启动消费循环，InsGlobalHook 触发时自动 Stop；重复调用不会重复启动。
+func (c *DelayQueueConsumer) Start() error {
+	if InsRedis == nil {
+		return redisClientNilErr()
+	}
+	if c.handler == nil {
+		return errors.New("延迟队列处理函数不能为空")
+	}
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	if c.running {
+		return nil
+	}
+
+	c.running = true
+	c.stop = make(chan struct{})
+	c.sem = make(chan struct{}, c.concurrency)
+	c.ctx, c.cancel = context.WithCancel(BackgroundContext())
+	c.loop.Add(1)
+	go c.run()
+	c.hookOnce.Do(func() {
+		InsGlobalHook.AppendFun(c.Stop)
+	})
+	return nil
+}
+
+// Stop 用来停止领取新消息，等待处理中的消息完成，超过 WithDelayQueueDrainTimeout 后取消它们的 context。
+// 未确认的消息在租约过期后重新入队。
+func (c *DelayQueueConsumer) Stop() {
+	c.lifecycle.Lock()
+	if !c.running {
+		c.lifecycle.Unlock()
+		return
+	}
+	c.running = false
+	close(c.stop)
+	c.lifecycle.Unlock()
+
+	c.loop.Wait()
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(c.drainTimeout):
+	}
+	c.cancel()
+}
+
+func (c *DelayQueueConsumer) run() {
+	defer c.loop.Done()
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := InsRedis.LuaRedisDelayQueueRequeue(c.key, Now().UnixMilli(), 100); err != nil {
+			c.handleError(err)
+		}
+		for c.poll() {
+		}
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 领取与空闲名额数量相同的消息，领取满额时返回 true 表示可以继续领取。
+func (c *DelayQueueConsumer) poll() bool {
+	select {
+	case <-c.stop:
+		return false
+	case c.sem <- struct{}{}:
+	}
+	slots := 1
+	for more := true; more && slots < c.concurrency; {
+		select {
+		case c.sem <- struct{}{}:
+			slots++
+		default:
+			more = false
+		}
+	}
+
+	messages, err := InsRedis.LuaRedisDelayQueueClaim(c.key, Now().UnixMilli(), c.lease.Milliseconds(), int64(slots))
+	if err != nil {
+		c.handleError(err)
+	}
+	for range slots - len(messages) {
+		<-c.sem
+	}
+	for _, msg := range messages {
+		c.inflight.Add(1)
+		go c.process(msg)
+	}
+	return err == nil && len(messages) == slots
+}
+
+func (c *DelayQueueConsumer) process(msg *DelayedMessage) {
+	defer c.inflight.Done()
+	defer func() { <-c.sem }()
+
+	if msg.Attempts > c.maxAttempts {
+		// 多次租约过期仍未确认的消息（例如处理时进程崩溃）不再交给处理函数
+		c.dead(msg, errors.New("多次超过租约仍未确认"))
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	go c.keepLease(ctx, msg.ID)
+	err := c.handle(ctx, msg)
+	cancel()
+	if err == nil {
+		_, err = InsRedis.LuaRedisDelayQueueAck(c.key, msg.ID)
+		c.handleError(err)
+		return
+	}
+	c.handleError(fmt.Errorf("延迟消息 %s 处理失败: %w", msg.ID, err))
+	if c.ctx.Err() != nil {
+		// 停止时被取消的消息等租约过期后重新入队
+		return
+	}
+	if msg.Attempts >= c.maxAttempts {
+		c.dead(msg, err)
+		return
+	}
+	_, err = InsRedis.LuaRedisDelayQueueRetry(c.key, msg.ID, Now().Add(c.retryDelay).UnixMilli())
+	c.handleError(err)
+}
+
+func (c *DelayQueueConsumer) dead(msg *DelayedMessage, cause error) {
+	if _, err := InsRedis.LuaRedisDelayQueueDead(c.key, msg.ID); err != nil {
+		c.handleError(err)
+		return
+	}
+	c.handleError(fmt.Errorf("延迟消息 %s 投递 %d 次后移入死信: %w", msg.ID, msg.Attempts, cause))
+}
+
+func (c *DelayQueueConsumer) handle(ctx context.Context, msg *DelayedMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("延迟消息处理异常: %v", r)
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+func (c *DelayQueueConsumer) keepLease(ctx context.Context, id string) {
+	ticker := time.NewTicker(c.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := InsRedis.LuaRedisDelayQueueExtend(c.key, id, Now().UnixMilli(), c.lease.Milliseconds()); err != nil {
+				c.handleError(err)
+			}
+		}
+	}
+}
+
+func (c *DelayQueueConsumer) handleError(err error) {
+	if err != nil && c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
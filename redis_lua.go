@@ -768,14 +768,19 @@ func (r *RedisConfig) LuaRedisLeaderboardIncr(key, member string, increment floa
 // 9. 延迟队列
 
 type DelayedMessage struct {
-	ID      string `json:"id"`
-	Payload string `json:"payload"`
-	Score   int64  `json:"score"`
+	ID       string `json:"id"`
+	Payload  string `json:"payload"`
+	Score    int64  `json:"score"`
+	Attempts int64  `json:"attempts"` // 本次领取是第几次投递，只有 LuaRedisDelayQueueClaim 会填写
 }
 
-// LuaRedisDelayQueuePop 用来从延迟队列中弹出到期消息。
+// LuaRedisDelayQueuePop 用来从延迟队列中弹出到期消息，弹出即删除，不保证处理成功。
+// LuaRedisDelayQueuePush 写入的消息从 key:payload 读取内容并一并删除；直接 ZADD 的旧消息以成员本身作为 ID 与内容。
 func (r *RedisConfig) LuaRedisDelayQueuePop(key string, currentTime int64, limit int64) ([]*DelayedMessage, error) {
 	lua := `local key = KEYS[1]
+			local processing_key = KEYS[2]
+			local payload_key = KEYS[3]
+			local attempts_key = KEYS[4]
 			local current_time = tonumber(ARGV[1])
 			local limit = tonumber(ARGV[2])
 			
@@ -783,33 +788,194 @@ func (r *RedisConfig) LuaRedisDelayQueuePop(key string, currentTime int64, limit
 			local messages = redis.call('ZRANGEBYSCORE', key, 0, current_time, 'WITHSCORES', 'LIMIT', 0, limit)
 			
 			if #messages == 0 then
-				return cjson.encode({})
+				return '[]'
 			end
 			
-			-- 构建结果
+			-- 构建结果并删除已弹出的消息
 			local results = {}
-			local members_to_remove = {}
-			
 			for i = 1, #messages, 2 do
-				local payload = messages[i]
-				local score = messages[i+1]
+				local id = messages[i]
+				local payload = redis.call('HGET', payload_key, id)
+				if payload then
+					redis.call('HDEL', payload_key, id)
+					redis.call('HDEL', attempts_key, id)
+					redis.call('ZREM', processing_key, id)
+				else
+					payload = id
+				end
+				redis.call('ZREM', key, id)
 				
 				table.insert(results, {
-					id = payload,
+					id = id,
 					payload = payload,
-					score = tonumber(score)
+					score = tonumber(messages[i+1])
 				})
-				table.insert(members_to_remove, payload)
 			end
 			
-			-- 删除已处理的消息
-			if #members_to_remove > 0 then
-				redis.call('ZREM', key, unpack(members_to_remove))
+			return cjson.encode(results)`
+
+	return runLuaDecode[[]*DelayedMessage](r, lua, delayQueueKeys(key), currentTime, limit)
+}
+
+// delayQueueKeys 返回延迟队列的待执行集合、处理中集合、消息内容哈希、投递次数哈希与死信哈希，集群模式下请在 key 中使用 {hash tag}。
+func delayQueueKeys(key string) []string {
+	return []string{key, key + ":processing", key + ":payload", key + ":attempts", key + ":dead"}
+}
+
+// LuaRedisDelayQueuePush 用来写入延迟消息并返回生成的唯一 ID，内容存放在哈希中，相同内容不会被合并。
+func (r *RedisConfig) LuaRedisDelayQueuePush(key, payload string, runAt int64) (string, error) {
+	lua := `local key = KEYS[1]
+			local payload_key = KEYS[3]
+			local id = ARGV[1]
+			
+			redis.call('HSET', payload_key, id, ARGV[2])
+			redis.call('ZADD', key, tonumber(ARGV[3]), id)
+			return 1`
+
+	id := GetUUID()
+	if _, err := runLuaInt64(r, lua, delayQueueKeys(key), id, payload, runAt); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// LuaRedisDelayQueueClaim 用来领取到期消息并移入处理中集合，租约在 currentTime+leaseMillis 到期，到期前需要 Ack。
+// 每次领取都会累加投递次数，包括租约过期后的重新投递。
+func (r *RedisConfig) LuaRedisDelayQueueClaim(key string, currentTime, leaseMillis, limit int64) ([]*DelayedMessage, error) {
+	lua := `local key = KEYS[1]
+			local processing_key = KEYS[2]
+			local payload_key = KEYS[3]
+			local attempts_key = KEYS[4]
+			local current_time = tonumber(ARGV[1])
+			local lease = tonumber(ARGV[2])
+			local limit = tonumber(ARGV[3])
+			
+			local messages = redis.call('ZRANGEBYSCORE', key, '-inf', current_time, 'WITHSCORES', 'LIMIT', 0, limit)
+			local results = {}
+			
+			for i = 1, #messages, 2 do
+				local id = messages[i]
+				redis.call('ZREM', key, id)
+				
+				-- 内容已被删除的消息直接丢弃
+				local payload = redis.call('HGET', payload_key, id)
+				if payload then
+					redis.call('ZADD', processing_key, current_time + lease, id)
+					table.insert(results, {
+						id = id,
+						payload = payload,
+						score = tonumber(messages[i+1]),
+						attempts = redis.call('HINCRBY', attempts_key, id, 1)
+					})
+				end
 			end
 			
+			if #results == 0 then
+				return '[]'
+			end
 			return cjson.encode(results)`
 
-	return runLuaDecode[[]*DelayedMessage](r, lua, []string{key}, currentTime, limit)
+	return runLuaDecode[[]*DelayedMessage](r, lua, delayQueueKeys(key), currentTime, leaseMillis, limit)
+}
+
+// LuaRedisDelayQueueAck 用来确认消息已处理并删除内容，租约过期被重新入队的消息也会一并删除。
+func (r *RedisConfig) LuaRedisDelayQueueAck(key, id string) (bool, error) {
+	lua := `local key = KEYS[1]
+			local processing_key = KEYS[2]
+			local payload_key = KEYS[3]
+			local attempts_key = KEYS[4]
+			local id = ARGV[1]
+			
+			redis.call('ZREM', processing_key, id)
+			redis.call('ZREM', key, id)
+			redis.call('HDEL', attempts_key, id)
+			return redis.call('HDEL', payload_key, id)`
+
+	result, err := runLuaInt64(r, lua, delayQueueKeys(key), id)
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// LuaRedisDelayQueueExtend 用来为处理中的消息续租，消息已不在处理中集合时返回 false。
+func (r *RedisConfig) LuaRedisDelayQueueExtend(key, id string, currentTime, leaseMillis int64) (bool, error) {
+	lua := `local processing_key = KEYS[2]
+			local id = ARGV[1]
+			
+			if not redis.call('ZSCORE', processing_key, id) then
+				return 0
+			end
+			redis.call('ZADD', processing_key, tonumber(ARGV[2]) + tonumber(ARGV[3]), id)
+			return 1`
+
+	result, err := runLuaInt64(r, lua, delayQueueKeys(key), id, currentTime, leaseMillis)
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// LuaRedisDelayQueueRetry 用来把处理中的消息放回待执行集合，在 runAt 重新投递。
+func (r *RedisConfig) LuaRedisDelayQueueRetry(key, id string, runAt int64) (bool, error) {
+	lua := `local key = KEYS[1]
+			local processing_key = KEYS[2]
+			local id = ARGV[1]
+			
+			if redis.call('ZREM', processing_key, id) == 0 then
+				return 0
+			end
+			redis.call('ZADD', key, tonumber(ARGV[2]), id)
+			return 1`
+
+	result, err := runLuaInt64(r, lua, delayQueueKeys(key), id, runAt)
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// LuaRedisDelayQueueDead 用来把处理中的消息移入死信哈希，不再投递，消息已不在处理中集合时返回 false。
+// 死信以 ID 为字段、内容为值保存在 key+":dead" 中，需要时由调用方读取后重新 Push。
+func (r *RedisConfig) LuaRedisDelayQueueDead(key, id string) (bool, error) {
+	lua := `local processing_key = KEYS[2]
+			local payload_key = KEYS[3]
+			local attempts_key = KEYS[4]
+			local dead_key = KEYS[5]
+			local id = ARGV[1]
+			
+			if redis.call('ZREM', processing_key, id) == 0 then
+				return 0
+			end
+			local payload = redis.call('HGET', payload_key, id)
+			if payload then
+				redis.call('HSET', dead_key, id, payload)
+			end
+			redis.call('HDEL', payload_key, id)
+			redis.call('HDEL', attempts_key, id)
+			return 1`
+
+	result, err := runLuaInt64(r, lua, delayQueueKeys(key), id)
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// LuaRedisDelayQueueRequeue 用来把租约已过期的消息放回待执行集合，返回重新入队的数量。
+func (r *RedisConfig) LuaRedisDelayQueueRequeue(key string, currentTime, limit int64) (int64, error) {
+	lua := `local key = KEYS[1]
+			local processing_key = KEYS[2]
+			local current_time = tonumber(ARGV[1])
+			
+			local expired = redis.call('ZRANGEBYSCORE', processing_key, '-inf', current_time, 'LIMIT', 0, tonumber(ARGV[2]))
+			for _, id in ipairs(expired) do
+				redis.call('ZREM', processing_key, id)
+				redis.call('ZADD', key, current_time, id)
+			end
+			return #expired`
+
+	return runLuaInt64(r, lua, delayQueueKeys(key), currentTime, limit)
 }
 
 // 10. 布隆过滤器模拟 (使用多个 Hash)
@@ -0,0 +1,406 @@
+package wd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+	"gorm.io/gorm/schema"
+)
+
+const defaultRepositoryPrimaryKey = "id"
+
+// repositoryQuery 由 gen 生成的根查询对象（例如 query.User）实现。
+type repositoryQuery[D any] interface {
+	WithContext(ctx context.Context) D
+	GetFieldByName(string) (field.OrderExpr, bool)
+}
+
+// RepositoryDo 由 gen 生成的 IXxxDo 接口实现。
+type RepositoryDo[D any, M any] interface {
+	Where(conds ...gen.Condition) D
+	Order(conds ...field.Expr) D
+	Limit(limit int) D
+	Offset(offset int) D
+	Unscoped() D
+	Count() (int64, error)
+	First() (*M, error)
+	Find() ([]*M, error)
+	Create(values ...*M) error
+	UpdateSimple(columns ...field.AssignExpr) (gen.ResultInfo, error)
+	Delete(models ...*M) (gen.ResultInfo, error)
+}
+
+// repositoryCustomDeleter 对应 gen 按 CustomDeleted 接口生成的方法，生成代码中 gen.RowsAffected 会被替换为 int64。
+type repositoryCustomDeleter interface {
+	CustomDeletedFlag(id any) (int64, error)
+	CustomDeletedUnscoped(id any) (int64, error)
+}
+
+type repositoryOptions struct {
+	primaryKey    string
+	versionColumn string
+	notFoundMsg   string
+}
+
+type WithRepositoryOption func(*repositoryOptions)
+
+// WithRepositoryPrimaryKey 设置主键列名，默认 id。
+func WithRepositoryPrimaryKey(column string) WithRepositoryOption {
+	return func(o *repositoryOptions) {
+		if column != "" {
+			o.primaryKey = column
+		}
+	}
+}
+
+// WithRepositoryVersionColumn 设置乐观锁版本列名，设置后 Patch 会校验并自增该列。
+func WithRepositoryVersionColumn(column string) WithRepositoryOption {
+	return func(o *repositoryOptions) {
+		o.versionColumn = column
+	}
+}
+
+// WithRepositoryNotFoundMsg 设置记录不存在时的提示信息。
+func WithRepositoryNotFoundMsg(msg string) WithRepositoryOption {
+	return func(o *repositoryOptions) {
+		o.notFoundMsg = msg
+	}
+}
+
+// Repository 基于 gorm/gen 查询对象的通用 CRUD 封装。
+// M 为模型类型，D 为 gen 生成的 IXxxDo 接口。
+type Repository[M any, D RepositoryDo[D, M]] struct {
+	table       any
+	fields      listFieldQuery
+	withContext func(ctx context.Context) D
+	opts        repositoryOptions
+}
+
+// NewRepository 用来基于 gen 生成的根查询对象创建仓储，例如 wd.NewRepository(query.User)。
+func NewRepository[Q repositoryQuery[D], D RepositoryDo[D, M], M any](query Q, opts ...WithRepositoryOption) *Repository[M, D] {
+	options := repositoryOptions{
+		primaryKey:  defaultRepositoryPrimaryKey,
+		notFoundMsg: errNotFound.Message,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Repository[M, D]{
+		table:       query,
+		fields:      query,
+		withContext: query.WithContext,
+		opts:        options,
+	}
+}
+
+// Query 返回绑定了 ctx 的查询对象，ctx 中存在 WithTx 开启的事务时自动使用该事务。
+func (r *Repository[M, D]) Query(ctx context.Context) D {
+	return UseTx(ctx, r.withContext(ctx))
+}
+
+// GetByID 按主键查询单条记录。
+func (r *Repository[M, D]) GetByID(ctx context.Context, id any) (*M, error) {
+	cond, err := r.primaryKeyCond(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, cond)
+}
+
+// Get 按条件查询单条记录。
+func (r *Repository[M, D]) Get(ctx context.Context, conds ...gen.Condition) (*M, error) {
+	model, err := r.Query(ctx).Where(conds...).First()
+	if err != nil {
+		return nil, repositoryErr(err, "查询失败", r.opts.notFoundMsg)
+	}
+	return model, nil
+}
+
+// Find 按条件查询全部记录。
+func (r *Repository[M, D]) Find(ctx context.Context, conds ...gen.Condition) ([]*M, error) {
+	list, err := r.Query(ctx).Where(conds...).Find()
+	if err != nil {
+		return nil, repositoryErr(err, "查询失败")
+	}
+	return list, nil
+}
+
+// Count 按条件统计记录数。
+func (r *Repository[M, D]) Count(ctx context.Context, conds ...gen.Condition) (int64, error) {
+	count, err := r.Query(ctx).Where(conds...).Count()
+	if err != nil {
+		return 0, repositoryErr(err, "查询失败")
+	}
+	return count, nil
+}
+
+// List 按 ReqList 的过滤、排序和分页规则查询列表，conds 会作为额外条件一并生效。
+func (r *Repository[M, D]) List(ctx context.Context, req *ReqList, conds ...gen.Condition) (*PageResult[*M], error) {
+	filterConds, err := req.Conditions(r.fields)
+	if err != nil {
+		return nil, err
+	}
+	cursorConds, err := req.CursorConditions(r.fields)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := req.Orders(r.fields)
+	if err != nil {
+		return nil, err
+	}
+
+	whereConds := append(append([]gen.Condition{}, conds...), filterConds...)
+	total, err := r.Count(ctx, whereConds...)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := r.Query(ctx).
+		Where(append(whereConds, cursorConds...)...).
+		Order(orders...).
+		Limit(req.PageSize() + 1).
+		Offset(req.Offset()).
+		Find()
+	if err != nil {
+		return nil, repositoryErr(err, "查询失败")
+	}
+	return NewPageResult(req, list, total)
+}
+
+// Create 批量创建记录，唯一键冲突会映射为 MsgErrUniqueIndexConflict。
+func (r *Repository[M, D]) Create(ctx context.Context, models ...*M) error {
+	if err := r.Query(ctx).Create(models...); err != nil {
+		return repositoryErr(err, "创建失败")
+	}
+	return nil
+}
+
+// Patch 使用 BuildGenUpdates 按 PATCH 请求更新指定记录，返回是否有字段发生变更。
+// 配置了版本列时，会以读取到的旧版本号作为更新条件并自增版本号，版本不一致时返回 MsgErrVERSION_CONFLICT。
+func (r *Repository[M, D]) Patch(ctx context.Context, id any, req any) (bool, error) {
+	return r.patch(ctx, id, req, nil)
+}
+
+// PatchWithVersion 与 Patch 相同，但要求客户端提交的 version 与当前记录一致。
+func (r *Repository[M, D]) PatchWithVersion(ctx context.Context, id any, version any, req any) (bool, error) {
+	if r.opts.versionColumn == "" {
+		return false, MsgErrServerBusy("未配置版本列", fmt.Errorf("repository 未设置 WithRepositoryVersionColumn"))
+	}
+	return r.patch(ctx, id, req, &version)
+}
+
+func (r *Repository[M, D]) patch(ctx context.Context, id any, req any, expectedVersion *any) (bool, error) {
+	old, err := r.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	updates, err := BuildGenUpdates(req, old, r.table)
+	if err != nil {
+		return false, MsgErrServerBusy("构建更新失败", err)
+	}
+
+	cond, err := r.primaryKeyCond(id)
+	if err != nil {
+		return false, err
+	}
+	conds := []gen.Condition{cond}
+
+	if r.opts.versionColumn != "" {
+		values, err := modelColumnValues(old, r.opts.versionColumn)
+		if err != nil {
+			return false, MsgErrServerBusy("读取版本号失败", err)
+		}
+		oldVersion := values[0]
+		if expectedVersion != nil && fmt.Sprint(*expectedVersion) != fmt.Sprint(oldVersion) {
+			return false, MsgErrVERSION_CONFLICT("")
+		}
+		if len(updates) == 0 {
+			return false, nil
+		}
+
+		versionCond, versionUpdate, err := r.versionExprs(oldVersion)
+		if err != nil {
+			return false, err
+		}
+		conds = append(conds, versionCond)
+		updates = append(updates, versionUpdate)
+	}
+	if len(updates) == 0 {
+		return false, nil
+	}
+
+	info, err := r.Query(ctx).Where(conds...).UpdateSimple(updates...)
+	if err != nil {
+		return false, repositoryErr(err, "更新失败")
+	}
+	if info.RowsAffected == 0 && r.opts.versionColumn != "" {
+		return false, MsgErrVERSION_CONFLICT("")
+	}
+	return true, nil
+}
+
+// Delete 删除指定记录。
+// 查询对象实现了 CustomDeleted 且主键为 id 时按 CustomDeletedFlag 的语义软删，否则交给 gorm 的 Delete 处理（模型含 gorm.DeletedAt 时为软删）。
+// 需要租户隔离时不使用 CustomDeleted 的原生 SQL，改为经过租户插件的 UPDATE。
+func (r *Repository[M, D]) Delete(ctx context.Context, id any) error {
+	do := r.Query(ctx)
+	deleter, custom := any(do).(repositoryCustomDeleter)
+	custom = custom && r.opts.primaryKey == defaultRepositoryPrimaryKey
+	if custom && !r.tenantScoped(ctx) {
+		rows, err := deleter.CustomDeletedFlag(id)
+		return r.deleteResult(rows, err)
+	}
+
+	cond, err := r.primaryKeyCond(id)
+	if err != nil {
+		return err
+	}
+	if custom {
+		if updates, ok := r.deletedFlagExprs(); ok {
+			info, err := do.Where(cond).UpdateSimple(updates...)
+			return r.deleteResult(info.RowsAffected, err)
+		}
+	}
+	info, err := do.Where(cond).Delete()
+	return r.deleteResult(info.RowsAffected, err)
+}
+
+// HardDelete 物理删除指定记录，忽略软删字段。
+func (r *Repository[M, D]) HardDelete(ctx context.Context, id any) error {
+	do := r.Query(ctx)
+	if deleter, ok := any(do).(repositoryCustomDeleter); ok && r.opts.primaryKey == defaultRepositoryPrimaryKey && !r.tenantScoped(ctx) {
+		rows, err := deleter.CustomDeletedUnscoped(id)
+		return r.deleteResult(rows, err)
+	}
+
+	cond, err := r.primaryKeyCond(id)
+	if err != nil {
+		return err
+	}
+	info, err := do.Unscoped().Where(cond).Delete()
+	return r.deleteResult(info.RowsAffected, err)
+}
+
+// tenantScoped 判断删除是否需要租户隔离：ctx 带租户，或模型含租户列且未跳过隔离。
+func (r *Repository[M, D]) tenantScoped(ctx context.Context) bool {
+	if IsTenantSkipped(ctx) {
+		return false
+	}
+	if _, ok := TenantFromContext(ctx); ok {
+		return true
+	}
+	return isTenantModel(new(M))
+}
+
+// deletedFlagExprs 生成与 CustomDeletedFlag 相同的 deleted_at、deleted_at_flag 赋值表达式。
+func (r *Repository[M, D]) deletedFlagExprs() ([]field.AssignExpr, bool) {
+	values := map[string]string{"deleted_at": "CURRENT_TIMESTAMP", "deleted_at_flag": "1"}
+	updates := make([]field.AssignExpr, 0, len(values))
+	for _, name := range []string{"deleted_at", "deleted_at_flag"} {
+		column, ok := r.fields.GetFieldByName(name)
+		if !ok {
+			return nil, false
+		}
+		setter, ok := column.(interface {
+			SetCol(col field.Expr) field.AssignExpr
+		})
+		if !ok {
+			return nil, false
+		}
+		updates = append(updates, setter.SetCol(field.NewUnsafeFieldRaw(values[name])))
+	}
+	return updates, true
+}
+
+func (r *Repository[M, D]) deleteResult(rowsAffected int64, err error) error {
+	if err != nil {
+		return repositoryErr(err, "删除失败")
+	}
+	if rowsAffected == 0 {
+		return MsgErrNotFound(r.opts.notFoundMsg)
+	}
+	return nil
+}
+
+// repositoryErr 在 ReturnErrDatabase 的基础上原样返回业务错误，并把唯一键冲突映射为 MsgErrUniqueIndexConflict。
+func repositoryErr(err error, msg string, notfoundMsg ...string) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if ErrDuplicatedKey(err) {
+		return MsgErrUniqueIndexConflict("", err)
+	}
+	return ReturnErrDatabase(err, msg, notfoundMsg...)
+}
+
+func (r *Repository[M, D]) primaryKeyCond(id any) (field.Expr, error) {
+	column, ok := r.fields.GetFieldByName(r.opts.primaryKey)
+	if !ok {
+		return nil, MsgErrServerBusy("主键列不存在", fmt.Errorf("字段 %s 不存在", r.opts.primaryKey))
+	}
+	return field.NewUnsafeFieldRaw("? = ?", column, id), nil
+}
+
+// versionExprs 生成 version = old 的条件以及 version = version + 1 的赋值表达式。
+func (r *Repository[M, D]) versionExprs(oldVersion any) (field.Expr, field.AssignExpr, error) {
+	column, ok := r.fields.GetFieldByName(r.opts.versionColumn)
+	if !ok {
+		return nil, nil, MsgErrServerBusy("版本列不存在", fmt.Errorf("字段 %s 不存在", r.opts.versionColumn))
+	}
+	setter, ok := column.(interface {
+		SetCol(col field.Expr) field.AssignExpr
+	})
+	if !ok {
+		return nil, nil, MsgErrServerBusy("版本列不支持更新", fmt.Errorf("字段 %s 类型为 %T", r.opts.versionColumn, column))
+	}
+	return field.NewUnsafeFieldRaw("? = ?", column, oldVersion),
+		setter.SetCol(field.NewUnsafeFieldRaw("? + 1", column)),
+		nil
+}
+
+var modelSchemaCache sync.Map
+
+func parseModelSchema(model any) (*schema.Schema, error) {
+	namer := schema.Namer(schema.NamingStrategy{})
+	if InsDB != nil && InsDB.DB != nil && InsDB.NamingStrategy != nil {
+		namer = InsDB.NamingStrategy
+	}
+	return schema.Parse(model, &modelSchemaCache, namer)
+}
+
+// modelColumnValues 按数据库列名从模型中读取字段值。
+func modelColumnValues(model any, columns ...string) ([]any, error) {
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Pointer {
+		return nil, fmt.Errorf("model 必须为指针: %T", model)
+	}
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("model 不能为空")
+		}
+		rv = rv.Elem()
+	}
+
+	modelSchema, err := parseModelSchema(rv.Addr().Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, 0, len(columns))
+	for _, column := range columns {
+		schemaField := modelSchema.LookUpField(column)
+		if schemaField == nil {
+			return nil, fmt.Errorf("模型缺少字段 %s", column)
+		}
+		value, _ := schemaField.ValueOf(BackgroundContext(), rv)
+		values = append(values, value)
+	}
+	return values, nil
+}
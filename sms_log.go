@@ -0,0 +1,601 @@
+package wd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v5/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	SMSStatusSubmitted int8 = 0 // 已提交服务商，等待回执
+	SMSStatusDelivered int8 = 1 // 已送达
+	SMSStatusFailed    int8 = 2 // 发送失败或回执失败
+	SMSStatusBlocked   int8 = 3 // 超出配额未发送
+
+	SMSQuotaPhone    = "phone"    // 按手机号计数
+	SMSQuotaTemplate = "template" // 按模板计数
+	SMSQuotaGlobal   = "global"   // 全部短信计数
+
+	defaultSMSLogPrefix       = "sms-log:"
+	defaultSMSLogBatchSize    = 100
+	defaultSMSReceiptDelay    = time.Minute
+	defaultSMSReceiptMaxDelay = 30 * time.Minute
+	defaultSMSReceiptTimeout  = 72 * time.Hour
+	defaultSMSReceiptLockKey  = "sms-receipt-lock"
+	maxSMSLogErrorLength      = 512
+)
+
+var ErrSMSQuotaExceeded = errors.New("短信发送超出配额")
+
+// ErrSMSPhoneHashRequired 表示既没有可用的 InsKeyring 盲索引密钥也没有设置手机号哈希，NewSMSLogSender 会返回该错误。
+var ErrSMSPhoneHashRequired = errors.New("未设置手机号哈希密钥，需要初始化InsKeyring或使用WithSMSLogPhoneHash()设置")
+
+// SMSSendLog 是一条短信发送记录，手机号只保存脱敏值与哈希。
+type SMSSendLog struct {
+	ID           uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Provider     string     `gorm:"column:provider;type:varchar(32);not null;default:''" json:"provider"`
+	Phone        string     `gorm:"column:phone;type:varchar(32);not null" json:"phone"`
+	PhoneHash    string     `gorm:"column:phone_hash;type:varchar(64);not null;index" json:"-"`
+	SignName     string     `gorm:"column:sign_name;type:varchar(64);not null;default:''" json:"sign_name"`
+	TemplateCode string     `gorm:"column:template_code;type:varchar(64);not null;index" json:"template_code"`
+	BizID        string     `gorm:"column:biz_id;type:varchar(64);not null;default:'';index" json:"biz_id"`
+	RequestID    string     `gorm:"column:request_id;type:varchar(64);not null;default:''" json:"request_id"`
+	Status       int8       `gorm:"column:status;not null;default:0;index:idx_sms_log_status_next,priority:1" json:"status"`
+	ErrCode      string     `gorm:"column:err_code;type:varchar(64);not null;default:''" json:"err_code"`
+	ErrMsg       string     `gorm:"column:err_msg;type:varchar(512);not null;default:''" json:"err_msg"`
+	QueryCount   int        `gorm:"column:query_count;not null;default:0" json:"query_count"`
+	NextQueryAt  time.Time  `gorm:"column:next_query_at;not null;index:idx_sms_log_status_next,priority:2" json:"next_query_at"`
+	ReportedAt   *time.Time `gorm:"column:reported_at" json:"reported_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at;not null;index" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at;not null" json:"updated_at"`
+}
+
+// TableName 返回短信发送记录表名。
+func (SMSSendLog) TableName() string {
+	return "sms_send_log"
+}
+
+// InitSMSLogTable 在数据库中创建短信发送记录表，如果mandatory为true则会强制迁移，否则则会先去检查是否存在，不存在才创建
+func InitSMSLogTable(mandatory ...bool) error {
+	if InsDB == nil {
+		return gormClientNilErr()
+	}
+	if len(mandatory) == 0 || (len(mandatory) > 0 && !mandatory[0]) {
+		if InsDB.DB.Migrator().HasTable(&SMSSendLog{}) {
+			return nil
+		}
+	}
+
+	return InsDB.DB.AutoMigrate(&SMSSendLog{})
+}
+
+// SMSReceipt 是服务商返回的送达回执，Status 为 SMSStatusSubmitted 表示还在等待。
+type SMSReceipt struct {
+	Status     int8       `json:"status"`
+	ErrCode    string     `json:"err_code"`
+	ReportedAt *time.Time `json:"reported_at"`
+}
+
+// SMSReceiptQuerier 是支持查询送达回执的服务商。
+type SMSReceiptQuerier interface {
+	QueryReceipt(ctx context.Context, phone, bizID string, sendAt time.Time) (*SMSReceipt, error)
+}
+
+// QueryReceipt 用来通过 QuerySendDetails 查询送达回执。
+func (s *SMSService) QueryReceipt(_ context.Context, phone, bizID string, sendAt time.Time) (*SMSReceipt, error) {
+	req := &dysmsapi20170525.QuerySendDetailsRequest{
+		PhoneNumber: tea.String(phone),
+		BizId:       tea.String(bizID),
+		SendDate:    tea.String(sendAt.In(ShangHaiTimeLocation).Format("20060102")),
+		PageSize:    tea.Int64(10),
+		CurrentPage: tea.Int64(1),
+	}
+	var body *dysmsapi20170525.QuerySendDetailsResponseBody
+	err := s.callWithRuntime(func(runtime *util.RuntimeOptions) error {
+		resp, err := s.client.QuerySendDetailsWithOptions(req, runtime)
+		if err != nil {
+			return err
+		}
+		body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("阿里云短信返回为空")
+	}
+	if tea.StringValue(body.Code) != "OK" {
+		return nil, fmt.Errorf("阿里云短信回执查询失败: %s %s", tea.StringValue(body.Code), tea.StringValue(body.Message))
+	}
+	if body.SmsSendDetailDTOs == nil || len(body.SmsSendDetailDTOs.SmsSendDetailDTO) == 0 {
+		return &SMSReceipt{Status: SMSStatusSubmitted}, nil
+	}
+
+	detail := body.SmsSendDetailDTOs.SmsSendDetailDTO[0]
+	receipt := &SMSReceipt{ErrCode: tea.StringValue(detail.ErrCode)}
+	// SendStatus：1 等待回执，2 发送失败，3 发送成功
+	switch tea.Int64Value(detail.SendStatus) {
+	case 2:
+		receipt.Status = SMSStatusFailed
+	case 3:
+		receipt.Status = SMSStatusDelivered
+		receipt.ErrCode = ""
+	default:
+		receipt.Status = SMSStatusSubmitted
+		return receipt, nil
+	}
+	if reported, err := time.ParseInLocation(CSTLayout, tea.StringValue(detail.ReceiveDate), ShangHaiTimeLocation); err == nil {
+		receipt.ReportedAt = &reported
+	}
+	return receipt, nil
+}
+
+// QueryReceipt 让 FakeSMSSender 记录的短信都视为已送达，设置了 SetError 时返回该错误。
+func (f *FakeSMSSender) QueryReceipt(_ context.Context, _, bizID string, _ time.Time) (*SMSReceipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, record := range f.records {
+		if record.BizID == bizID {
+			reported := Now()
+			return &SMSReceipt{Status: SMSStatusDelivered, ReportedAt: &reported}, nil
+		}
+	}
+	return &SMSReceipt{Status: SMSStatusFailed, ErrCode: "NOT_FOUND"}, nil
+}
+
+type smsQuota struct {
+	scope  string
+	limit  int64
+	window time.Duration
+}
+
+// SMSLogSender 包装 SMSSender，发送前检查配额，发送后写入 SMSSendLog，并可以定时查询送达回执。
+type SMSLogSender struct {
+	sender         SMSSender
+	db             *gorm.DB
+	prefix         string
+	quotas         []smsQuota
+	phoneHash      func(phone string) string
+	queriers       map[string]SMSReceiptQuerier
+	batchSize      int
+	receiptDelay   time.Duration
+	receiptTimeout time.Duration
+	lockKey        string
+	errorHandler   func(err error)
+}
+
+// WithSMSLogOption 短信发送记录的配置项。
+type WithSMSLogOption func(*SMSLogSender)
+
+// WithSMSLogDB 指定发送记录所在的数据库连接，默认 InsDB。
+func WithSMSLogDB(db *gorm.DB) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		s.db = db
+	}
+}
+
+// WithSMSLogPrefix 设置配额计数与待查回执使用的 Redis 键前缀，默认 sms-log:。
+func WithSMSLogPrefix(prefix string) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if prefix != "" {
+			s.prefix = prefix
+		}
+	}
+}
+
+// WithSMSLogQuota 添加发送配额，scope 取 SMSQuotaPhone、SMSQuotaTemplate 或 SMSQuotaGlobal，
+// window 为统计周期，按北京时间对齐，例如 24 小时即每天零点重置。可以多次调用叠加多个配额。
+func WithSMSLogQuota(scope string, limit int64, window time.Duration) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if limit > 0 && window >= time.Second {
+			s.quotas = append(s.quotas, smsQuota{scope: scope, limit: limit, window: window})
+		}
+	}
+}
+
+// WithSMSLogPhoneHash 设置手机号哈希方式，用于按手机号查询记录，默认使用 InsKeyring.BlindIndex。
+// 手机号空间很小，哈希必须带密钥，否则可以被穷举还原。
+func WithSMSLogPhoneHash(hash func(phone string) string) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if hash != nil {
+			s.phoneHash = hash
+		}
+	}
+}
+
+// WithSMSLogReceiptQuerier 为服务商注册回执查询，实现了 SMSReceiptQuerier 的服务商（包括 SMSClient 中的）会自动注册。
+func WithSMSLogReceiptQuerier(provider string, querier SMSReceiptQuerier) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		s.queriers[provider] = querier
+	}
+}
+
+// WithSMSLogReceipt 设置首次查询回执的延迟与放弃查询的时限，默认 1 分钟、72 小时。
+func WithSMSLogReceipt(delay, timeout time.Duration) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if delay > 0 {
+			s.receiptDelay = delay
+		}
+		if timeout > 0 {
+			s.receiptTimeout = timeout
+		}
+	}
+}
+
+// WithSMSLogBatchSize 设置每次查询回执的最大条数。
+func WithSMSLogBatchSize(size int) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
+
+// WithSMSLogLockKey 设置多实例部署时互斥查询回执使用的 Redis 锁键名。
+func WithSMSLogLockKey(key string) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		if key != "" {
+			s.lockKey = key
+		}
+	}
+}
+
+// WithSMSLogErrorHandler 设置写入记录或查询回执出错时的回调，这类错误不会影响短信发送结果。
+func WithSMSLogErrorHandler(handler func(err error)) WithSMSLogOption {
+	return func(s *SMSLogSender) {
+		s.errorHandler = handler
+	}
+}
+
+// NewSMSLogSender 创建带发送记录与配额的短信服务商，配额计数需要 InsRedis。
+// 手机号哈希需要 InsKeyring 设置了盲索引密钥，或者通过 WithSMSLogPhoneHash 指定，否则返回 ErrSMSPhoneHashRequired。
+func NewSMSLogSender(sender SMSSender, opts ...WithSMSLogOption) (*SMSLogSender, error) {
+	s := &SMSLogSender{
+		sender:         sender,
+		prefix:         defaultSMSLogPrefix,
+		queriers:       make(map[string]SMSReceiptQuerier),
+		batchSize:      defaultSMSLogBatchSize,
+		receiptDelay:   defaultSMSReceiptDelay,
+		receiptTimeout: defaultSMSReceiptTimeout,
+		lockKey:        defaultSMSReceiptLockKey,
+	}
+	providers := []SMSSender{sender}
+	if client, ok := sender.(*SMSClient); ok {
+		providers = client.providers
+	}
+	for _, p := range providers {
+		if querier, ok := p.(SMSReceiptQuerier); ok {
+			s.queriers[p.Name()] = querier
+		}
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.phoneHash == nil {
+		keyring := InsKeyring
+		if keyring == nil {
+			return nil, ErrSMSPhoneHashRequired
+		}
+		if _, err := keyring.BlindIndex(nil); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSMSPhoneHashRequired, err)
+		}
+		s.phoneHash = func(phone string) string {
+			hash, _ := keyring.BlindIndex([]byte(phone))
+			return hash
+		}
+	}
+	return s, nil
+}
+
+// Name 用来返回被包装服务商的名称。
+func (s *SMSLogSender) Name() string {
+	return s.sender.Name()
+}
+
+// Send 用来检查配额、发送短信并写入发送记录。
+// 超出配额返回 ErrSMSQuotaExceeded，记录写入失败只会触发错误回调，不影响发送结果。
+func (s *SMSLogSender) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	if msg == nil || !ValidateChineseMobile(msg.Phone) {
+		return s.sender.Send(ctx, msg)
+	}
+	phone := normalizeChineseMobile(msg.Phone)
+	entry := &SMSSendLog{
+		Provider:     s.sender.Name(),
+		Phone:        MaskMobile(phone),
+		PhoneHash:    s.phoneHash(phone),
+		SignName:     msg.SignName,
+		TemplateCode: msg.TemplateCode,
+	}
+
+	acquired, scope, err := s.acquireQuota(ctx, phone, msg.TemplateCode)
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		quotaErr := fmt.Errorf("%w: %s", ErrSMSQuotaExceeded, scope)
+		s.save(ctx, entry, SMSStatusBlocked, "QUOTA_"+scope, quotaErr)
+		return nil, quotaErr
+	}
+
+	result, sendErr := s.sender.Send(ctx, msg)
+	if sendErr != nil {
+		s.releaseQuota(ctx, acquired)
+		s.save(ctx, entry, SMSStatusFailed, "SEND_FAILED", sendErr)
+		return nil, sendErr
+	}
+
+	entry.Provider = result.Provider
+	entry.BizID = result.BizID
+	entry.RequestID = result.RequestID
+	if s.save(ctx, entry, SMSStatusSubmitted, "", nil) && s.waitReceipt(entry) {
+		if err := InsRedis.Set(ctx, s.receiptKey(entry.ID), phone, s.receiptTimeout).Err(); err != nil {
+			s.handleError(err)
+		}
+	}
+	return result, nil
+}
+
+func (s *SMSLogSender) waitReceipt(entry *SMSSendLog) bool {
+	_, ok := s.queriers[entry.Provider]
+	return ok && entry.BizID != "" && InsRedis != nil
+}
+
+// acquireQuota 依次扣减配额，返回已扣减的键；某个配额不足时回滚已扣减的部分并返回该配额的 scope。
+func (s *SMSLogSender) acquireQuota(ctx context.Context, phone, template string) ([]string, string, error) {
+	if len(s.quotas) == 0 {
+		return nil, "", nil
+	}
+	if InsRedis == nil {
+		return nil, "", redisClientNilErr()
+	}
+	now := Now()
+	_, offset := now.Zone()
+	var acquired []string
+	for _, quota := range s.quotas {
+		var subject string
+		switch quota.scope {
+		case SMSQuotaPhone:
+			subject = phone
+		case SMSQuotaTemplate:
+			subject = template
+		}
+		seconds := int64(quota.window / time.Second)
+		bucket := (now.Unix() + int64(offset)) / seconds
+		key := s.prefix + "quota:" + quota.scope + ":" + strconv.FormatInt(seconds, 10) + ":" + subject + ":" + strconv.FormatInt(bucket, 10)
+		counter, err := InsRedis.LuaRedisIncrWithLimit(key, 1, quota.limit, seconds)
+		if err != nil {
+			s.releaseQuota(ctx, acquired)
+			return nil, "", err
+		}
+		if !counter.IsSuccess {
+			s.releaseQuota(ctx, acquired)
+			return nil, quota.scope, nil
+		}
+		acquired = append(acquired, key)
+	}
+	return acquired, "", nil
+}
+
+func (s *SMSLogSender) releaseQuota(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		InsRedis.DecrBy(ctx, key, 1)
+	}
+}
+
+func (s *SMSLogSender) save(ctx context.Context, entry *SMSSendLog, status int8, errCode string, cause error) bool {
+	db, err := s.conn(ctx)
+	if err != nil {
+		s.handleError(err)
+		return false
+	}
+	now := Now()
+	entry.Status = status
+	entry.ErrCode = errCode
+	if cause != nil {
+		entry.ErrMsg = truncateSMSError(cause)
+	}
+	entry.NextQueryAt = now.Add(s.receiptDelay)
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if err := db.Create(entry).Error; err != nil {
+		s.handleError(fmt.Errorf("短信发送记录写入失败: %w", err))
+		return false
+	}
+	return true
+}
+
+// RegisterReceiptJob 把回执查询注册到定时任务中，每个周期先获取 Redis 锁，保证多实例下同一时间只有一个实例在查询。
+func (s *SMSLogSender) RegisterReceiptJob(cron *CronConfig, interval time.Duration, options ...gocron.JobOption) (gocron.Job, error) {
+	if cron == nil {
+		return nil, errors.New("CronConfig为空,需要先使用InitCronJob()进行初始化")
+	}
+	if InsRedis == nil {
+		return nil, redisClientNilErr()
+	}
+	options = append([]gocron.JobOption{gocron.WithSingletonMode(gocron.LimitModeReschedule)}, options...)
+	return cron.RunJobEveryDuration(interval, gocron.NewTask(func() {
+		if err := s.runWithLock(interval); err != nil {
+			s.handleError(err)
+		}
+	}), options...)
+}
+
+func (s *SMSLogSender) runWithLock(interval time.Duration) error {
+	expiry := max(interval*2, 10*time.Second)
+	mutex := InsRedis.NewLock(s.lockKey, redsync.WithExpiry(expiry), redsync.WithTries(1))
+	if err := mutex.TryLock(); err != nil {
+		return nil
+	}
+	defer mutex.Unlock()
+
+	ctx, cancel := BackgroundTimeout(expiry)
+	defer cancel()
+	_, err := s.QueryReceipts(ctx)
+	return err
+}
+
+// QueryReceipts 执行一次回执查询，返回得到最终状态的条数。
+// 仍在等待的记录按查询次数逐步推迟下次查询，超过时限仍无回执的记为失败。
+func (s *SMSLogSender) QueryReceipts(ctx context.Context) (int, error) {
+	if len(s.queriers) == 0 {
+		return 0, nil
+	}
+	if InsRedis == nil {
+		return 0, redisClientNilErr()
+	}
+	db, err := s.conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []*SMSSendLog
+	if err := db.
+		Where("status = ? AND next_query_at <= ? AND biz_id <> ''", SMSStatusSubmitted, Now()).
+		Where("provider IN ?", slices.Sorted(maps.Keys(s.queriers))).
+		Order("next_query_at, id").
+		Limit(s.batchSize).
+		Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	finished := 0
+	var errs []error
+	for _, entry := range entries {
+		receipt, err := s.queryReceipt(ctx, entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("短信 %d 回执查询失败: %w", entry.ID, err))
+			receipt = &SMSReceipt{Status: SMSStatusSubmitted}
+		}
+		if receipt.Status == SMSStatusSubmitted && Now().Sub(entry.CreatedAt) >= s.receiptTimeout {
+			receipt = &SMSReceipt{Status: SMSStatusFailed, ErrCode: "RECEIPT_TIMEOUT"}
+		}
+
+		updates := map[string]any{
+			"query_count": entry.QueryCount + 1,
+			"updated_at":  Now(),
+		}
+		if receipt.Status == SMSStatusSubmitted {
+			delay := min(s.receiptDelay*time.Duration(entry.QueryCount+2), defaultSMSReceiptMaxDelay)
+			updates["next_query_at"] = Now().Add(delay)
+		} else {
+			updates["status"] = receipt.Status
+			updates["err_code"] = receipt.ErrCode
+			updates["reported_at"] = receipt.ReportedAt
+		}
+		if err := db.Model(&SMSSendLog{}).
+			Where("id = ? AND status = ?", entry.ID, SMSStatusSubmitted).
+			Updates(updates).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if receipt.Status != SMSStatusSubmitted {
+			InsRedis.Del(ctx, s.receiptKey(entry.ID))
+			finished++
+		}
+	}
+	return finished, errors.Join(errs...)
+}
+
+func (s *SMSLogSender) queryReceipt(ctx context.Context, entry *SMSSendLog) (*SMSReceipt, error) {
+	phone, err := InsRedis.Get(ctx, s.receiptKey(entry.ID)).Result()
+	if errors.Is(err, redis.Nil) {
+		// 手机号已过期，无法再查询
+		return &SMSReceipt{Status: SMSStatusFailed, ErrCode: "RECEIPT_TIMEOUT"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.queriers[entry.Provider].QueryReceipt(ctx, phone, entry.BizID, entry.CreatedAt)
+}
+
+// FindLogsByPhone 用来按手机号查询最近的发送记录，用于排查"收不到验证码"一类的问题。
+func (s *SMSLogSender) FindLogsByPhone(ctx context.Context, phone string, limit int) ([]*SMSSendLog, error) {
+	db, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*SMSSendLog
+	err = db.Where("phone_hash = ?", s.phoneHash(normalizeChineseMobile(phone))).
+		Order("id DESC").
+		Limit(max(limit, 1)).
+		Find(&entries).Error
+	return entries, err
+}
+
+// SMSReportRow 是发送统计中的一行，按服务商、模板、状态与错误码分组。
+type SMSReportRow struct {
+	Provider     string `json:"provider"`
+	TemplateCode string `json:"template_code"`
+	Status       int8   `json:"status"`
+	ErrCode      string `json:"err_code"`
+	Count        int64  `json:"count"`
+}
+
+// Report 用来统计 [from, to) 区间内的发送情况，statuses 为空时统计全部状态。
+func (s *SMSLogSender) Report(ctx context.Context, from, to time.Time, statuses ...int8) ([]*SMSReportRow, error) {
+	db, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := db.Model(&SMSSendLog{}).
+		Select("provider, template_code, status, err_code, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", from, to)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	var rows []*SMSReportRow
+	err = query.Group("provider, template_code, status, err_code").
+		Order("count DESC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// FailureReport 用来统计 [from, to) 区间内发送失败与超出配额的短信。
+func (s *SMSLogSender) FailureReport(ctx context.Context, from, to time.Time) ([]*SMSReportRow, error) {
+	return s.Report(ctx, from, to, SMSStatusFailed, SMSStatusBlocked)
+}
+
+func (s *SMSLogSender) conn(ctx context.Context) (*gorm.DB, error) {
+	db := s.db
+	if db == nil {
+		if InsDB == nil || InsDB.DB == nil {
+			return nil, gormClientNilErr()
+		}
+		db = InsDB.DB
+	}
+	return db.WithContext(ctx), nil
+}
+
+func (s *SMSLogSender) receiptKey(id uint64) string {
+	return s.prefix + "receipt:" + strconv.FormatUint(id, 10)
+}
+
+func (s *SMSLogSender) handleError(err error) {
+	if err != nil && s.errorHandler != nil {
+		s.errorHandler(err)
+	}
+}
+
+func truncateSMSError(err error) string {
+	msg := []rune(err.Error())
+	if len(msg) > maxSMSLogErrorLength {
+		msg = msg[:maxSMSLogErrorLength]
+	}
+	return string(msg)
+}
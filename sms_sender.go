@@ -0,0 +1,547 @@
+package wd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v5/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/go-resty/resty/v2"
+)
+
+var ErrSMSInvalidPhone = errors.New("手机号格式不正确")
+
+// SMSMessage 描述一条待发送的短信。
+// Params 为模板参数，结构体与 map 会编码成 JSON，string 与 []byte 视为已经编码好的 JSON。
+type SMSMessage struct {
+	Phone        string `json:"phone"`
+	SignName     string `json:"sign_name"`
+	TemplateCode string `json:"template_code"`
+	Params       any    `json:"params"`
+}
+
+// ParamJSON 用来返回模板参数的 JSON 文本，Params 为空时返回空字符串。
+func (m *SMSMessage) ParamJSON() (string, error) {
+	switch v := m.Params.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+	data, err := json.Marshal(m.Params)
+	if err != nil {
+		return "", fmt.Errorf("短信模板参数编码失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// SMSSendResult 是服务商返回的发送回执，BizID 用来查询送达状态。
+type SMSSendResult struct {
+	Provider  string `json:"provider"`
+	BizID     string `json:"biz_id"`
+	RequestID string `json:"request_id"`
+}
+
+// SMSSender 是短信服务商的统一抽象，业务代码只依赖它来切换服务商。
+type SMSSender interface {
+	Name() string
+	Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error)
+}
+
+// SMSBatchSender 是支持同模板批量发送的服务商，SendSMSBatch 会优先使用它。
+type SMSBatchSender interface {
+	SMSSender
+	SendBatch(ctx context.Context, msgs []*SMSMessage) (*SMSSendResult, error)
+}
+
+// SendSMSBatch 用来批量发送短信，服务商支持批量接口且模板一致时一次发出，否则逐条发送。
+func SendSMSBatch(ctx context.Context, sender SMSSender, msgs []*SMSMessage) ([]*SMSSendResult, error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	if batch, ok := sender.(SMSBatchSender); ok && !slices.ContainsFunc(msgs, func(m *SMSMessage) bool {
+		return m.TemplateCode != msgs[0].TemplateCode
+	}) {
+		result, err := batch.SendBatch(ctx, msgs)
+		if err != nil {
+			return nil, err
+		}
+		return []*SMSSendResult{result}, nil
+	}
+
+	results := make([]*SMSSendResult, 0, len(msgs))
+	var errs []error
+	for _, msg := range msgs {
+		result, err := sender.Send(ctx, msg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", msg.Phone, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+func normalizeSMSMessage(msg *SMSMessage) (*SMSMessage, string, error) {
+	if msg == nil {
+		return nil, "", errors.New("短信内容不能为空")
+	}
+	if !ValidateChineseMobile(msg.Phone) {
+		return nil, "", fmt.Errorf("%w: %s", ErrSMSInvalidPhone, msg.Phone)
+	}
+	param, err := msg.ParamJSON()
+	if err != nil {
+		return nil, "", err
+	}
+	normalized := *msg
+	normalized.Phone = normalizeChineseMobile(msg.Phone)
+	return &normalized, param, nil
+}
+
+// Name 用来返回服务商名称，SMSService 固定为 aliyun。
+func (s *SMSService) Name() string {
+	return "aliyun"
+}
+
+// Send 用来按 SMSSender 接口发送单条短信，服务端返回的 Code 不为 OK 时视为失败。
+func (s *SMSService) Send(_ context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	msg, param, err := normalizeSMSMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	req := &dysmsapi20170525.SendSmsRequest{
+		PhoneNumbers: tea.String(msg.Phone),
+		SignName:     tea.String(msg.SignName),
+		TemplateCode: tea.String(msg.TemplateCode),
+	}
+	if param != "" {
+		req.TemplateParam = tea.String(param)
+	}
+
+	var body *dysmsapi20170525.SendSmsResponseBody
+	err = s.callWithRuntime(func(runtime *util.RuntimeOptions) error {
+		resp, err := s.client.SendSmsWithOptions(req, runtime)
+		if err != nil {
+			return err
+		}
+		body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("阿里云短信返回为空")
+	}
+	if tea.StringValue(body.Code) != "OK" {
+		return nil, fmt.Errorf("阿里云短信发送失败: %s %s", tea.StringValue(body.Code), tea.StringValue(body.Message))
+	}
+	return &SMSSendResult{Provider: s.Name(), BizID: tea.StringValue(body.BizId), RequestID: tea.StringValue(body.RequestId)}, nil
+}
+
+// SendBatch 用来按 SMSBatchSender 接口批量发送同一模板的短信。
+func (s *SMSService) SendBatch(_ context.Context, msgs []*SMSMessage) (*SMSSendResult, error) {
+	phones := make([]string, 0, len(msgs))
+	signs := make([]string, 0, len(msgs))
+	params := make([]json.RawMessage, 0, len(msgs))
+	for _, m := range msgs {
+		msg, param, err := normalizeSMSMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if param == "" {
+			param = "{}"
+		}
+		phones = append(phones, msg.Phone)
+		signs = append(signs, msg.SignName)
+		params = append(params, json.RawMessage(param))
+	}
+	phoneJSON, _ := json.Marshal(phones)
+	signJSON, _ := json.Marshal(signs)
+	paramJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("短信模板参数编码失败: %w", err)
+	}
+	req := &dysmsapi20170525.SendBatchSmsRequest{
+		PhoneNumberJson:   tea.String(string(phoneJSON)),
+		SignNameJson:      tea.String(string(signJSON)),
+		TemplateCode:      tea.String(msgs[0].TemplateCode),
+		TemplateParamJson: tea.String(string(paramJSON)),
+	}
+
+	var body *dysmsapi20170525.SendBatchSmsResponseBody
+	err = s.callWithRuntime(func(runtime *util.RuntimeOptions) error {
+		resp, err := s.client.SendBatchSmsWithOptions(req, runtime)
+		if err != nil {
+			return err
+		}
+		body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("阿里云短信返回为空")
+	}
+	if tea.StringValue(body.Code) != "OK" {
+		return nil, fmt.Errorf("阿里云短信发送失败: %s %s", tea.StringValue(body.Code), tea.StringValue(body.Message))
+	}
+	return &SMSSendResult{Provider: s.Name(), BizID: tea.StringValue(body.BizId), RequestID: tea.StringValue(body.RequestId)}, nil
+}
+
+// InsSMSClient 是全局的短信客户端。
+var InsSMSClient *SMSClient
+
+// SMSTemplate 描述一个业务模板，Codes 为服务商名称到模板编号的映射，键为空字符串时作为默认编号。
+type SMSTemplate struct {
+	SignName string
+	Codes    map[string]string
+}
+
+// SMSClient 按顺序调用多个服务商，失败时重试并切换到下一个服务商，本身也实现了 SMSSender。
+type SMSClient struct {
+	providers     []SMSSender
+	templates     map[string]SMSTemplate
+	retries       int
+	retryInterval time.Duration
+}
+
+// WithSMSClientOption 短信客户端的配置项。
+type WithSMSClientOption func(*SMSClient)
+
+// WithSMSClientProvider 添加服务商，先添加的优先使用。
+func WithSMSClientProvider(providers ...SMSSender) WithSMSClientOption {
+	return func(c *SMSClient) {
+		for _, p := range providers {
+			if p != nil {
+				c.providers = append(c.providers, p)
+			}
+		}
+	}
+}
+
+// WithSMSClientTemplate 注册业务模板，之后 SMSMessage.TemplateCode 可以直接填写模板名称。
+func WithSMSClientTemplate(name string, tpl SMSTemplate) WithSMSClientOption {
+	return func(c *SMSClient) {
+		c.templates[name] = tpl
+	}
+}
+
+// WithSMSClientRetry 设置每个服务商失败后的重试次数与间隔，默认不重试。
+func WithSMSClientRetry(times int, interval time.Duration) WithSMSClientOption {
+	return func(c *SMSClient) {
+		c.retries = max(times, 0)
+		c.retryInterval = max(interval, 0)
+	}
+}
+
+// NewSMSClient 创建短信客户端，至少需要一个服务商。
+func NewSMSClient(opts ...WithSMSClientOption) (*SMSClient, error) {
+	c := &SMSClient{templates: make(map[string]SMSTemplate)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.providers) == 0 {
+		return nil, errors.New("短信服务商不能为空，需要使用 WithSMSClientProvider 添加")
+	}
+	return c, nil
+}
+
+// InitSMSClient 初始化全局短信客户端 InsSMSClient。
+func InitSMSClient(opts ...WithSMSClientOption) error {
+	client, err := NewSMSClient(opts...)
+	if err != nil {
+		return err
+	}
+	InsSMSClient = client
+	return nil
+}
+
+// Name 用来返回客户端名称。
+func (c *SMSClient) Name() string {
+	return "client"
+}
+
+// Send 用来发送短信，依次尝试各服务商，全部失败时返回每个服务商的错误。
+func (c *SMSClient) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	if msg == nil {
+		return nil, errors.New("短信内容不能为空")
+	}
+	if !ValidateChineseMobile(msg.Phone) {
+		return nil, fmt.Errorf("%w: %s", ErrSMSInvalidPhone, msg.Phone)
+	}
+
+	var errs []error
+	for _, provider := range c.providers {
+		providerMsg, ok := c.resolve(provider.Name(), msg)
+		if !ok {
+			continue
+		}
+		for attempt := 0; attempt <= c.retries; attempt++ {
+			if attempt > 0 && c.retryInterval > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, errors.Join(append(errs, ctx.Err())...)
+				case <-time.After(c.retryInterval):
+				}
+			}
+			result, err := provider.Send(ctx, providerMsg)
+			if err == nil {
+				return result, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			if errors.Is(err, ErrSMSInvalidPhone) || ctx.Err() != nil {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("短信模板 %s 没有可用的服务商", msg.TemplateCode)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// SendTemplate 用来按模板名称发送短信，params 为模板参数。
+func (c *SMSClient) SendTemplate(ctx context.Context, phone, template string, params any) (*SMSSendResult, error) {
+	return c.Send(ctx, &SMSMessage{Phone: phone, TemplateCode: template, Params: params})
+}
+
+// resolve 把模板名称替换成服务商的模板编号，模板未配置该服务商时返回 false。
+func (c *SMSClient) resolve(provider string, msg *SMSMessage) (*SMSMessage, bool) {
+	tpl, ok := c.templates[msg.TemplateCode]
+	if !ok {
+		return msg, true
+	}
+	code, ok := tpl.Codes[provider]
+	if !ok {
+		code, ok = tpl.Codes[""]
+	}
+	if !ok {
+		return nil, false
+	}
+	resolved := *msg
+	resolved.TemplateCode = code
+	if resolved.SignName == "" {
+		resolved.SignName = tpl.SignName
+	}
+	return &resolved, true
+}
+
+// FakeSMSRecord 是 FakeSMSSender 记录下来的一条短信。
+type FakeSMSRecord struct {
+	Phone        string    `json:"phone"`
+	SignName     string    `json:"sign_name"`
+	TemplateCode string    `json:"template_code"`
+	ParamJSON    string    `json:"param_json"`
+	BizID        string    `json:"biz_id"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+// Param 用来读取模板参数中的某个字段，例如 record.Param("code")。
+func (r FakeSMSRecord) Param(key string) string {
+	var params map[string]any
+	if err := json.Unmarshal([]byte(r.ParamJSON), &params); err != nil {
+		return ""
+	}
+	switch v := params[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// FakeSMSSender 是只记录不发送的服务商，用于单元测试与本地开发。
+type FakeSMSSender struct {
+	mu      sync.Mutex
+	name    string
+	err     error
+	records []FakeSMSRecord
+}
+
+// NewFakeSMSSender 创建内存短信服务商，name 为空时使用 fake。
+func NewFakeSMSSender(name string) *FakeSMSSender {
+	if name == "" {
+		name = "fake"
+	}
+	return &FakeSMSSender{name: name}
+}
+
+// Name 用来返回服务商名称。
+func (f *FakeSMSSender) Name() string {
+	return f.name
+}
+
+// Send 用来记录短信，设置了 SetError 时直接返回该错误。
+func (f *FakeSMSSender) Send(_ context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	msg, param, err := normalizeSMSMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	bizID := f.name + "-" + strconv.Itoa(len(f.records)+1)
+	f.records = append(f.records, FakeSMSRecord{
+		Phone:        msg.Phone,
+		SignName:     msg.SignName,
+		TemplateCode: msg.TemplateCode,
+		ParamJSON:    param,
+		BizID:        bizID,
+		SentAt:       Now(),
+	})
+	return &SMSSendResult{Provider: f.name, BizID: bizID}, nil
+}
+
+// SetError 让之后的发送都返回 err，传 nil 恢复正常。
+func (f *FakeSMSSender) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Records 用来返回已记录的全部短信。
+func (f *FakeSMSSender) Records() []FakeSMSRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.records)
+}
+
+// Last 用来返回发给某个手机号的最后一条短信。
+func (f *FakeSMSSender) Last(phone string) (FakeSMSRecord, bool) {
+	phone = normalizeChineseMobile(phone)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.records) - 1; i >= 0; i-- {
+		if f.records[i].Phone == phone {
+			return f.records[i], true
+		}
+	}
+	return FakeSMSRecord{}, false
+}
+
+// Reset 用来清空记录与错误。
+func (f *FakeSMSSender) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = nil
+	f.err = nil
+}
+
+// HTTPSMSSender 是通过 HTTP 接口发送短信的通用服务商，请求与响应格式都可以自定义。
+type HTTPSMSSender struct {
+	name     string
+	url      string
+	headers  map[string]string
+	request  func(msg *SMSMessage, paramJSON string) any
+	response func(resp *resty.Response) (*SMSSendResult, error)
+}
+
+// WithHTTPSMSOption HTTP 短信服务商的配置项。
+type WithHTTPSMSOption func(*HTTPSMSSender)
+
+// WithHTTPSMSHeaders 设置每次请求附带的请求头，例如鉴权信息。
+func WithHTTPSMSHeaders(headers map[string]string) WithHTTPSMSOption {
+	return func(h *HTTPSMSSender) {
+		for k, v := range headers {
+			h.headers[k] = v
+		}
+	}
+}
+
+// WithHTTPSMSRequest 自定义请求体，默认发送 {"phone","sign_name","template_code","template_param"}。
+func WithHTTPSMSRequest(build func(msg *SMSMessage, paramJSON string) any) WithHTTPSMSOption {
+	return func(h *HTTPSMSSender) {
+		if build != nil {
+			h.request = build
+		}
+	}
+}
+
+// WithHTTPSMSResponse 自定义响应解析，默认 2xx 视为成功并读取 biz_id、request_id 字段。
+func WithHTTPSMSResponse(parse func(resp *resty.Response) (*SMSSendResult, error)) WithHTTPSMSOption {
+	return func(h *HTTPSMSSender) {
+		if parse != nil {
+			h.response = parse
+		}
+	}
+}
+
+// NewHTTPSMSSender 创建 HTTP 短信服务商，请求通过 RestyClient() 以 POST JSON 发送到 url。
+func NewHTTPSMSSender(name, url string, opts ...WithHTTPSMSOption) *HTTPSMSSender {
+	h := &HTTPSMSSender{
+		name:    name,
+		url:     url,
+		headers: make(map[string]string),
+		request: func(msg *SMSMessage, paramJSON string) any {
+			return map[string]string{
+				"phone":          msg.Phone,
+				"sign_name":      msg.SignName,
+				"template_code":  msg.TemplateCode,
+				"template_param": paramJSON,
+			}
+		},
+	}
+	h.response = func(resp *resty.Response) (*SMSSendResult, error) {
+		if resp.StatusCode() < http.StatusOK || resp.StatusCode() >= http.StatusMultipleChoices {
+			return nil, newResponseStatusError(h.name+" 短信发送失败", resp)
+		}
+		var body struct {
+			BizID     string `json:"biz_id"`
+			RequestID string `json:"request_id"`
+		}
+		_ = json.Unmarshal(resp.Body(), &body)
+		return &SMSSendResult{BizID: body.BizID, RequestID: body.RequestID}, nil
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Name 用来返回服务商名称。
+func (h *HTTPSMSSender) Name() string {
+	return h.name
+}
+
+// Send 用来通过 HTTP 接口发送短信。
+func (h *HTTPSMSSender) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	msg, param, err := normalizeSMSMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := RestyClient().R().
+		SetContext(ctx).
+		SetHeaders(h.headers).
+		SetHeader("Content-Type", "application/json").
+		SetBody(h.request(msg, param)).
+		Post(h.url)
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.response(resp)
+	if err != nil {
+		return nil, err
+	}
+	if result.Provider == "" {
+		result.Provider = h.name
+	}
+	return result, nil
+}
@@ -4,8 +4,12 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 // ========== 类型定义 ==========
@@ -338,3 +342,191 @@ func (t *TimeHM) UnmarshalJSON(data []byte) error {
 func (t *TimeHM) UnmarshalParam(param string) error {
 	return unmarshalCustomTimeParam(t, param, parseTimeHMString)
 }
+
+// ========== SQLArray ==========
+
+type sqlArrayElem interface {
+	string | bool | int16 | int32 | int64 | float32 | float64
+}
+
+// SQLArray 一维 Postgres 数组类型，例如 text[]、bigint[]。
+// 其他数据库以数组字面量 {a,b} 的文本形式存储，方便在 SQLite 中做仓储测试。
+// 数组中的 NULL 元素会被读取为零值。
+type SQLArray[T sqlArrayElem] []T
+
+// GormDataType 用来让 gorm 识别该切片类型。
+func (SQLArray[T]) GormDataType() string {
+	return "array"
+}
+
+// GormDBDataType 用来在迁移时按方言声明列类型。
+func (SQLArray[T]) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() != string(GormDialectPostgres) {
+		return "text"
+	}
+	var zero T
+	switch any(zero).(type) {
+	case bool:
+		return "boolean[]"
+	case int16:
+		return "smallint[]"
+	case int32:
+		return "integer[]"
+	case int64:
+		return "bigint[]"
+	case float32:
+		return "real[]"
+	case float64:
+		return "double precision[]"
+	default:
+		return "text[]"
+	}
+}
+
+// Scan 用来解析数据库返回的数组字面量。
+func (a *SQLArray[T]) Scan(v interface{}) error {
+	var literal string
+	switch value := v.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		literal = string(value)
+	case string:
+		literal = value
+	default:
+		return fmt.Errorf("无法将 %T 解析为数组", v)
+	}
+
+	items, err := parseSQLArrayLiteral(literal)
+	if err != nil {
+		return err
+	}
+	result := make(SQLArray[T], 0, len(items))
+	for _, item := range items {
+		var elem T
+		if item != nil {
+			if err = parseSQLArrayElem(*item, &elem); err != nil {
+				return err
+			}
+		}
+		result = append(result, elem)
+	}
+	*a = result
+	return nil
+}
+
+// Value 用来把数组写成 {a,b} 字面量，字符串元素统一加双引号。
+func (a SQLArray[T]) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, item := range a {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		switch value := any(item).(type) {
+		case string:
+			builder.WriteByte('"')
+			builder.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value))
+			builder.WriteByte('"')
+		default:
+			builder.WriteString(fmt.Sprint(item))
+		}
+	}
+	builder.WriteByte('}')
+	return builder.String(), nil
+}
+
+// parseSQLArrayLiteral 用来拆分一维数组字面量，未加引号的 NULL 返回 nil。
+func parseSQLArrayLiteral(literal string) ([]*string, error) {
+	literal = strings.TrimSpace(literal)
+	if len(literal) < 2 || literal[0] != '{' || literal[len(literal)-1] != '}' {
+		return nil, fmt.Errorf("数组字面量格式错误: %s", literal)
+	}
+	body := literal[1 : len(literal)-1]
+	if body == "" {
+		return []*string{}, nil
+	}
+
+	var (
+		items   []*string
+		current strings.Builder
+		quoted  bool
+		inQuote bool
+		escaped bool
+	)
+	flush := func() {
+		item := current.String()
+		if !quoted {
+			item = strings.TrimSpace(item)
+			if strings.EqualFold(item, "NULL") {
+				items = append(items, nil)
+				current.Reset()
+				return
+			}
+		}
+		items = append(items, &item)
+		current.Reset()
+		quoted = false
+	}
+	for _, r := range body {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+			quoted = true
+		case r == ',' && !inQuote:
+			flush()
+		case r == '{' && !inQuote:
+			return nil, fmt.Errorf("不支持多维数组: %s", literal)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote || escaped {
+		return nil, fmt.Errorf("数组字面量格式错误: %s", literal)
+	}
+	flush()
+	return items, nil
+}
+
+func parseSQLArrayElem[T sqlArrayElem](raw string, dst *T) error {
+	var err error
+	switch p := any(dst).(type) {
+	case *string:
+		*p = raw
+	case *bool:
+		switch strings.ToLower(raw) {
+		case "t", "true", "1":
+			*p = true
+		case "f", "false", "0":
+			*p = false
+		default:
+			err = fmt.Errorf("无法将 %s 解析为 bool", raw)
+		}
+	case *int16:
+		var v int64
+		v, err = strconv.ParseInt(raw, 10, 16)
+		*p = int16(v)
+	case *int32:
+		var v int64
+		v, err = strconv.ParseInt(raw, 10, 32)
+		*p = int32(v)
+	case *int64:
+		*p, err = strconv.ParseInt(raw, 10, 64)
+	case *float32:
+		var v float64
+		v, err = strconv.ParseFloat(raw, 32)
+		*p = float32(v)
+	case *float64:
+		*p, err = strconv.ParseFloat(raw, 64)
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package wd
 import (
 	"bytes"
 	"html/template"
+	texttemplate "text/template"
 )
 
 // TemplateReplace 用来将字符串模板渲染成实际内容。
@@ -19,3 +20,18 @@ func TemplateReplace(tmp string, replace any) (string, error) {
 
 	return buf.String(), nil
 }
+
+// TemplateReplaceText 用来渲染纯文本模板，与 TemplateReplace 不同，不会对内容做 HTML 转义。
+func TemplateReplaceText(tmp string, replace any) (string, error) {
+	tpl, err := texttemplate.New("text").Parse(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err = tpl.Execute(buf, replace); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -1097,3 +1097,12 @@ func GetDay(t time.Time) int {
 	dayOfYear := time.Date(y, m, d, 0, 0, 0, 0, ShangHaiTimeLocation).YearDay()
 	return y*365 + y/4 - y/100 + y/400 + dayOfYear
 }
+
+// retryBackoff 返回第 attempts 次失败后的指数退避间隔：从 base 开始每次翻倍，不超过 maxBackoff。
+func retryBackoff(attempts int, base, maxBackoff time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}